@@ -64,3 +64,73 @@ func (h *OrderHandler) Add(w http.ResponseWriter, r *http.Request) {
 	httpx.OkJsonCtx(r.Context(), w, result)
 
 }
+
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	ip := tools.GetRemoteClientIp(r)
+	req.Ip = ip
+	l := logic.NewOrderLogic(r.Context(), h.svcCtx)
+	resp, err := l.CancelOrder(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
+
+func (h *OrderHandler) TriggerCurrent(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	ip := tools.GetRemoteClientIp(r)
+	req.Ip = ip
+	l := logic.NewOrderLogic(r.Context(), h.svcCtx)
+	resp, err := l.TriggerCurrent(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
+
+func (h *OrderHandler) TriggerCancel(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	ip := tools.GetRemoteClientIp(r)
+	req.Ip = ip
+	l := logic.NewOrderLogic(r.Context(), h.svcCtx)
+	resp, err := l.TriggerCancel(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
+
+func (h *OrderHandler) OcoAdd(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	ip := tools.GetRemoteClientIp(r)
+	req.Ip = ip
+	l := logic.NewOrderLogic(r.Context(), h.svcCtx)
+	resp, err := l.AddOco(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
+
+func (h *OrderHandler) Amend(w http.ResponseWriter, r *http.Request) {
+	var req types.ExchangeReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	ip := tools.GetRemoteClientIp(r)
+	req.Ip = ip
+	l := logic.NewOrderLogic(r.Context(), h.svcCtx)
+	resp, err := l.Amend(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
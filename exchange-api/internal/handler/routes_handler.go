@@ -16,4 +16,13 @@ func OrderHandlers(r *Routers, serverCtx *svc.ServiceContext) {
 	//当前委托订单 状态 正在交易的状态
 	orderGroup.Post("/order/current",order.Current)
 	orderGroup.Post("/order/add",order.Add)
+	//撤单 只能撤自己的订单
+	orderGroup.Post("/order/cancel",order.Cancel)
+	//等待触发的止损止盈单
+	orderGroup.Post("/order/trigger/current",order.TriggerCurrent)
+	orderGroup.Post("/order/trigger/cancel",order.TriggerCancel)
+	//OCO 止盈限价单和止损单一起提交
+	orderGroup.Post("/order/oco/add",order.OcoAdd)
+	//改单 只改撮合中限价单的价格和数量 不用撤单重下
+	orderGroup.Post("/order/amend",order.Amend)
 }
@@ -79,12 +79,20 @@ func (l *OrderLogic) AddOrder(req *types.ExchangeReq) (string, error) {
 		return "", errors.New("参数传递错误")
 	}
 	orderResp, err := l.svcCtx.OrderRpc.Add(l.ctx, &order.OrderReq{
-		Symbol:    req.Symbol,
-		UserId:    userId,
-		Direction: req.Direction,
-		Type:      req.Type,
-		Price:     req.Price,
-		Amount:    req.Amount,
+		Symbol:        req.Symbol,
+		UserId:        userId,
+		Direction:     req.Direction,
+		Type:          req.Type,
+		Price:         req.Price,
+		Amount:        req.Amount,
+		UseDiscount:   useDiscount(req.UseDiscount),
+		TimeInForce:   req.TimeInForce,
+		ExpireTime:    req.ExpireTime,
+		PostOnly:      req.PostOnly,
+		TriggerPrice:  req.TriggerPrice,
+		DisplayAmount: req.DisplayAmount,
+		TrailAmount:   req.TrailAmount,
+		TrailPercent:  req.TrailPercent,
 	})
 	if err != nil {
 		logx.Errorw("OrderRpc-AddOrder-ERROR", logx.Field("err", err))
@@ -93,3 +101,142 @@ func (l *OrderLogic) AddOrder(req *types.ExchangeReq) (string, error) {
 	return orderResp.OrderId, nil
 
 }
+
+func (l *OrderLogic) CancelOrder(req *types.ExchangeReq) (string, error) {
+	userId := l.ctx.Value("userId").(int64)
+	if req.OrderId == "" {
+		return "", errors.New("参数传递错误")
+	}
+	// 先确认订单是自己的 再交给撮合引擎撤单
+	exchangeOrder, err := l.svcCtx.OrderRpc.FindByOrderId(l.ctx, &order.OrderReq{
+		OrderId: req.OrderId,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-FindByOrderId-ERROR", logx.Field("err", err))
+		return "", err
+	}
+	if exchangeOrder.MemberId != userId {
+		return "", errors.New("无权撤销该订单")
+	}
+	_, err = l.svcCtx.OrderRpc.CancelOrder(l.ctx, &order.OrderReq{
+		OrderId: req.OrderId,
+		UserId:  userId,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-CancelOrder-ERROR", logx.Field("err", err))
+		return "", err
+	}
+	return req.OrderId, nil
+}
+
+// TriggerCurrent 等待触发的止损止盈单
+func (l *OrderLogic) TriggerCurrent(req *types.ExchangeReq) (*pages.PageResult, error) {
+	ctx, cancel := context.WithTimeout(l.ctx, 10*time.Second)
+	defer cancel()
+	userId := l.ctx.Value("userId").(int64)
+	orderRes, err := l.svcCtx.OrderRpc.FindTriggerOrder(ctx, &order.OrderReq{
+		Symbol:   req.Symbol,
+		Page:     req.PageNo,
+		PageSize: req.PageSize,
+		UserId:   userId,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-FindTriggerOrder-ERROR", logx.Field("err", err))
+		return nil, err
+	}
+	list := orderRes.List
+	b := make([]any, len(list))
+	for i := range list {
+		b[i] = list[i]
+	}
+	return pages.New(b, req.PageNo, req.PageSize, orderRes.Total), nil
+}
+
+// waiting 等待触发的订单状态 和exchange服务的model.Waiting保持一致
+const waiting = 5
+
+// TriggerCancel 撤销还没触发的止损止盈单 已经触发的走普通撤单
+func (l *OrderLogic) TriggerCancel(req *types.ExchangeReq) (string, error) {
+	userId := l.ctx.Value("userId").(int64)
+	if req.OrderId == "" {
+		return "", errors.New("参数传递错误")
+	}
+	exchangeOrder, err := l.svcCtx.OrderRpc.FindByOrderId(l.ctx, &order.OrderReq{
+		OrderId: req.OrderId,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-FindByOrderId-ERROR", logx.Field("err", err))
+		return "", err
+	}
+	if exchangeOrder.MemberId != userId {
+		return "", errors.New("无权撤销该订单")
+	}
+	if exchangeOrder.Status != waiting {
+		return "", errors.New("订单不是等待触发的止损止盈单")
+	}
+	_, err = l.svcCtx.OrderRpc.CancelOrder(l.ctx, &order.OrderReq{
+		OrderId: req.OrderId,
+		UserId:  userId,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-CancelOrder-ERROR", logx.Field("err", err))
+		return "", err
+	}
+	return req.OrderId, nil
+}
+
+// AddOco 止盈限价单和止损单一起提交 只冻结一份资金 一条成交或者触发另一条自动撤掉
+// stopPrice 不填 止损单触发后下市价单
+func (l *OrderLogic) AddOco(req *types.ExchangeReq) (*types.OcoOrder, error) {
+	userId := l.ctx.Value("userId").(int64)
+	if req.Direction == "" || req.Price <= 0 || req.TriggerPrice <= 0 {
+		return nil, errors.New("参数传递错误")
+	}
+	ocoRes, err := l.svcCtx.OrderRpc.AddOco(l.ctx, &order.OrderReq{
+		Symbol:       req.Symbol,
+		UserId:       userId,
+		Direction:    req.Direction,
+		Price:        req.Price,
+		Amount:       req.Amount,
+		TriggerPrice: req.TriggerPrice,
+		StopPrice:    req.StopPrice,
+		UseDiscount:  useDiscount(req.UseDiscount),
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-AddOco-ERROR", logx.Field("err", err))
+		return nil, err
+	}
+	return &types.OcoOrder{
+		LinkId:      ocoRes.LinkId,
+		OrderId:     ocoRes.OrderId,
+		StopOrderId: ocoRes.StopOrderId,
+	}, nil
+}
+
+// Amend 改单 price和amount不填的不改 只减少数量的保留排队位置
+// 改单结果由撮合引擎异步处理 返回的只是改单请求已经提交
+func (l *OrderLogic) Amend(req *types.ExchangeReq) (string, error) {
+	userId := l.ctx.Value("userId").(int64)
+	if req.OrderId == "" || req.Price < 0 || req.Amount < 0 || (req.Price == 0 && req.Amount == 0) {
+		return "", errors.New("参数传递错误")
+	}
+	amendRes, err := l.svcCtx.OrderRpc.AmendOrder(l.ctx, &order.OrderReq{
+		OrderId: req.OrderId,
+		UserId:  userId,
+		Price:   req.Price,
+		Amount:  req.Amount,
+	})
+	if err != nil {
+		logx.Errorw("OrderRpc-AmendOrder-ERROR", logx.Field("err", err))
+		return "", err
+	}
+	return amendRes.OrderId, nil
+}
+
+// useDiscount 前端传1表示手续费用平台币抵扣
+func useDiscount(v float64) string {
+	if v == 1 {
+		return "1"
+	}
+	return "0"
+}
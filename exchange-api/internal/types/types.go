@@ -13,6 +13,15 @@ type ExchangeReq struct {
 	Direction string `json:"direction,optional" form:"direction,optional"`
 	Type string `json:"type,optional" form:"type,optional"`
 	UseDiscount float64 `json:"useDiscount,optional" form:"useDiscount,optional"`
+	OrderId string `json:"orderId,optional" form:"orderId,optional"`
+	TimeInForce string `json:"timeInForce,optional" form:"timeInForce,optional"`
+	ExpireTime int64 `json:"expireTime,optional" form:"expireTime,optional"`
+	PostOnly string `json:"postOnly,optional" form:"postOnly,optional"`
+	TriggerPrice float64 `json:"triggerPrice,optional" form:"triggerPrice,optional"`
+	DisplayAmount float64 `json:"displayAmount,optional" form:"displayAmount,optional"`
+	TrailAmount float64 `json:"trailAmount,optional" form:"trailAmount,optional"`
+	TrailPercent float64 `json:"trailPercent,optional" form:"trailPercent,optional"`
+	StopPrice float64 `json:"stopPrice,optional" form:"stopPrice,optional"`
 }
 
 func (r *ExchangeReq) OrderValid() bool {
@@ -40,4 +49,19 @@ type ExchangeOrder struct {
 	Turnover  float64  `json:"turnover" from:"turnover"`
 	Type  string  `json:"type" from:"type"`
 	UseDiscount  string  `json:"useDiscount" from:"useDiscount"`
+	TimeInForce  string  `json:"timeInForce" from:"timeInForce"`
+	ExpireTime  int64  `json:"expireTime" from:"expireTime"`
+	TriggerPrice  float64  `json:"triggerPrice" from:"triggerPrice"`
+	TriggerCondition  string  `json:"triggerCondition" from:"triggerCondition"`
+	DisplayAmount  float64  `json:"displayAmount" from:"displayAmount"`
+	TrailAmount  float64  `json:"trailAmount" from:"trailAmount"`
+	TrailPercent  float64  `json:"trailPercent" from:"trailPercent"`
+	LinkId  string  `json:"linkId" from:"linkId"`
+	Fee  float64  `json:"fee" from:"fee"`
+}
+
+type OcoOrder struct {
+	LinkId  string  `json:"linkId"`
+	OrderId  string  `json:"orderId"`
+	StopOrderId  string  `json:"stopOrderId"`
 }
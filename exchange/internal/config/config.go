@@ -2,6 +2,8 @@ package config
 
 import (
 	"exchange/internal/database"
+	"exchange/internal/journal"
+	"exchange/internal/snapshot"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/zrpc"
 )
@@ -14,4 +16,6 @@ type Config struct {
 	UCenterRpc zrpc.RpcClientConf
 	MarketRpc  zrpc.RpcClientConf
 	Kafka      database.KafkaConfig
+	Journal    journal.Config  `json:",optional"`
+	Snapshot   snapshot.Config `json:",optional"`
 }
@@ -16,16 +16,18 @@ import (
 )
 
 type KafkaConsumer struct {
-	cli     *database.KafkaClient
-	factory *processor.CoinTradeFactory
-	db      *msdb.MsDB
+	cli         *database.KafkaClient
+	factory     *processor.CoinTradeFactory
+	db          *msdb.MsDB
+	triggerBook *processor.TriggerBook
 }
 
-func NewKafkaConsumer(cli *database.KafkaClient, factory *processor.CoinTradeFactory, db *msdb.MsDB) *KafkaConsumer {
+func NewKafkaConsumer(cli *database.KafkaClient, factory *processor.CoinTradeFactory, db *msdb.MsDB, triggerBook *processor.TriggerBook) *KafkaConsumer {
 	return &KafkaConsumer{
-		cli:     cli,
-		factory: factory,
-		db:      db,
+		cli:         cli,
+		factory:     factory,
+		db:          db,
+		triggerBook: triggerBook,
 	}
 }
 
@@ -36,6 +38,14 @@ func (k *KafkaConsumer) Run() {
 	orderDomain := domain.NewExchangeOrderDomain(k.db)
 	k.orderTrading()
 	k.orderComplete(orderDomain)
+	k.orderTrade(domain.NewExchangeTradeDomain(k.db))
+	k.orderCancel()
+	k.orderCanceled(orderDomain)
+	k.orderRepriced(orderDomain)
+	k.orderLinked(orderDomain)
+	k.orderLinkFilled(orderDomain)
+	k.orderAmend()
+	k.orderAmended(orderDomain)
 
 }
 
@@ -55,6 +65,11 @@ func (k *KafkaConsumer) readOrderTrading(cli *database.KafkaClient) {
 		json.Unmarshal(kafkaData.Data, &orderInfo)
 		// 交易对 发送交易引擎
 		coinTrade := k.factory.GetCoinTrade(orderInfo.Symbol)
+		if coinTrade == nil {
+			logx.Error("交易对不存在,symbol=" + orderInfo.Symbol)
+			continue
+		}
+		// 只是投递到交易对的收件箱 撮合在交易对自己的协程里按顺序执行
 		coinTrade.Trade(orderInfo)
 
 	}
@@ -93,6 +108,245 @@ func (k *KafkaConsumer) readOrderComplete(cli *database.KafkaClient, orderDomain
 	}
 }
 
+func (k *KafkaConsumer) orderTrade(tradeDomain *domain.ExchangeTradeDomain) {
+	cli := k.cli.StartRead("exchange_order_trade")
+	go k.readOrderTrade(cli, tradeDomain)
+}
+
+// readOrderTrade 持久化撮合引擎产生的每一笔成交
+func (k *KafkaConsumer) readOrderTrade(cli *database.KafkaClient, tradeDomain *domain.ExchangeTradeDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_trade == kafkaData========", string(kafkaData.Data))
+		var trade *model.ExchangeTrade
+		json.Unmarshal(kafkaData.Data, &trade)
+		if trade == nil {
+			continue
+		}
+		err := tradeDomain.Save(context.Background(), trade)
+		if err != nil {
+			cli.RPut(kafkaData)
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+	}
+}
+
+func (k *KafkaConsumer) orderCancel() {
+	cli := k.cli.StartRead("exchange_order_cancel")
+	go k.readOrderCancel(cli)
+}
+
+// readOrderCancel 撤单请求交给对应交易对的撮合引擎
+func (k *KafkaConsumer) readOrderCancel(cli *database.KafkaClient) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_cancel == kafkaData========", string(kafkaData.Data))
+		var orderInfo *model.ExchangeOrder
+		json.Unmarshal(kafkaData.Data, &orderInfo)
+		if orderInfo == nil {
+			continue
+		}
+		coinTrade := k.factory.GetCoinTrade(orderInfo.Symbol)
+		if coinTrade == nil {
+			logx.Error("交易对不存在,symbol=" + orderInfo.Symbol)
+			continue
+		}
+		// 撤单成功后撮合引擎会发出 exchange_order_canceled
+		coinTrade.Cancel(orderInfo.OrderId)
+	}
+}
+
+func (k *KafkaConsumer) orderRepriced(orderDomain *domain.ExchangeOrderDomain) {
+	cli := k.cli.StartRead("exchange_order_repriced")
+	go k.readOrderRepriced(cli, orderDomain)
+}
+
+// readOrderRepriced post only订单被撮合引擎改价 更新订单价格
+func (k *KafkaConsumer) readOrderRepriced(cli *database.KafkaClient, orderDomain *domain.ExchangeOrderDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_repriced == kafkaData========", string(kafkaData.Data))
+		var orderInfo *model.ExchangeOrder
+		json.Unmarshal(kafkaData.Data, &orderInfo)
+		if orderInfo == nil {
+			continue
+		}
+		err := orderDomain.UpdateOrderPrice(context.Background(), orderInfo)
+		if err != nil {
+			logx.Error("===== Topic === exchange_order_repriced == kafkaData========", err)
+			cli.RPut(kafkaData)
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+	}
+}
+
+func (k *KafkaConsumer) orderLinked(orderDomain *domain.ExchangeOrderDomain) {
+	cli := k.cli.StartRead("exchange_order_linked")
+	go k.readOrderLinked(cli, orderDomain)
+}
+
+// readOrderLinked OCO止损单触发后接过了止盈单剩下的数量 更新订单数量
+func (k *KafkaConsumer) readOrderLinked(cli *database.KafkaClient, orderDomain *domain.ExchangeOrderDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_linked == kafkaData========", string(kafkaData.Data))
+		var orderInfo *model.ExchangeOrder
+		json.Unmarshal(kafkaData.Data, &orderInfo)
+		if orderInfo == nil {
+			continue
+		}
+		err := orderDomain.UpdateOrderAmount(context.Background(), orderInfo)
+		if err != nil {
+			logx.Error("===== Topic === exchange_order_linked == kafkaData========", err)
+			cli.RPut(kafkaData)
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+	}
+}
+
+func (k *KafkaConsumer) orderLinkFilled(orderDomain *domain.ExchangeOrderDomain) {
+	cli := k.cli.StartRead("exchange_order_link_filled")
+	go k.readOrderLinkFilled(cli, orderDomain)
+}
+
+// readOrderLinkFilled OCO止盈单开始成交 撤掉同组还在等待触发的止损单
+// 止损单已经触发的 撮合引擎会处理 这里撤不掉就不管了
+func (k *KafkaConsumer) readOrderLinkFilled(cli *database.KafkaClient, orderDomain *domain.ExchangeOrderDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_link_filled == kafkaData========", string(kafkaData.Data))
+		var orderInfo *model.ExchangeOrder
+		json.Unmarshal(kafkaData.Data, &orderInfo)
+		if orderInfo == nil || orderInfo.LinkId == "" {
+			continue
+		}
+		ctx := context.Background()
+		list, err := orderDomain.FindLinkedOrders(ctx, orderInfo.LinkId)
+		if err != nil {
+			logx.Error("===== Topic === exchange_order_link_filled == kafkaData========", err)
+			cli.RPut(kafkaData)
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+		for _, v := range list {
+			if v.OrderId == orderInfo.OrderId || v.Status != model.Waiting {
+				continue
+			}
+			ok, err := orderDomain.CancelTrigger(ctx, v.OrderId)
+			if err != nil {
+				logx.Error("===== Topic === exchange_order_link_filled == kafkaData========", err)
+				cli.RPut(kafkaData)
+				time.Sleep(200 * time.Millisecond)
+				break
+			}
+			if ok {
+				k.triggerBook.Remove(v.Symbol, v.OrderId)
+			}
+		}
+	}
+}
+
+func (k *KafkaConsumer) orderAmend() {
+	cli := k.cli.StartRead("exchange_order_amend")
+	go k.readOrderAmend(cli)
+}
 
+// readOrderAmend 改单请求交给对应交易对的撮合引擎 要多冻结的资金钱包已经冻结好了
+func (k *KafkaConsumer) readOrderAmend(cli *database.KafkaClient) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_amend == kafkaData========", string(kafkaData.Data))
+		var amend *model.ExchangeOrderAmend
+		json.Unmarshal(kafkaData.Data, &amend)
+		if amend == nil {
+			continue
+		}
+		coinTrade := k.factory.GetCoinTrade(amend.Symbol)
+		if coinTrade == nil {
+			logx.Error("交易对不存在,symbol=" + amend.Symbol)
+			continue
+		}
+		coinTrade.Amend(amend)
+	}
+}
 
+func (k *KafkaConsumer) orderAmended(orderDomain *domain.ExchangeOrderDomain) {
+	cli := k.cli.StartRead("exchange_order_amended")
+	go k.readOrderAmended(cli, orderDomain)
+}
 
+// readOrderAmended 撮合引擎改单完成 成功的更新订单 再通知钱包解冻多冻结的资金
+func (k *KafkaConsumer) readOrderAmended(cli *database.KafkaClient, orderDomain *domain.ExchangeOrderDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_amended == kafkaData========", string(kafkaData.Data))
+		var amended *model.ExchangeOrderAmended
+		json.Unmarshal(kafkaData.Data, &amended)
+		if amended == nil || amended.ExchangeOrderAmend == nil {
+			continue
+		}
+		if amended.Reason == "" {
+			err := orderDomain.UpdateOrderAmend(context.Background(), amended)
+			if err != nil {
+				logx.Error("===== Topic === exchange_order_amended == kafkaData========", err)
+				cli.RPut(kafkaData)
+				time.Sleep(200 * time.Millisecond)
+				continue
+			}
+		} else {
+			logx.Infof("改单被拒绝,orderId=%s,reason=%s", amended.OrderId, amended.Reason)
+		}
+		if amended.Release.Sign() <= 0 {
+			continue
+		}
+		for {
+			kafkaData.Topic = "exchange_order_amend_update_success"
+			err2 := cli.SendSync(kafkaData)
+			if err2 != nil {
+				logx.Error("===== Topic === exchange_order_amend_update_success == kafkaData========", err2)
+				time.Sleep(200 * time.Millisecond)
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (k *KafkaConsumer) orderCanceled(orderDomain *domain.ExchangeOrderDomain) {
+	cli := k.cli.StartRead("exchange_order_canceled")
+	go k.readOrderCanceled(cli, orderDomain)
+}
+
+// readOrderCanceled 撮合引擎撤单成功 更新订单 再通知钱包解冻
+func (k *KafkaConsumer) readOrderCanceled(cli *database.KafkaClient, orderDomain *domain.ExchangeOrderDomain) {
+	for {
+		kafkaData := cli.Read()
+		logx.Info("===== Topic === exchange_order_canceled == kafkaData========", string(kafkaData.Data))
+		var orderInfo *model.ExchangeOrder
+		json.Unmarshal(kafkaData.Data, &orderInfo)
+		if orderInfo == nil {
+			continue
+		}
+		err := orderDomain.UpdateOrderCanceled(context.Background(), orderInfo)
+		if err != nil {
+			logx.Error("===== Topic === exchange_order_canceled == kafkaData========", err)
+			cli.RPut(kafkaData)
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+		// 通知钱包解冻
+		for {
+			kafkaData.Topic = "exchange_order_cancel_update_success"
+			err2 := cli.SendSync(kafkaData)
+			if err2 != nil {
+				logx.Error("===== Topic === exchange_order_cancel_update_success == kafkaData========", err2)
+				time.Sleep(200 * time.Millisecond)
+				continue
+			}
+			break
+		}
+	}
+}
@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"exchange/internal/model"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 	"mscoin-common/msdb/gorms"
 
@@ -43,14 +44,15 @@ func (d *ExchangeOrderDao) FindOrderHistory(ctx context.Context, symbol string,
 	return
 }
 
+// FindOrderCurrent 撮合中的订单 等待触发的跟踪止损单也算 要让用户看到当前的触发价
 func (e *ExchangeOrderDao) FindOrderCurrent(ctx context.Context, symbol string, page int64, size int64, memberId int64) (list []*model.ExchangeOrder, total int64, err error) {
 	session := e.conn.Session(ctx)
 	err = session.Model(&model.ExchangeOrder{}).
-		Where("symbol=? and member_id=? and status=?", symbol, memberId, model.Trading).
+		Where("symbol=? and member_id=? and (status=? or (status=? and type=?))", symbol, memberId, model.Trading, model.Waiting, model.TrailingStop).
 		Limit(int(size)).
 		Offset(int((page - 1) * size)).Find(&list).Error
 	err = session.Model(&model.ExchangeOrder{}).
-		Where("symbol=? and member_id=? and status=?", symbol, memberId, model.Trading).
+		Where("symbol=? and member_id=? and (status=? or (status=? and type=?))", symbol, memberId, model.Trading, model.Waiting, model.TrailingStop).
 		Count(&total).Error
 	if err != nil {
 		logx.Errorw("DAO-FindOrderCurrent", logx.Field("error", err))
@@ -86,35 +88,143 @@ func (e *ExchangeOrderDao) FindOrderByOrderId(ctx context.Context, orderId strin
 	return
 }
 
-func (e *ExchangeOrderDao) UpdateStatusCancel(ctx context.Context, orderId string) error {
+func (e *ExchangeOrderDao) UpdateStatusCancel(ctx context.Context, orderId string) (bool, error) {
 	session := e.conn.Session(ctx)
-	err := session.Model(&model.ExchangeOrder{}).
-		Where("order_id=?", orderId).
-		Update("status", model.Canceled).Error
+	// 只有还没进入撮合的订单可以直接改状态 撮合中的订单要走撮合引擎撤单 返回false说明已经不是init了
+	result := session.Model(&model.ExchangeOrder{}).
+		Where("order_id=? and status=?", orderId, model.Init).
+		Update("status", model.Canceled)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateOrderStatusTrading 冻结成功的订单改成交易中 只改init状态的 返回false说明已经处理过了
+func (e *ExchangeOrderDao) UpdateOrderStatusTrading(ctx context.Context, conn msdb.DbConn, orderId string) (bool, error) {
+	gormConn := conn.(*gorms.GormConn)
+	tx := gormConn.Tx(ctx)
+	result := tx.Model(&model.ExchangeOrder{}).
+		Where("order_id=? and status=?", orderId, model.Init).
+		Update("status", model.Trading)
+	return result.RowsAffected > 0, result.Error
+}
+
+
+func (e *ExchangeOrderDao) FindOrderListBySymbol(ctx context.Context, symbol string, status int) (list []*model.ExchangeOrder, err error) {
+	session := e.conn.Session(ctx)
+	err = session.Model(&model.ExchangeOrder{}).
+		Where("symbol=? and status=?", symbol, status).Find(&list).Error
+	return
+}
+
+
+func (e *ExchangeOrderDao) UpdateOrderComplete(ctx context.Context, orderId string, tradedAmount decimal.Decimal, turnover decimal.Decimal, fee decimal.Decimal, status int) error {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set traded_amount=?,turnover=?,fee=?,status=? where order_id=? and status=?"
+	err := session.Model(&model.ExchangeOrder{}).Exec(updateSql, tradedAmount, turnover, fee, status, orderId, model.Trading).Error
 	return err
 }
 
-func (e *ExchangeOrderDao) UpdateOrderStatusTrading(ctx context.Context, orderId string) error {
+// UpdateOrderPrice post only订单改价 不看状态 改价消息可能比成交完成的消息晚到
+func (e *ExchangeOrderDao) UpdateOrderPrice(ctx context.Context, orderId string, price decimal.Decimal, originalPrice decimal.Decimal) error {
 	session := e.conn.Session(ctx)
-	err := session.Model(&model.ExchangeOrder{}).
-		Where("order_id=?", orderId).
-		Update("status", model.Trading).Error
+	updateSql := "update exchange_order set price=?,original_price=? where order_id=?"
+	err := session.Model(&model.ExchangeOrder{}).Exec(updateSql, price, originalPrice, orderId).Error
 	return err
 }
 
+// FindTriggerOrder 等待触发的止损止盈单
+func (e *ExchangeOrderDao) FindTriggerOrder(ctx context.Context, symbol string, page int64, size int64, memberId int64) (list []*model.ExchangeOrder, total int64, err error) {
+	session := e.conn.Session(ctx)
+	err = session.Model(&model.ExchangeOrder{}).
+		Where("symbol=? and member_id=? and status=?", symbol, memberId, model.Waiting).
+		Limit(int(size)).
+		Offset(int((page - 1) * size)).Find(&list).Error
+	if err != nil {
+		logx.Errorw("DAO-FindTriggerOrder", logx.Field("error", err))
+		return
+	}
+	err = session.Model(&model.ExchangeOrder{}).
+		Where("symbol=? and member_id=? and status=?", symbol, memberId, model.Waiting).
+		Count(&total).Error
+	if err != nil {
+		logx.Errorw("DAO-FindTriggerOrder", logx.Field("error", err))
+	}
+	return
+}
+
+func (e *ExchangeOrderDao) FindOrderListByStatus(ctx context.Context, status int) (list []*model.ExchangeOrder, err error) {
+	session := e.conn.Session(ctx)
+	err = session.Model(&model.ExchangeOrder{}).
+		Where("status=?", status).Find(&list).Error
+	return
+}
+
+// UpdateTriggered 止损止盈单触发 变成普通订单 status是触发后的状态
+// 只改还在等待触发的订单 返回false说明已经被撤掉或者触发过了
+func (e *ExchangeOrderDao) UpdateTriggered(ctx context.Context, conn msdb.DbConn, orderId string, typ int, status int, time int64) (bool, error) {
+	gormConn := conn.(*gorms.GormConn)
+	tx := gormConn.Tx(ctx)
+	updateSql := "update exchange_order set type=?,status=?,time=? where order_id=? and status=?"
+	result := tx.Exec(updateSql, typ, status, time, orderId, model.Waiting)
+	return result.RowsAffected > 0, result.Error
+}
 
-func (e *ExchangeOrderDao) FindOrderListBySymbol(ctx context.Context, symbol string, status int) (list []*model.ExchangeOrder, err error) {
+// UpdateTriggerCancel 撤销等待触发的止损止盈单 还没冻结资金 直接改状态
+func (e *ExchangeOrderDao) UpdateTriggerCancel(ctx context.Context, orderId string, canceledTime int64) (bool, error) {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set status=?,canceled_time=? where order_id=? and status=?"
+	result := session.Exec(updateSql, model.Canceled, canceledTime, orderId, model.Waiting)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateTrail 跟踪止损单的水位线和触发价
+func (e *ExchangeOrderDao) UpdateTrail(ctx context.Context, orderId string, trailMark decimal.Decimal, triggerPrice decimal.Decimal) error {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set trail_mark=?,trigger_price=? where order_id=? and status=?"
+	return session.Exec(updateSql, trailMark, triggerPrice, orderId, model.Waiting).Error
+}
+
+// UpdateTrailTriggered 跟踪止损单触发 和市价单在同一个事务里 返回false说明已经被撤掉了
+func (e *ExchangeOrderDao) UpdateTrailTriggered(ctx context.Context, conn msdb.DbConn, orderId string, completedTime int64) (bool, error) {
+	gormConn := conn.(*gorms.GormConn)
+	tx := gormConn.Tx(ctx)
+	updateSql := "update exchange_order set status=?,completed_time=? where order_id=? and status=?"
+	result := tx.Exec(updateSql, model.Triggered, completedTime, orderId, model.Waiting)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateTrailFailed 跟踪止损单触发后市价单没有下成功 还在等待触发 改成撤销
+func (e *ExchangeOrderDao) UpdateTrailFailed(ctx context.Context, orderId string, canceledTime int64) error {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set status=?,canceled_time=? where order_id=? and status=?"
+	return session.Exec(updateSql, model.Canceled, canceledTime, orderId, model.Waiting).Error
+}
+
+// FindOrderListByLinkId OCO同一组的订单
+func (e *ExchangeOrderDao) FindOrderListByLinkId(ctx context.Context, linkId string) (list []*model.ExchangeOrder, err error) {
 	session := e.conn.Session(ctx)
 	err = session.Model(&model.ExchangeOrder{}).
-		Where("symbol=? and status=?", symbol, status).Find(&list).Error
+		Where("link_id=?", linkId).Find(&list).Error
 	return
 }
 
+// UpdateOrderAmount OCO止损单接过止盈单剩下的数量
+func (e *ExchangeOrderDao) UpdateOrderAmount(ctx context.Context, orderId string, amount decimal.Decimal) error {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set amount=? where order_id=?"
+	return session.Exec(updateSql, amount, orderId).Error
+}
+
+// UpdateOrderAmend 改单成功 不看状态 改单消息可能比成交完成的消息晚到
+func (e *ExchangeOrderDao) UpdateOrderAmend(ctx context.Context, orderId string, price decimal.Decimal, amount decimal.Decimal, frozen decimal.Decimal) error {
+	session := e.conn.Session(ctx)
+	updateSql := "update exchange_order set price=?,amount=?,frozen=? where order_id=?"
+	return session.Exec(updateSql, price, amount, frozen, orderId).Error
+}
 
-func (e *ExchangeOrderDao) UpdateOrderComplete(ctx context.Context, orderId string, tradedAmount float64, turnover float64, status int) error {
+func (e *ExchangeOrderDao) UpdateOrderCanceled(ctx context.Context, orderId string, tradedAmount decimal.Decimal, turnover decimal.Decimal, fee decimal.Decimal, status int, canceledTime int64) error {
 	session := e.conn.Session(ctx)
-	updateSql := "update exchange_order set traded_amount=?,turnover=?,status=? where order_id=? and status=?"
-	err := session.Model(&model.ExchangeOrder{}).Exec(updateSql, tradedAmount, turnover, status, orderId, model.Trading).Error
+	updateSql := "update exchange_order set traded_amount=?,turnover=?,fee=?,status=?,canceled_time=? where order_id=? and status=?"
+	err := session.Model(&model.ExchangeOrder{}).Exec(updateSql, tradedAmount, turnover, fee, status, canceledTime, orderId, model.Trading).Error
 	return err
 }
 
@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"context"
+	"exchange/internal/model"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExchangeTradeDao struct {
+	conn *gorms.GormConn
+}
+
+func NewExchangeTradeDao(db *msdb.MsDB) *ExchangeTradeDao {
+	return &ExchangeTradeDao{
+		conn: gorms.New(db.Conn),
+	}
+}
+
+// Save trade_id 为唯一索引 kafka重复投递的成交记录直接忽略
+func (d *ExchangeTradeDao) Save(ctx context.Context, trade *model.ExchangeTrade) error {
+	session := d.conn.Session(ctx)
+	return session.Clauses(clause.OnConflict{DoNothing: true}).Create(trade).Error
+}
+
+// FindLastBySymbol 交易对最新的一笔成交 没有成交过返回nil
+func (d *ExchangeTradeDao) FindLastBySymbol(ctx context.Context, symbol string) (trade *model.ExchangeTrade, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.ExchangeTrade{}).
+		Where("symbol=?", symbol).
+		Order("id desc").
+		First(&trade).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return
+}
+
+// FindMemberTurnover startTime以后每个会员在每个交易对上的成交额 买方卖方都算一次
+func (d *ExchangeTradeDao) FindMemberTurnover(ctx context.Context, startTime int64) (list []*model.MemberTurnover, err error) {
+	session := d.conn.Session(ctx)
+	sql := "select member_id,symbol,sum(turnover) as turnover from (" +
+		"select buy_member_id as member_id,symbol,turnover from exchange_trade where time>=? " +
+		"union all " +
+		"select sell_member_id as member_id,symbol,turnover from exchange_trade where time>=?" +
+		") t group by member_id,symbol"
+	err = session.Raw(sql, startTime, startTime).Scan(&list).Error
+	return
+}
@@ -29,6 +29,8 @@ type KafkaClient struct {
 	c         KafkaConfig
 	closed    bool
 	mutex     sync.Mutex
+	keyed     *kafka.Writer // 按key分区的writer SendKeyed 用
+	keyedOnce sync.Once
 }
 
 
@@ -78,6 +80,24 @@ func (k *KafkaClient) SendSync(data KafkaData) error {
 	return err
 }
 
+// SendKeyed 同步发送 按key哈希选分区 同一个key的消息进同一个分区 消费时保持发送的顺序
+// outbox这种要按key保证顺序的消息用它 SendSync 按数据量选分区 顺序没有保证
+func (k *KafkaClient) SendKeyed(data KafkaData) error {
+	k.keyedOnce.Do(func() {
+		k.keyed = &kafka.Writer{
+			Addr:     kafka.TCP(k.c.Addr),
+			Balancer: &kafka.Hash{},
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return k.keyed.WriteMessages(ctx, kafka.Message{
+		Topic: data.Topic,
+		Key:   data.Key,
+		Value: data.Data,
+	})
+}
+
 func (w *KafkaClient) Close() {
 	if w.w != nil {
 		w.w.Close()
@@ -91,6 +111,9 @@ func (w *KafkaClient) Close() {
 	if w.r != nil {
 		w.r.Close()
 	}
+	if w.keyed != nil {
+		w.keyed.Close()
+	}
 }
 
 func (w *KafkaClient) sendKafka() {
@@ -3,10 +3,13 @@ package domain
 import (
 	"context"
 	"encoding/json"
-	"time"
 
 	"exchange/internal/database"
 	"exchange/internal/model"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
+	"mscoin-common/msdb/tran"
 
 	"github.com/zeromicro/go-zero/core/logx"
 )
@@ -14,12 +17,14 @@ import (
 type KafkaDomain struct {
 	cli         *database.KafkaClient
 	orderDomain *ExchangeOrderDomain
+	transaction tran.Transaction
 }
 
-func NewKafkaDomain(cli *database.KafkaClient, orderDomain *ExchangeOrderDomain) *KafkaDomain {
+func NewKafkaDomain(db *msdb.MsDB, cli *database.KafkaClient, orderDomain *ExchangeOrderDomain) *KafkaDomain {
 	kafka := &KafkaDomain{
 		cli:         cli,
 		orderDomain: orderDomain,
+		transaction: tran.NewTransaction(db.Conn),
 	}
 
 	// 启动一个协程，监听kafka的消息
@@ -28,9 +33,8 @@ func NewKafkaDomain(cli *database.KafkaClient, orderDomain *ExchangeOrderDomain)
 	return kafka
 }
 
-// 发送订单消息
-
-func (k *KafkaDomain) SendOrder(topic string, userId int64, orderId string, money float64, symbol string, direction int, baseSymbol string, coinSymbol string) error {
+// SaveOrder 订单消息写进outbox 和订单在同一个事务里提交 提交以后由relay发给kafka
+func (k *KafkaDomain) SaveOrder(ctx context.Context, conn msdb.DbConn, topic string, userId int64, orderId string, money decimal.Decimal, symbol string, direction int, baseSymbol string, coinSymbol string) error {
 	m := make(map[string]any)
 	m["userId"] = userId
 	m["orderId"] = orderId
@@ -40,19 +44,62 @@ func (k *KafkaDomain) SendOrder(topic string, userId int64, orderId string, mone
 	m["baseSymbol"] = baseSymbol
 	m["coinSymbol"] = coinSymbol
 	kafaData, _ := json.Marshal(m)
+	err := outbox.Save(ctx, conn, topic, orderId, kafaData)
+	if err != nil {
+		logx.Error(err)
+		return err
+	}
+	logx.Info("创建订单，消息写入outbox,orderId=" + orderId)
+	return nil
+}
+
+// SendCancelOrder 撤单请求发给撮合引擎 引擎从盘口撤掉以后再发出撤单事件
+func (k *KafkaDomain) SendCancelOrder(order *model.ExchangeOrder) error {
+	marshal, _ := json.Marshal(order)
+	data := database.KafkaData{
+		Topic: "exchange_order_cancel",
+		Key:   []byte(order.OrderId),
+		Data:  marshal,
+	}
+	err := k.cli.SendSync(data)
+	if err != nil {
+		logx.Error(err)
+		return err
+	}
+	logx.Info("撤单，发消息成功,orderId=" + order.OrderId)
+	return nil
+}
+
+// SaveTradingOrder 订单直接发给撮合引擎 OCO止损单触发后不用冻结资金走这里
+// 消息写进outbox 和订单状态一起提交
+func (k *KafkaDomain) SaveTradingOrder(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder) error {
+	marshal, _ := json.Marshal(order)
+	return outbox.Save(ctx, conn, "exchange_order_trading", order.OrderId, marshal)
+}
+
+// SaveCanceledOrder 冻结完成前已经撤销的订单 按撤单通知钱包解冻 没有成交 冻结的全部还回去
+// 钱包按订单号只解冻一次 冻结结果重复投递也不会多解冻
+func (k *KafkaDomain) SaveCanceledOrder(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder) error {
+	marshal, _ := json.Marshal(order)
+	return outbox.Save(ctx, conn, "exchange_order_cancel_update_success", order.OrderId, marshal)
+}
+
+// SendAmendOrder 改单请求 要多冻结资金的先发给钱包 topic=exchange_order_amend_freeze
+// 不用多冻结的直接发给撮合引擎 topic=exchange_order_amend
+func (k *KafkaDomain) SendAmendOrder(topic string, amend *model.ExchangeOrderAmend) error {
+	marshal, _ := json.Marshal(amend)
 	data := database.KafkaData{
 		Topic: topic,
-		Key:   []byte(orderId),
-		Data:  kafaData,
+		Key:   []byte(amend.OrderId),
+		Data:  marshal,
 	}
-	// SendSync（同步发送）
-	// 同步发送消息到 Kafka。
-	// 方法会阻塞，直到消息被 Kafka 确认（即 broker 返回 ack）。
-	// 你可以直接拿到发送结果（成功/失败），可以做错误处理和重试。
-	// 适合对可靠性要求高、需要确认消息已被写入 Kafka 的场景。
 	err := k.cli.SendSync(data)
-	logx.Info("创建订单，发消息成功,orderId=" + orderId)
-	return err
+	if err != nil {
+		logx.Error(err)
+		return err
+	}
+	logx.Info("改单，发消息成功,orderId=" + amend.OrderId)
+	return nil
 }
 
 type OrderResult struct {
@@ -73,9 +120,9 @@ func (k *KafkaDomain) WaitAddOrderResult() {
 		if err != nil {
 			logx.Error(err)
 			// 更新订单状态，取消订单
-			err := k.orderDomain.UpdateStatusCancel(context.Background(), exchangeOrder.OrderId)
+			_, err := k.orderDomain.UpdateStatusCancel(context.Background(), orderResult.OrderId)
 			if err != nil {
-				logx.Error("更新订单状态失败，orderId=" + exchangeOrder.OrderId)
+				logx.Error("更新订单状态失败，orderId=" + orderResult.OrderId)
 				// 重新方法kafka
 				k.cli.RPut(kafkaData)
 				continue
@@ -86,34 +133,40 @@ func (k *KafkaDomain) WaitAddOrderResult() {
 			logx.Error("订单不存在，orderId=" + orderResult.OrderId)
 			continue
 		}
+		if exchangeOrder.Status == model.Canceled && exchangeOrder.CanceledTime == 0 {
+			// 钱包冻结的时候用户撤了单 冻结的资金不会再有人解冻 这里通知钱包解冻
+			// 撮合引擎撤的单有撤单时间 引擎会通知钱包解冻 不走这里
+			err = k.transaction.Action(func(conn msdb.DbConn) error {
+				return k.SaveCanceledOrder(context.Background(), conn, exchangeOrder)
+			})
+			if err != nil {
+				logx.Error(err)
+				k.cli.RPut(kafkaData)
+				continue
+			}
+			logx.Info("订单冻结前已撤销，通知钱包解冻,orderId=" + exchangeOrder.OrderId)
+			continue
+		}
 		if exchangeOrder.Status != model.Init {
 			logx.Error("订单已经被处理过")
 			continue
 		}
-		err = k.orderDomain.UpdateOrderStatusTrading(context.Background(), orderResult.OrderId)
+		//需要发送消息到kafka 订单需要加入到撮合交易当中
+		//状态和发给撮合引擎的消息在同一个事务里提交 不会改了状态消息没发出去
+		exchangeOrder.Status = model.Trading
+		err = k.transaction.Action(func(conn msdb.DbConn) error {
+			ctx := context.Background()
+			ok, err := k.orderDomain.UpdateOrderStatusTrading(ctx, conn, exchangeOrder.OrderId)
+			if err != nil || !ok {
+				return err
+			}
+			return k.SaveTradingOrder(ctx, conn, exchangeOrder)
+		})
 		if err != nil {
 			logx.Error(err)
 			k.cli.RPut(kafkaData)
 			continue
 		}
-		//需要发送消息到kafka 订单需要加入到撮合交易当中
-		//如果没有撮合交易成功 加入撮合交易的队列 继续等待完成撮合
-		exchangeOrder.Status = model.Trading
-		for {
-			logx.Info("============发送消息到exchange_order_trading============" + exchangeOrder.OrderId)
-			bytes, _ := json.Marshal(exchangeOrder)
-			orderData := database.KafkaData{
-				Topic: "exchange_order_trading",
-				Key:   []byte(exchangeOrder.OrderId),
-				Data:  bytes,
-			}
-			err := k.cli.SendSync(orderData)
-			if err != nil {
-				logx.Error(err)
-				time.Sleep(250 * time.Millisecond)
-				continue
-			}
-			break
-		}
+		logx.Info("订单进入撮合，消息写入outbox,orderId=" + exchangeOrder.OrderId)
 	}
 }
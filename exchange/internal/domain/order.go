@@ -9,7 +9,7 @@ import (
 	"grpc-common/market/mclient"
 	"grpc-common/ucenter/ucclient"
 	"mscoin-common/msdb"
-	"mscoin-common/op"
+	"mscoin-common/decimal"
 	"mscoin-common/tools"
 	"time"
 
@@ -67,12 +67,12 @@ func (d *ExchangeOrderDomain) FindByOrderId(ctx context.Context, orderId string)
 	return order, nil
 }
 
-func (d *ExchangeOrderDomain) UpdateStatusCancel(ctx context.Context, orderId string) error {
+func (d *ExchangeOrderDomain) UpdateStatusCancel(ctx context.Context, orderId string) (bool, error) {
 	return d.orderRepo.UpdateStatusCancel(ctx, orderId)
 }
 
-func (d *ExchangeOrderDomain) UpdateOrderStatusTrading(ctx context.Context, orderId string) error {
-	return d.orderRepo.UpdateOrderStatusTrading(ctx, orderId)
+func (d *ExchangeOrderDomain) UpdateOrderStatusTrading(ctx context.Context, conn msdb.DbConn, orderId string) (bool, error) {
+	return d.orderRepo.UpdateOrderStatusTrading(ctx, conn, orderId)
 }
 
 
@@ -81,33 +81,122 @@ func (d *ExchangeOrderDomain) FindOrderListBySymbol(ctx context.Context, symbol
 }
 
 func (d *ExchangeOrderDomain) UpdateOrderComplete(context context.Context, orderInfo *model.ExchangeOrder) any {
-	return d.orderRepo.UpdateOrderComplete(context, orderInfo.OrderId, orderInfo.TradedAmount, orderInfo.Turnover, orderInfo.Status)
+	return d.orderRepo.UpdateOrderComplete(context, orderInfo.OrderId, orderInfo.TradedAmount, orderInfo.Turnover, orderInfo.Fee, orderInfo.Status)
 }
 
+// UpdateOrderCanceled 撮合引擎撤单成功后 记录撤单时已经成交的数量
+// 委托超时下架的订单状态是 OverTimed 其他都是 Canceled
+func (d *ExchangeOrderDomain) UpdateOrderCanceled(ctx context.Context, orderInfo *model.ExchangeOrder) error {
+	return d.orderRepo.UpdateOrderCanceled(ctx, orderInfo.OrderId, orderInfo.TradedAmount, orderInfo.Turnover, orderInfo.Fee, orderInfo.Status, orderInfo.CanceledTime)
+}
+
+// UpdateOrderPrice post only订单被撮合引擎改价 记录新的价格和原来的价格
+func (d *ExchangeOrderDomain) UpdateOrderPrice(ctx context.Context, orderInfo *model.ExchangeOrder) error {
+	return d.orderRepo.UpdateOrderPrice(ctx, orderInfo.OrderId, orderInfo.Price, orderInfo.OriginalPrice)
+}
+
+
+// FindTriggerOrder 用户等待触发的止损止盈单
+func (d *ExchangeOrderDomain) FindTriggerOrder(ctx context.Context, symbol string, page int64, size int64, memberId int64) ([]*model.ExchangeOrderVo, int64, error) {
+	list, total, err := d.orderRepo.FindTriggerOrder(ctx, symbol, page, size, memberId)
+	if err != nil {
+		logx.Errorw("Domain-FindTriggerOrder", logx.Field("error", err))
+		return nil, 0, err
+	}
+	voList := make([]*model.ExchangeOrderVo, len(list))
+	for i, v := range list {
+		voList[i] = v.ToVo()
+	}
+	return voList, total, nil
+}
+
+func (d *ExchangeOrderDomain) FindOrderListByStatus(ctx context.Context, status int) ([]*model.ExchangeOrder, error) {
+	return d.orderRepo.FindOrderListByStatus(ctx, status)
+}
+
+// AddTriggerOrder 保存止损止盈单 触发之前不冻结资金 触发时再按普通订单冻结
+func (d *ExchangeOrderDomain) AddTriggerOrder(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder) error {
+	order.Status = model.Waiting
+	order.TradedAmount = decimal.Zero
+	order.Time = time.Now().UnixMilli()
+	order.OrderId = tools.Unq("E")
+	return d.orderRepo.Save(ctx, conn, order)
+}
+
+// Triggered 止损止盈单触发 换成对应的市价单或者限价单 时间按触发时间算
+// OCO止损单用止盈单冻结的资金 不用再冻结 直接进入撮合
+func (d *ExchangeOrderDomain) Triggered(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder) (bool, error) {
+	typ := model.TriggerTarget(order.Type)
+	if typ < 0 {
+		return false, errors.New("orderId:" + order.OrderId + "不是止损止盈单")
+	}
+	status := model.Init
+	if order.IsOcoStop() {
+		status = model.Trading
+	}
+	now := time.Now().UnixMilli()
+	ok, err := d.orderRepo.UpdateTriggered(ctx, conn, order.OrderId, typ, status, now)
+	if err != nil || !ok {
+		return ok, err
+	}
+	order.Type = typ
+	order.Status = status
+	order.Time = now
+	return true, nil
+}
+
+// CancelTrigger 撤销等待触发的止损止盈单 返回false说明已经触发或者撤销了
+func (d *ExchangeOrderDomain) CancelTrigger(ctx context.Context, orderId string) (bool, error) {
+	return d.orderRepo.UpdateTriggerCancel(ctx, orderId, time.Now().UnixMilli())
+}
+
+// UpdateTrail 保存跟踪止损单移动后的水位线和触发价
+func (d *ExchangeOrderDomain) UpdateTrail(ctx context.Context, order *model.ExchangeOrder) error {
+	return d.orderRepo.UpdateTrail(ctx, order.OrderId, order.TrailMark, order.TriggerPrice)
+}
+
+// TrailTriggered 跟踪止损单触发 在下市价单的事务里调用 返回false说明已经撤销了
+func (d *ExchangeOrderDomain) TrailTriggered(ctx context.Context, conn msdb.DbConn, orderId string) (bool, error) {
+	return d.orderRepo.UpdateTrailTriggered(ctx, conn, orderId, time.Now().UnixMilli())
+}
+
+// TrailFailed 跟踪止损单触发后没有下单成功
+func (d *ExchangeOrderDomain) TrailFailed(ctx context.Context, orderId string) error {
+	return d.orderRepo.UpdateTrailFailed(ctx, orderId, time.Now().UnixMilli())
+}
+
+// FindLinkedOrders OCO同一组的订单 包括自己
+func (d *ExchangeOrderDomain) FindLinkedOrders(ctx context.Context, linkId string) ([]*model.ExchangeOrder, error) {
+	return d.orderRepo.FindOrderListByLinkId(ctx, linkId)
+}
+
+// UpdateOrderAmount OCO止损单触发后 撮合引擎把止盈单剩下的数量转给了它
+func (d *ExchangeOrderDomain) UpdateOrderAmount(ctx context.Context, orderInfo *model.ExchangeOrder) error {
+	return d.orderRepo.UpdateOrderAmount(ctx, orderInfo.OrderId, orderInfo.Amount)
+}
+
+// UpdateOrderAmend 撮合引擎改单成功 记录新的价格数量和冻结的资金
+func (d *ExchangeOrderDomain) UpdateOrderAmend(ctx context.Context, amended *model.ExchangeOrderAmended) error {
+	return d.orderRepo.UpdateOrderAmend(ctx, amended.OrderId, amended.Price, amended.Amount, amended.Frozen)
+}
 
 func (d *ExchangeOrderDomain) AddOrder(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder, coin *mclient.ExchangeCoin,
 	baseWallet *ucclient.MemberWallet,
-	coinWallet *ucclient.MemberWallet) (float64, error) {
+	coinWallet *ucclient.MemberWallet) (decimal.Decimal, error) {
 	order.Status = model.Init
-	order.TradedAmount = 0
+	order.TradedAmount = decimal.Zero
 	order.Time = time.Now().UnixMilli()
 	order.OrderId = tools.Unq("E")
-	//交易的时候  coin.Fee 费率 手续费 我们做的时候 先不考虑手续费
+	//手续费撮合时按每笔成交算 结算时从收到的资产里扣 下单不用多冻结
 	//买 花USDT 市价 price 0 冻结的直接就是amount  卖 BTC
-	var money float64
+	money := order.FreezeMoney()
 	if order.Direction == model.BUY {
-		if order.Type == model.MarketPrice {
-			money = order.Amount
-		} else {
-			money = op.MulFloor(order.Price, order.Amount, 8)
-		}
-		if baseWallet.Balance < money {
-			return 0, errors.New("余额不足")
+		if decimal.NewFromFloat(baseWallet.Balance).LessThan(money) {
+			return decimal.Zero, errors.New("余额不足")
 		}
 	} else {
-		money = order.Amount
-		if coinWallet.Balance < money {
-			return 0, errors.New("余额不足")
+		if decimal.NewFromFloat(coinWallet.Balance).LessThan(money) {
+			return decimal.Zero, errors.New("余额不足")
 		}
 	}
 
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"context"
+	"exchange/internal/dao"
+	"exchange/internal/model"
+	"exchange/internal/repo"
+	"mscoin-common/msdb"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ExchangeTradeDomain struct {
+	tradeRepo repo.ExchangeTradeRepo
+}
+
+func NewExchangeTradeDomain(db *msdb.MsDB) *ExchangeTradeDomain {
+	return &ExchangeTradeDomain{
+		tradeRepo: dao.NewExchangeTradeDao(db),
+	}
+}
+
+func (d *ExchangeTradeDomain) Save(ctx context.Context, trade *model.ExchangeTrade) error {
+	err := d.tradeRepo.Save(ctx, trade)
+	if err != nil {
+		logx.Errorw("Domain-SaveTrade", logx.Field("error", err), logx.Field("tradeId", trade.TradeId))
+	}
+	return err
+}
+
+// FindLastBySymbol 交易对最新的一笔成交
+func (d *ExchangeTradeDomain) FindLastBySymbol(ctx context.Context, symbol string) (*model.ExchangeTrade, error) {
+	trade, err := d.tradeRepo.FindLastBySymbol(ctx, symbol)
+	if err != nil {
+		logx.Errorw("Domain-FindLastBySymbol", logx.Field("error", err), logx.Field("symbol", symbol))
+	}
+	return trade, err
+}
+
+// FindMemberTurnover startTime以后每个会员在每个交易对上的成交额
+func (d *ExchangeTradeDomain) FindMemberTurnover(ctx context.Context, startTime int64) ([]*model.MemberTurnover, error) {
+	list, err := d.tradeRepo.FindMemberTurnover(ctx, startTime)
+	if err != nil {
+		logx.Errorw("Domain-FindMemberTurnover", logx.Field("error", err), logx.Field("startTime", startTime))
+	}
+	return list, err
+}
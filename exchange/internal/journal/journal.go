@@ -0,0 +1,253 @@
+// Package journal 撮合引擎的事件日志
+// 每个交易对一个只追加的文件 每行一条json 序号连续递增
+// 输入指令(下单 撤单)和输出事件(成交 盘口 完成 撤单成功)共用一个序号
+// 重启或者回放时 按顺序重新执行输入指令就能得到同样的盘口和成交
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 输入指令
+const (
+	TypeLoad    = "load" // 启动时从数据库加载的挂单 直接放进盘口 不参与撮合
+	TypePlace   = "place"
+	TypeCancel  = "cancel"
+	TypeExpire  = "expire"  // 撤掉到期的GTD订单
+	TypeConfig  = "config"  // 交易对配置 启动时和上次不一样才记录
+	TypeAmend   = "amend"   // 改单
+	TypeUncross = "uncross" // 集合竞价结束 按一个价格撮合
+)
+
+// 输出事件
+const (
+	TypeTrade    = "trade"
+	TypePlate    = "plate"
+	TypeComplete = "complete"
+	TypeCanceled = "canceled"
+	TypeRepriced = "repriced"
+	TypeLinked   = "linked" // OCO止损单接过止盈单剩下的数量
+	TypeFilled   = "filled" // OCO止盈单第一次成交
+	TypeAmended  = "amended"
+	TypeHalt     = "halt" // 交易对熔断
+)
+
+// IsInput 是否是输入指令 回放时只执行输入指令 输出事件用来比对
+func IsInput(typ string) bool {
+	return typ == TypeLoad || typ == TypePlace || typ == TypeCancel || typ == TypeExpire || typ == TypeConfig || typ == TypeAmend || typ == TypeUncross
+}
+
+type Entry struct {
+	Seq  int64           `json:"seq"`
+	Type string          `json:"type"`
+	Time int64           `json:"time"` // 输入指令的时间 撮合引擎用它代替当前时间 保证回放结果一致
+	Data json.RawMessage `json:"data"`
+}
+
+type Config struct {
+	Dir  string `json:"dir,optional"`  // 为空不记录日志
+	Sync bool   `json:"sync,optional"` // 每条都刷盘 更安全但是更慢
+}
+
+type Journal struct {
+	file    *os.File
+	w       *bufio.Writer
+	seq     int64
+	sync    bool
+	ackFile *os.File
+	acked   int64
+	mux     sync.Mutex
+}
+
+// FileName BTC/USDT -> dir/BTC_USDT.journal
+func FileName(dir string, symbol string) string {
+	return filepath.Join(dir, strings.ReplaceAll(symbol, "/", "_")+".journal")
+}
+
+// AckFileName BTC/USDT -> dir/BTC_USDT.ack 记录已经发到kafka的最后一个序号
+func AckFileName(dir string, symbol string) string {
+	return filepath.Join(dir, strings.ReplaceAll(symbol, "/", "_")+".ack")
+}
+
+// Open 打开交易对的日志 不存在就创建 已经存在会读出最后的序号接着写
+func Open(c Config, symbol string) (*Journal, error) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := FileName(c.Dir, symbol)
+	var last int64
+	offset, err := scan(name, func(e *Entry) error {
+		last = e.Seq
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// 去掉没写完整的最后一行 否则新的记录会接在半行后面
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	j := &Journal{
+		file: file,
+		w:    bufio.NewWriter(file),
+		seq:  last,
+		sync: c.Sync,
+	}
+	if err := j.openAck(AckFileName(c.Dir, symbol)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// openAck 读出确认过的序号 没有确认文件的是之前的版本写的日志 当成都发过了
+func (j *Journal) openAck(name string) error {
+	data, err := os.ReadFile(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	j.ackFile = file
+	if !exists {
+		return j.writeAck(j.seq)
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%d", &j.acked); err != nil {
+		// 写了一半的确认文件 从头补发 下游会去重
+		j.acked = 0
+	}
+	if j.acked > j.seq {
+		j.acked = j.seq
+	}
+	return nil
+}
+
+// writeAck 定长覆盖写 不用截断文件
+func (j *Journal) writeAck(seq int64) error {
+	if _, err := j.ackFile.WriteAt([]byte(fmt.Sprintf("%020d\n", seq)), 0); err != nil {
+		return err
+	}
+	j.acked = seq
+	return nil
+}
+
+// Ack 序号之前的输出事件都已经发到kafka 重启后只补发之后的
+func (j *Journal) Ack(seq int64) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	if seq <= j.acked {
+		return nil
+	}
+	return j.writeAck(seq)
+}
+
+// Acked 最后确认发送的序号
+func (j *Journal) Acked() int64 {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.acked
+}
+
+// Append 分配下一个序号并写入 写入成功才返回
+func (j *Journal) Append(typ string, time int64, v any) (*Entry, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	e := &Entry{
+		Seq:  j.seq + 1,
+		Type: typ,
+		Time: time,
+		Data: data,
+	}
+	line, _ := json.Marshal(e)
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	if err := j.w.Flush(); err != nil {
+		return nil, err
+	}
+	if j.sync {
+		if err := j.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	j.seq = e.Seq
+	return e, nil
+}
+
+// LastSeq 最后写入的序号
+func (j *Journal) LastSeq() int64 {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.seq
+}
+
+func (j *Journal) Close() error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	j.ackFile.Close()
+	return j.file.Close()
+}
+
+// Read 按顺序读取日志文件
+// 最后一行如果没写完整(进程在写的时候挂了)直接忽略 其他地方序号不连续或者格式错误都返回错误
+func Read(name string, fn func(e *Entry) error) error {
+	_, err := scan(name, fn)
+	return err
+}
+
+// scan 返回最后一条完整记录结束的位置
+func scan(name string, fn func(e *Entry) error) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	var last int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 没有换行的半行 只可能是最后一行
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(line, e); err != nil {
+			return offset, fmt.Errorf("journal %s: bad entry after seq %d: %w", name, last, err)
+		}
+		if e.Seq != last+1 {
+			return offset, fmt.Errorf("journal %s: seq %d after %d", name, e.Seq, last)
+		}
+		if err := fn(e); err != nil {
+			return offset, err
+		}
+		last = e.Seq
+		offset += int64(len(line))
+	}
+}
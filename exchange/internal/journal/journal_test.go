@@ -0,0 +1,67 @@
+package journal
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAckSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	c := Config{Dir: dir}
+	j, err := Open(c, "BTC/USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Acked() != 0 {
+		t.Fatalf("new journal acked %d", j.Acked())
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := j.Append(TypeTrade, 1, map[string]int{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Ack(2); err != nil {
+		t.Fatal(err)
+	}
+	// 序号只会往前走
+	if err := j.Ack(1); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = Open(c, "BTC/USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Acked() != 2 || j.LastSeq() != 3 {
+		t.Fatalf("reopened acked %d last %d, want 2 3", j.Acked(), j.LastSeq())
+	}
+	j.Close()
+}
+
+// 之前的版本没有确认文件 当成都发过了 不能把整个日志重发一遍
+func TestAckMissingFileMeansAllSent(t *testing.T) {
+	dir := t.TempDir()
+	c := Config{Dir: dir}
+	j, err := Open(c, "BTC/USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := j.Append(TypeTrade, 1, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+	if err := os.Remove(AckFileName(dir, "BTC/USDT")); err != nil {
+		t.Fatal(err)
+	}
+	j, err = Open(c, "BTC/USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.Acked() != 2 {
+		t.Fatalf("acked %d, want 2", j.Acked())
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"exchange/internal/domain"
 	"exchange/internal/model"
+	"exchange/internal/processor"
 	"exchange/internal/svc"
 	"fmt"
 	"grpc-common/exchange/types/order"
 	"grpc-common/market/types/market"
 	"grpc-common/ucenter/types/asset"
 	"grpc-common/ucenter/types/member"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 	"mscoin-common/msdb/tran"
+	"mscoin-common/tools"
+	"time"
 
 	"github.com/jinzhu/copier"
 	"github.com/zeromicro/go-zero/core/logx"
@@ -35,7 +39,7 @@ func NewExchangeOrderLogic(ctx context.Context, svcCtx *svc.ServiceContext) *Exc
 		Logger:              logx.WithContext(ctx),
 		exchangeOrderDomain: orderDomain,
 		transaction:         tran.NewTransaction(svcCtx.Db.Conn),
-		kafkaDomain:         domain.NewKafkaDomain(svcCtx.KafkaClient, orderDomain),
+		kafkaDomain:         domain.NewKafkaDomain(svcCtx.Db, svcCtx.KafkaClient, orderDomain),
 	}
 }
 
@@ -75,7 +79,30 @@ func (l *ExchangeOrderLogic) FindOrderCurrent(req *order.OrderReq) (*order.Order
 	}, nil
 }
 
+func (l *ExchangeOrderLogic) FindTriggerOrder(req *order.OrderReq) (*order.OrderRes, error) {
+	voList, total, err := l.exchangeOrderDomain.FindTriggerOrder(l.ctx, req.Symbol, req.Page, req.PageSize, req.UserId)
+	if err != nil {
+		logx.Errorw("Logic-FindTriggerOrder", logx.Field("error", err))
+		return nil, err
+	}
+	var list []*order.ExchangeOrder
+	err = copier.Copy(&list, &voList)
+	if err != nil {
+		logx.Errorw("Logic-FindTriggerOrder Copier Error", logx.Field("error", err))
+		return nil, err
+	}
+	return &order.OrderRes{
+		List:  list,
+		Total: total,
+	}, nil
+}
+
 func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes, error) {
+	return l.addOrder(req, "")
+}
+
+// addOrder trailId 不为空是跟踪止损单触发后下的市价单 跟踪止损单在同一个事务里改成已触发
+func (l *ExchangeOrderLogic) addOrder(req *order.OrderReq, trailId string) (*order.AddOrderRes, error) {
 	//添加订单 发布委托
 	//1.首先检查参数是否合法
 	memberRes, err := l.svcCtx.MemberRpc.FindMemberById(l.ctx, &member.MemberReq{
@@ -88,12 +115,73 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 	if memberRes.TransactionStatus == 0 {
 		return nil, errors.New("此用户已经被禁止交易")
 	}
+	//止损止盈单 按触发后的订单类型校验参数
+	stopType := model.TypeMap.Code(req.Type)
+	isTrigger := model.TriggerTarget(stopType) >= 0
+	if isTrigger {
+		if req.TriggerPrice <= 0 {
+			return nil, errors.New("触发价不能小于等于0")
+		}
+		req.Type = model.TypeMap[model.TriggerTarget(stopType)]
+	}
+	//跟踪止损单 触发后下市价单 按市价单校验参数
+	isTrail := stopType == model.TrailingStop
+	if isTrail {
+		if req.TrailAmount < 0 || req.TrailPercent < 0 || req.TrailPercent >= 100 {
+			return nil, errors.New("跟踪距离不正确")
+		}
+		if (req.TrailAmount > 0) == (req.TrailPercent > 0) {
+			return nil, errors.New("跟踪距离和跟踪百分比必须填一个")
+		}
+		req.Type = model.TypeMap[model.MarketPrice]
+	}
 	if req.Type == model.TypeMap[model.LimitPrice] && req.Price <= 0 {
 		return nil, errors.New("限价模式下价格不能小于等于0")
 	}
 	if req.Amount <= 0 {
 		return nil, errors.New("数量不能小于等于0")
 	}
+	//有效方式 不传默认GTC
+	if req.TimeInForce == "" {
+		req.TimeInForce = model.TimeInForceMap[model.GTC]
+	}
+	timeInForce := model.TimeInForceMap.Code(req.TimeInForce)
+	if timeInForce < 0 {
+		return nil, errors.New("不支持的有效方式:" + req.TimeInForce)
+	}
+	postOnly := model.PostOnlyOff
+	if req.PostOnly != "" {
+		postOnly = model.PostOnlyMap.Code(req.PostOnly)
+		if postOnly < 0 {
+			return nil, errors.New("不支持的post only方式:" + req.PostOnly)
+		}
+		if req.Type != model.TypeMap[model.LimitPrice] {
+			return nil, errors.New("post only只支持限价单")
+		}
+		if timeInForce == model.IOC || timeInForce == model.FOK {
+			return nil, errors.New("post only不能和IOC/FOK一起使用")
+		}
+	}
+	//冰山单 只显示一部分数量
+	if req.DisplayAmount != 0 {
+		if req.Type != model.TypeMap[model.LimitPrice] {
+			return nil, errors.New("冰山单只支持限价单")
+		}
+		if req.DisplayAmount < 0 || req.DisplayAmount >= req.Amount {
+			return nil, errors.New("显示数量必须大于0并且小于委托数量")
+		}
+		if timeInForce == model.IOC || timeInForce == model.FOK {
+			return nil, errors.New("冰山单不能和IOC/FOK一起使用")
+		}
+	}
+	if timeInForce == model.GTD {
+		if req.Type == model.TypeMap[model.MarketPrice] {
+			return nil, errors.New("市价单不支持GTD")
+		}
+		if req.ExpireTime <= time.Now().UnixMilli() {
+			return nil, errors.New("过期时间必须晚于当前时间")
+		}
+	}
 
 	exchangeCoin, err := l.svcCtx.MarketRpc.FindSymbolInfo(l.ctx, &market.MarketReq{
 		Symbol: req.Symbol,
@@ -132,6 +220,9 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 		if exchangeCoin.GetMinVolume() > 0 && exchangeCoin.GetMinVolume() > req.Amount {
 			return nil, errors.New("数量不能低于" + fmt.Sprintf("%f", exchangeCoin.GetMinVolume()))
 		}
+		if req.DisplayAmount > 0 && exchangeCoin.GetMinVolume() > req.DisplayAmount {
+			return nil, errors.New("显示数量不能低于" + fmt.Sprintf("%f", exchangeCoin.GetMinVolume()))
+		}
 	}
 
 	//查询用户钱包 BTC/USDT
@@ -170,6 +261,12 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 			return nil, errors.New("不支持市价出售")
 		}
 	}
+	//价格不能偏离最新成交价太多
+	if req.Type == model.TypeMap[model.LimitPrice] {
+		if err := l.checkPriceBand(exchangeCoin, req.Symbol, decimal.NewFromFloat(req.Price)); err != nil {
+			return nil, err
+		}
+	}
 	//限制委托数量
 	count, err := l.exchangeOrderDomain.FindCurrentTradingCount(l.ctx, req.UserId, req.Symbol, req.Direction)
 	if err != nil {
@@ -189,13 +286,29 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 	directionCode := model.DirectionMap.Code(req.Direction)
 	exchangeOrder.Direction = directionCode
 	if exchangeOrder.Type == model.MarketPrice {
-		exchangeOrder.Price = 0
+		exchangeOrder.Price = decimal.Zero
 
 	} else {
-		exchangeOrder.Price = req.Price
+		exchangeOrder.Price = decimal.NewFromFloat(req.Price)
+	}
+	exchangeOrder.UseDiscount = model.DiscountOf(req.UseDiscount)
+	applyFeeTier(exchangeOrder, memberRes)
+	exchangeOrder.Amount = decimal.NewFromFloat(req.Amount)
+	exchangeOrder.TimeInForce = timeInForce
+	exchangeOrder.PostOnly = postOnly
+	if timeInForce == model.GTD {
+		exchangeOrder.ExpireTime = req.ExpireTime
+	}
+	exchangeOrder.DisplayAmount = decimal.NewFromFloat(req.DisplayAmount)
+	if isTrail {
+		return l.addTrailOrder(exchangeOrder, req)
+	}
+	if isTrigger {
+		exchangeOrder.Type = stopType
+		exchangeOrder.TriggerPrice = decimal.NewFromFloat(req.TriggerPrice)
+		exchangeOrder.TriggerCondition = l.svcCtx.TriggerBook.Condition(l.ctx, exchangeOrder)
+		return l.addTriggerOrder(exchangeOrder)
 	}
-	exchangeOrder.UseDiscount = "0"
-	exchangeOrder.Amount = req.Amount
 	//保存订单到数据库，发送消息到kafka，ucenter 钱包服务 接收到消息 进行资金的冻结
 	//AddOrder 保存订单 计算所需要的钱
 	err = l.transaction.Action(func(conn msdb.DbConn) error {
@@ -203,8 +316,8 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 		if err != nil {
 			return errors.New("订单提交失败")
 		}
-		// 发送消息到kafka
-		err = l.kafkaDomain.SendOrder("add-exchange-order",
+		// 消息和订单一起提交 提交以后再发到kafka
+		err = l.kafkaDomain.SaveOrder(l.ctx, conn, "add-exchange-order",
 			req.UserId,
 			exchangeOrder.OrderId,
 			money,
@@ -213,18 +326,261 @@ func (l *ExchangeOrderLogic) AddOrder(req *order.OrderReq) (*order.AddOrderRes,
 			baseSymbol,
 			coinSymbol)
 		if err != nil {
-			return errors.New("发消息失败")
+			return errors.New("订单提交失败")
+		}
+		if trailId == "" {
+			return nil
+		}
+		ok, err := l.exchangeOrderDomain.TrailTriggered(l.ctx, conn, trailId)
+		if err != nil {
+			return errors.New("订单提交失败")
+		}
+		if !ok {
+			return processor.ErrTrailCanceled
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order.AddOrderRes{
+		OrderId: exchangeOrder.OrderId,
+	}, nil
+}
+
+// AddOco 一次提交一组OCO订单 止盈限价单和止损单 只冻结一份资金
+// 止盈单按普通限价单冻结 止损单等待触发 触发后撮合引擎撤掉止盈单 剩下的数量和资金转给止损单
+// 止盈单先成交 同组还没触发的止损单撤掉
+func (l *ExchangeOrderLogic) AddOco(req *order.OrderReq) (*order.AddOcoRes, error) {
+	memberRes, err := l.svcCtx.MemberRpc.FindMemberById(l.ctx, &member.MemberReq{
+		MemberId: req.UserId,
+	})
+	if err != nil {
+		logx.Errorw("MemberRpc-FindMemberById-ERROR", logx.Field("err", err))
+		return nil, err
+	}
+	if memberRes.TransactionStatus == 0 {
+		return nil, errors.New("此用户已经被禁止交易")
+	}
+	if req.Price <= 0 {
+		return nil, errors.New("止盈价不能小于等于0")
+	}
+	if req.TriggerPrice <= 0 {
+		return nil, errors.New("触发价不能小于等于0")
+	}
+	if req.StopPrice < 0 {
+		return nil, errors.New("止损价不能小于0")
+	}
+	if req.Amount <= 0 {
+		return nil, errors.New("数量不能小于等于0")
+	}
+	directionCode := model.DirectionMap.Code(req.Direction)
+	if directionCode < 0 {
+		return nil, errors.New("参数传递错误")
+	}
+	//卖出 止盈在上面 止损在下面 买入反过来
+	if directionCode == model.SELL && req.TriggerPrice >= req.Price {
+		return nil, errors.New("止损触发价必须低于止盈价")
+	}
+	if directionCode == model.BUY && req.TriggerPrice <= req.Price {
+		return nil, errors.New("止损触发价必须高于止盈价")
+	}
+	//止损价不填 触发后下市价单
+	stopType := model.StopLimit
+	if req.StopPrice == 0 {
+		stopType = model.StopMarket
+	}
+
+	exchangeCoin, err := l.svcCtx.MarketRpc.FindSymbolInfo(l.ctx, &market.MarketReq{
+		Symbol: req.Symbol,
+	})
+	if err != nil {
+		logx.Errorw("MarketRpc-FindSymbolInfo-ERROR", logx.Field("err", err))
+		return nil, errors.New("nonsupport coin")
+	}
+	if exchangeCoin.Exchangeable != 1 && exchangeCoin.Enable != 1 {
+		return nil, errors.New("coin forbidden")
+	}
+	baseSymbol := exchangeCoin.GetBaseSymbol()
+	coinSymbol := exchangeCoin.GetCoinSymbol()
+	if exchangeCoin.GetMaxVolume() > 0 && exchangeCoin.GetMaxVolume() < req.Amount {
+		return nil, errors.New("数量超出" + fmt.Sprintf("%f", exchangeCoin.GetMaxVolume()))
+	}
+	if exchangeCoin.GetMinVolume() > 0 && exchangeCoin.GetMinVolume() > req.Amount {
+		return nil, errors.New("数量不能低于" + fmt.Sprintf("%f", exchangeCoin.GetMinVolume()))
+	}
+	if directionCode == model.SELL && exchangeCoin.GetMinSellPrice() > 0 {
+		if req.Price < exchangeCoin.GetMinSellPrice() || (stopType == model.StopLimit && req.StopPrice < exchangeCoin.GetMinSellPrice()) {
+			return nil, errors.New("不能低于最低限价:" + fmt.Sprintf("%f", exchangeCoin.GetMinSellPrice()))
+		}
+	}
+	if directionCode == model.BUY && exchangeCoin.GetMaxBuyPrice() > 0 {
+		if req.Price > exchangeCoin.GetMaxBuyPrice() || (stopType == model.StopLimit && req.StopPrice > exchangeCoin.GetMaxBuyPrice()) {
+			return nil, errors.New("不能高于最高限价:" + fmt.Sprintf("%f", exchangeCoin.GetMaxBuyPrice()))
+		}
+	}
+	if err := l.checkPriceBand(exchangeCoin, req.Symbol, decimal.NewFromFloat(req.Price)); err != nil {
+		return nil, err
+	}
+	if stopType == model.StopMarket {
+		if directionCode == model.BUY && exchangeCoin.EnableMarketBuy == 0 {
+			return nil, errors.New("不支持市价购买")
+		} else if directionCode == model.SELL && exchangeCoin.EnableMarketSell == 0 {
+			return nil, errors.New("不支持市价出售")
+		}
+	}
+	baseWallet, err := l.svcCtx.AssetRpc.FindWalletBySymbol(l.ctx, &asset.AssetReq{
+		UserId:   req.UserId,
+		CoinName: baseSymbol,
+	})
+	if err != nil {
+		return nil, errors.New("no wallet")
+	}
+	exCoinWallet, err := l.svcCtx.AssetRpc.FindWalletBySymbol(l.ctx, &asset.AssetReq{
+		UserId:   req.UserId,
+		CoinName: coinSymbol,
+	})
+	if err != nil {
+		return nil, errors.New("no wallet")
+	}
+	if baseWallet.IsLock == 1 || exCoinWallet.IsLock == 1 {
+		return nil, errors.New("wallet locked")
+	}
+	count, err := l.exchangeOrderDomain.FindCurrentTradingCount(l.ctx, req.UserId, req.Symbol, req.Direction)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeCoin.GetMaxTradingOrder() > 0 && count >= exchangeCoin.GetMaxTradingOrder() {
+		return nil, errors.New("超过最大挂单数量 " + fmt.Sprintf("%d", exchangeCoin.GetMaxTradingOrder()))
+	}
+	linkId := tools.Unq("L")
+	// 止盈限价单
+	limitOrder := model.NewOrder()
+	limitOrder.MemberId = req.UserId
+	limitOrder.Symbol = req.Symbol
+	limitOrder.BaseSymbol = baseSymbol
+	limitOrder.CoinSymbol = coinSymbol
+	limitOrder.Type = model.LimitPrice
+	limitOrder.Direction = directionCode
+	limitOrder.Price = decimal.NewFromFloat(req.Price)
+	limitOrder.Amount = decimal.NewFromFloat(req.Amount)
+	limitOrder.UseDiscount = model.DiscountOf(req.UseDiscount)
+	applyFeeTier(limitOrder, memberRes)
+	limitOrder.TimeInForce = model.GTC
+	limitOrder.LinkId = linkId
+	if directionCode == model.BUY && stopType == model.StopLimit && req.StopPrice > req.Price {
+		// 买入按两条腿里高的价格冻结 止损单触发后接过去的资金才够
+		limitOrder.OriginalPrice = decimal.NewFromFloat(req.StopPrice)
+	}
+	// 止损单 数量在触发后由撮合引擎换成止盈单剩下的部分 市价买换成剩下的金额
+	stopOrder := model.NewOrder()
+	stopOrder.MemberId = req.UserId
+	stopOrder.Symbol = req.Symbol
+	stopOrder.BaseSymbol = baseSymbol
+	stopOrder.CoinSymbol = coinSymbol
+	stopOrder.Type = stopType
+	stopOrder.Direction = directionCode
+	stopOrder.Price = decimal.NewFromFloat(req.StopPrice)
+	stopOrder.Amount = limitOrder.Amount
+	stopOrder.UseDiscount = limitOrder.UseDiscount
+	applyFeeTier(stopOrder, memberRes)
+	stopOrder.TimeInForce = model.GTC
+	stopOrder.TriggerPrice = decimal.NewFromFloat(req.TriggerPrice)
+	stopOrder.TriggerCondition = model.TriggerAbove
+	if directionCode == model.SELL {
+		stopOrder.TriggerCondition = model.TriggerBelow
+	}
+	stopOrder.LinkId = linkId
+	// 两条订单一起保存 只为止盈单冻结资金
+	err = l.transaction.Action(func(conn msdb.DbConn) error {
+		money, err := l.exchangeOrderDomain.AddOrder(l.ctx, conn, limitOrder, exchangeCoin, baseWallet, exCoinWallet)
+		if err != nil {
+			return errors.New("订单提交失败")
+		}
+		err = l.exchangeOrderDomain.AddTriggerOrder(l.ctx, conn, stopOrder)
+		if err != nil {
+			return errors.New("订单提交失败")
+		}
+		err = l.kafkaDomain.SaveOrder(l.ctx, conn, "add-exchange-order",
+			req.UserId,
+			limitOrder.OrderId,
+			money,
+			req.Symbol,
+			limitOrder.Direction,
+			baseSymbol,
+			coinSymbol)
+		if err != nil {
+			return errors.New("订单提交失败")
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	l.svcCtx.TriggerBook.Add(stopOrder)
+	return &order.AddOcoRes{
+		LinkId:      linkId,
+		OrderId:     limitOrder.OrderId,
+		StopOrderId: stopOrder.OrderId,
+	}, nil
+}
+
+// addTrailOrder 跟踪止损单 水位线从最新成交价开始
+func (l *ExchangeOrderLogic) addTrailOrder(exchangeOrder *model.ExchangeOrder, req *order.OrderReq) (*order.AddOrderRes, error) {
+	last, ok := l.svcCtx.TriggerBook.LastPrice(l.ctx, exchangeOrder.Symbol)
+	if !ok {
+		return nil, errors.New("还没有成交价 不能下跟踪止损单")
+	}
+	exchangeOrder.Type = model.TrailingStop
+	exchangeOrder.TrailAmount = decimal.NewFromFloat(req.TrailAmount)
+	exchangeOrder.TrailPercent = decimal.NewFromFloat(req.TrailPercent)
+	exchangeOrder.TrailMark = last
+	exchangeOrder.TriggerPrice = exchangeOrder.TrailTrigger()
+	if exchangeOrder.TriggerPrice.Sign() <= 0 {
+		return nil, errors.New("跟踪距离不能超过最新成交价")
+	}
+	exchangeOrder.TriggerCondition = model.TriggerAbove
+	if exchangeOrder.Direction == model.SELL {
+		exchangeOrder.TriggerCondition = model.TriggerBelow
+	}
+	return l.addTriggerOrder(exchangeOrder)
+}
+
+// addTriggerOrder 止损止盈单只保存 触发之后再冻结资金进入撮合
+func (l *ExchangeOrderLogic) addTriggerOrder(exchangeOrder *model.ExchangeOrder) (*order.AddOrderRes, error) {
+	err := l.transaction.Action(func(conn msdb.DbConn) error {
+		return l.exchangeOrderDomain.AddTriggerOrder(l.ctx, conn, exchangeOrder)
+	})
+	if err != nil {
+		logx.Errorw("Logic-AddTriggerOrder", logx.Field("error", err))
+		return nil, errors.New("订单提交失败")
+	}
+	l.svcCtx.TriggerBook.Add(exchangeOrder)
 	return &order.AddOrderRes{
 		OrderId: exchangeOrder.OrderId,
 	}, nil
 }
 
+// NewTrailSubmit 跟踪止损单触发后 按普通市价单走一遍下单流程 同方向同数量 平台币抵扣也跟着跟踪止损单
+func NewTrailSubmit(svcCtx *svc.ServiceContext) processor.TrailSubmit {
+	return func(trail *model.ExchangeOrder) (string, error) {
+		l := NewExchangeOrderLogic(context.Background(), svcCtx)
+		res, err := l.addOrder(&order.OrderReq{
+			Symbol:      trail.Symbol,
+			UserId:      trail.MemberId,
+			Direction:   model.DirectionMap.Value(trail.Direction),
+			Type:        model.TypeMap[model.MarketPrice],
+			Amount:      trail.Amount.Float64(),
+			TimeInForce: model.TimeInForceMap.Value(trail.TimeInForce),
+			UseDiscount: trail.UseDiscount,
+		}, trail.OrderId)
+		if err != nil {
+			return "", err
+		}
+		return res.OrderId, nil
+	}
+}
+
 func (l *ExchangeOrderLogic) FindByOrderId(req *order.OrderReq) (*order.ExchangeOrderOrigin, error) {
 	orderResp, err := l.exchangeOrderDomain.FindByOrderId(l.ctx, req.OrderId)
 	if err != nil {
@@ -237,12 +593,223 @@ func (l *ExchangeOrderLogic) FindByOrderId(req *order.OrderReq) (*order.Exchange
 		logx.Errorw("Logic-FindByOrderId-Copier Error", logx.Field("error", err))
 		return nil, err
 	}
+	resp.Amount = orderResp.Amount.Float64()
+	resp.Price = orderResp.Price.Float64()
+	resp.TradedAmount = orderResp.TradedAmount.Float64()
+	resp.Turnover = orderResp.Turnover.Float64()
+	resp.TriggerPrice = orderResp.TriggerPrice.Float64()
+	resp.DisplayAmount = orderResp.DisplayAmount.Float64()
+	resp.TrailAmount = orderResp.TrailAmount.Float64()
+	resp.TrailPercent = orderResp.TrailPercent.Float64()
 	return resp, nil
 
 }
 
 func (l *ExchangeOrderLogic) CancelOrder(req *order.OrderReq) (*order.CancelOrderRes, error) {
-	l.exchangeOrderDomain.UpdateStatusCancel(l.ctx, req.OrderId)
-	return nil, nil
+	exchangeOrder, err := l.exchangeOrderDomain.FindByOrderId(l.ctx, req.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	// 用户撤单会带上userId ucenter冻结失败的撤单没有
+	if req.UserId > 0 && exchangeOrder.MemberId != req.UserId {
+		return nil, errors.New("无权撤销该订单")
+	}
+	switch exchangeOrder.Status {
+	case model.Waiting:
+		// 止损止盈单还没触发 没有冻结资金 改状态后从触发簿拿掉
+		var ok bool
+		ok, err = l.exchangeOrderDomain.CancelTrigger(l.ctx, req.OrderId)
+		if err == nil && !ok {
+			return nil, errors.New("订单已触发 请重新撤单")
+		}
+		if err == nil {
+			l.svcCtx.TriggerBook.Remove(exchangeOrder.Symbol, exchangeOrder.OrderId)
+		}
+	case model.Init:
+		// 还没进入撮合 直接改状态 钱包可能正在冻结 冻结结果回来时看到已撤销会通知解冻
+		var ok bool
+		ok, err = l.exchangeOrderDomain.UpdateStatusCancel(l.ctx, req.OrderId)
+		if err == nil && !ok {
+			// 刚好冻结完进入撮合了 交给撮合引擎撤单
+			err = l.kafkaDomain.SendCancelOrder(exchangeOrder)
+		}
+	case model.Trading:
+		// 撮合中的订单 要由撮合引擎从盘口撤掉 再通知钱包解冻
+		err = l.kafkaDomain.SendCancelOrder(exchangeOrder)
+	default:
+		return nil, errors.New("订单已完成或已撤销")
+	}
+	if err != nil {
+		logx.Errorw("Logic-CancelOrder", logx.Field("error", err))
+		return nil, errors.New("撤单失败")
+	}
+	if exchangeOrder.LinkId != "" {
+		l.cancelLinked(exchangeOrder)
+	}
+	return &order.CancelOrderRes{OrderId: req.OrderId}, nil
+
+}
+
+// AmendOrder 改单 只改撮合中的普通限价单的价格和数量 不用撤单重下
+// 要多冻结的资金先发给钱包冻结 钱包冻结好再交给撮合引擎 不用多冻结的直接交给撮合引擎
+// 撮合引擎改完以后按实际的差额通知钱包解冻
+func (l *ExchangeOrderLogic) AmendOrder(req *order.OrderReq) (*order.AmendOrderRes, error) {
+	exchangeOrder, err := l.exchangeOrderDomain.FindByOrderId(l.ctx, req.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeOrder.MemberId != req.UserId {
+		return nil, errors.New("无权修改该订单")
+	}
+	if exchangeOrder.Status != model.Trading {
+		return nil, errors.New("订单不在撮合中")
+	}
+	if exchangeOrder.Type != model.LimitPrice || exchangeOrder.LinkId != "" {
+		return nil, errors.New("只能修改普通限价单")
+	}
+	if req.Price < 0 || req.Amount < 0 || (req.Price == 0 && req.Amount == 0) {
+		return nil, errors.New("参数传递错误")
+	}
+	price := exchangeOrder.Price
+	if req.Price > 0 {
+		price = decimal.NewFromFloat(req.Price)
+	}
+	amount := exchangeOrder.Amount
+	if req.Amount > 0 {
+		amount = decimal.NewFromFloat(req.Amount)
+	}
+	if amount.LessThanOrEqual(exchangeOrder.TradedAmount) {
+		return nil, errors.New("数量不能低于已成交数量")
+	}
+	exchangeCoin, err := l.svcCtx.MarketRpc.FindSymbolInfo(l.ctx, &market.MarketReq{
+		Symbol: exchangeOrder.Symbol,
+	})
+	if err != nil {
+		logx.Errorw("MarketRpc-FindSymbolInfo-ERROR", logx.Field("err", err))
+		return nil, errors.New("nonsupport coin")
+	}
+	if exchangeCoin.GetMaxVolume() > 0 && decimal.NewFromFloat(exchangeCoin.GetMaxVolume()).LessThan(amount) {
+		return nil, errors.New("数量超出" + fmt.Sprintf("%f", exchangeCoin.GetMaxVolume()))
+	}
+	if exchangeCoin.GetMinVolume() > 0 && decimal.NewFromFloat(exchangeCoin.GetMinVolume()).GreaterThan(amount) {
+		return nil, errors.New("数量不能低于" + fmt.Sprintf("%f", exchangeCoin.GetMinVolume()))
+	}
+	if exchangeOrder.Direction == model.SELL && exchangeCoin.GetMinSellPrice() > 0 && decimal.NewFromFloat(exchangeCoin.GetMinSellPrice()).GreaterThan(price) {
+		return nil, errors.New("不能低于最低限价:" + fmt.Sprintf("%f", exchangeCoin.GetMinSellPrice()))
+	}
+	if exchangeOrder.Direction == model.BUY && exchangeCoin.GetMaxBuyPrice() > 0 && decimal.NewFromFloat(exchangeCoin.GetMaxBuyPrice()).LessThan(price) {
+		return nil, errors.New("不能高于最高限价:" + fmt.Sprintf("%f", exchangeCoin.GetMaxBuyPrice()))
+	}
+	if req.Price > 0 {
+		if err := l.checkPriceBand(exchangeCoin, exchangeOrder.Symbol, price); err != nil {
+			return nil, err
+		}
+	}
+	amend := &model.ExchangeOrderAmend{
+		AmendId:    tools.Unq("A"),
+		OrderId:    exchangeOrder.OrderId,
+		Symbol:     exchangeOrder.Symbol,
+		MemberId:   exchangeOrder.MemberId,
+		Direction:  exchangeOrder.Direction,
+		BaseSymbol: exchangeOrder.BaseSymbol,
+		CoinSymbol: exchangeOrder.CoinSymbol,
+		Price:      price,
+		Amount:     amount,
+		Hold:       decimal.Zero,
+	}
+	// 按数据库里的成交算要多冻结多少 撮合引擎里成交的更多时会按实际的再算一次
+	delta := exchangeOrder.AmendFrozen(price, amount).Sub(exchangeOrder.FreezeMoney())
+	topic := "exchange_order_amend"
+	if delta.Sign() > 0 {
+		amend.Hold = delta
+		topic = "exchange_order_amend_freeze"
+	}
+	err = l.kafkaDomain.SendAmendOrder(topic, amend)
+	if err != nil {
+		logx.Errorw("Logic-AmendOrder", logx.Field("error", err))
+		return nil, errors.New("改单失败")
+	}
+	return &order.AmendOrderRes{OrderId: exchangeOrder.OrderId}, nil
+}
+
+// checkPriceBand 限价单的价格不能偏离最新成交价超过交易对配置的百分比 还没有成交过的不限制
+func (l *ExchangeOrderLogic) checkPriceBand(coin *market.ExchangeCoin, symbol string, price decimal.Decimal) error {
+	if coin.GetPriceBand() <= 0 {
+		return nil
+	}
+	last, ok := l.svcCtx.TriggerBook.LastPrice(l.ctx, symbol)
+	if !ok {
+		return nil
+	}
+	offset := last.Mul(decimal.NewFromFloat(coin.GetPriceBand())).Div(decimal.NewFromInt(100), 8, decimal.RoundDown)
+	if price.GreaterThan(last.Add(offset)) || price.LessThan(last.Sub(offset)) {
+		return errors.New("价格偏离最新成交价超过" + fmt.Sprintf("%f", coin.GetPriceBand()) + "%")
+	}
+	return nil
+}
+
+// cancelLinked OCO订单撤掉一条 同组的另一条也撤掉
+// 另一条撤不掉的只记日志 不影响这一条的撤单结果
+func (l *ExchangeOrderLogic) cancelLinked(exchangeOrder *model.ExchangeOrder) {
+	list, err := l.exchangeOrderDomain.FindLinkedOrders(l.ctx, exchangeOrder.LinkId)
+	if err != nil {
+		logx.Errorw("Logic-CancelLinked", logx.Field("error", err))
+		return
+	}
+	for _, v := range list {
+		if v.OrderId == exchangeOrder.OrderId {
+			continue
+		}
+		switch v.Status {
+		case model.Waiting:
+			var ok bool
+			ok, err = l.exchangeOrderDomain.CancelTrigger(l.ctx, v.OrderId)
+			if err == nil && ok {
+				l.svcCtx.TriggerBook.Remove(v.Symbol, v.OrderId)
+			} else if err == nil {
+				// 刚好触发了 已经去撮合引擎了
+				err = l.kafkaDomain.SendCancelOrder(v)
+			}
+		case model.Init:
+			var ok bool
+			ok, err = l.exchangeOrderDomain.UpdateStatusCancel(l.ctx, v.OrderId)
+			if err == nil && !ok {
+				err = l.kafkaDomain.SendCancelOrder(v)
+			}
+		case model.Trading:
+			err = l.kafkaDomain.SendCancelOrder(v)
+		default:
+			continue
+		}
+		if err != nil {
+			logx.Errorw("Logic-CancelLinked", logx.Field("orderId", v.OrderId), logx.Field("error", err))
+		}
+	}
+}
+
+// applyFeeTier 会员当前手续费等级的费率记到订单上 撮合时按订单上的费率收 没有等级的按交易对的
+func applyFeeTier(exchangeOrder *model.ExchangeOrder, memberRes *member.MemberInfo) {
+	if memberRes.FeeTier <= 0 {
+		return
+	}
+	exchangeOrder.FeeTier = memberRes.FeeTier
+	exchangeOrder.MakerFee = decimal.NewFromFloat(memberRes.MakerFee)
+	exchangeOrder.TakerFee = decimal.NewFromFloat(memberRes.TakerFee)
+}
 
+// FindMemberVolume 每个会员在每个交易对上的成交额 jobcenter按它计算手续费等级
+func (l *ExchangeOrderLogic) FindMemberVolume(req *order.VolumeReq) (*order.VolumeRes, error) {
+	list, err := domain.NewExchangeTradeDomain(l.svcCtx.Db).FindMemberTurnover(l.ctx, req.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	resp := &order.VolumeRes{List: make([]*order.MemberVolume, len(list))}
+	for i, v := range list {
+		resp.List[i] = &order.MemberVolume{
+			MemberId: v.MemberId,
+			Symbol:   v.Symbol,
+			Turnover: v.Turnover.Float64(),
+		}
+	}
+	return resp, nil
 }
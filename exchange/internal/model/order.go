@@ -2,27 +2,45 @@ package model
 
 import (
 	"github.com/jinzhu/copier"
+	"mscoin-common/decimal"
 	"mscoin-common/enum"
 )
 
 type ExchangeOrder struct {
-	Id            int64   `gorm:"column:id" json:"id"`
-	OrderId       string  `gorm:"column:order_id" json:"orderId"`
-	Amount        float64 `gorm:"column:amount" json:"amount"`
-	BaseSymbol    string  `gorm:"column:base_symbol" json:"baseSymbol"`
-	CanceledTime  int64   `gorm:"column:canceled_time" json:"canceledTime"`
-	CoinSymbol    string  `gorm:"column:coin_symbol" json:"coinSymbol"`
-	CompletedTime int64   `gorm:"column:completed_time" json:"completedTime"`
-	Direction     int     `gorm:"column:direction" json:"direction"`
-	MemberId      int64   `gorm:"column:member_id" json:"memberId"`
-	Price         float64 `gorm:"column:price" json:"price"`
-	Status        int     `gorm:"column:status" json:"status"`
-	Symbol        string  `gorm:"column:symbol" json:"symbol"`
-	Time          int64   `gorm:"column:time" json:"time"`
-	TradedAmount  float64 `gorm:"column:traded_amount" json:"tradedAmount"`
-	Turnover      float64 `gorm:"column:turnover" json:"turnover"`
-	Type          int     `gorm:"column:type" json:"type"`
-	UseDiscount   string  `gorm:"column:use_discount" json:"useDiscount"`
+	Id               int64           `gorm:"column:id" json:"id"`
+	OrderId          string          `gorm:"column:order_id" json:"orderId"`
+	Amount           decimal.Decimal `gorm:"column:amount" json:"amount"`
+	BaseSymbol       string          `gorm:"column:base_symbol" json:"baseSymbol"`
+	CanceledTime     int64           `gorm:"column:canceled_time" json:"canceledTime"`
+	CoinSymbol       string          `gorm:"column:coin_symbol" json:"coinSymbol"`
+	CompletedTime    int64           `gorm:"column:completed_time" json:"completedTime"`
+	Direction        int             `gorm:"column:direction" json:"direction"`
+	MemberId         int64           `gorm:"column:member_id" json:"memberId"`
+	Price            decimal.Decimal `gorm:"column:price" json:"price"`
+	Status           int             `gorm:"column:status" json:"status"`
+	Symbol           string          `gorm:"column:symbol" json:"symbol"`
+	Time             int64           `gorm:"column:time" json:"time"`
+	TradedAmount     decimal.Decimal `gorm:"column:traded_amount" json:"tradedAmount"`
+	Turnover         decimal.Decimal `gorm:"column:turnover" json:"turnover"`
+	Type             int             `gorm:"column:type" json:"type"`
+	UseDiscount      string          `gorm:"column:use_discount" json:"useDiscount"`
+	TimeInForce      int             `gorm:"column:time_in_force" json:"timeInForce"`
+	ExpireTime       int64           `gorm:"column:expire_time" json:"expireTime"` // GTD订单的过期时间 毫秒
+	PostOnly         int             `gorm:"column:post_only" json:"postOnly"`
+	OriginalPrice    decimal.Decimal `gorm:"column:original_price" json:"originalPrice"`       // 冻结资金用的价格 post only改价前的价格或者OCO两条腿里高的价格 为0按price
+	TriggerPrice     decimal.Decimal `gorm:"column:trigger_price" json:"triggerPrice"`         // 止损止盈单的触发价
+	TriggerCondition int             `gorm:"column:trigger_condition" json:"triggerCondition"` // 触发方向 TriggerAbove TriggerBelow
+	DisplayAmount    decimal.Decimal `gorm:"column:display_amount" json:"displayAmount"`       // 冰山单每次显示的数量 0不是冰山单
+	VisibleAmount    decimal.Decimal `gorm:"-" json:"visibleAmount"`                           // 冰山单当前显示的部分还剩多少 只在撮合引擎中使用
+	TrailAmount      decimal.Decimal `gorm:"column:trail_amount" json:"trailAmount"`           // 跟踪止损单 触发价和水位线的固定距离
+	TrailPercent     decimal.Decimal `gorm:"column:trail_percent" json:"trailPercent"`         // 跟踪止损单 触发价和水位线的百分比距离 1表示1%
+	TrailMark        decimal.Decimal `gorm:"column:trail_mark" json:"trailMark"`               // 跟踪止损单的水位线 卖单是最高成交价 买单是最低成交价
+	LinkId           string          `gorm:"column:link_id" json:"linkId"`                     // OCO订单 同一组的止盈限价单和止损单一样
+	Frozen           decimal.Decimal `gorm:"column:frozen" json:"frozen"`                      // 限价买单改单后冻结的资金 为0按FrozenPrice*Amount算
+	Fee              decimal.Decimal `gorm:"column:fee" json:"fee"`                            // 累计手续费 买单是币 卖单是钱 从收到的资产里扣
+	FeeTier          int64           `gorm:"column:fee_tier" json:"feeTier"`                   // 下单时会员的手续费等级 0按交易对的费率
+	MakerFee         decimal.Decimal `gorm:"column:maker_fee" json:"makerFee"`                 // 手续费等级的挂单费率
+	TakerFee         decimal.Decimal `gorm:"column:taker_fee" json:"takerFee"`                 // 手续费等级的吃单费率
 }
 
 func (*ExchangeOrder) TableName() string {
@@ -36,6 +54,8 @@ const (
 	Canceled
 	OverTimed
 	Init
+	Waiting   // 止损止盈单等待触发 还没有冻结资金
+	Triggered // 跟踪止损单已经触发 另外下了一笔市价单
 )
 
 var StatusMap = enum.Enum{
@@ -43,6 +63,8 @@ var StatusMap = enum.Enum{
 	Completed: "COMPLETED",
 	Canceled:  "CANCELED",
 	OverTimed: "OVERTIMED",
+	Waiting:   "WAITING",
+	Triggered: "TRIGGERED",
 }
 
 // direction
@@ -60,41 +82,309 @@ var DirectionMap = enum.Enum{
 const (
 	MarketPrice = iota
 	LimitPrice
+	StopMarket   // 触发后变成市价单
+	StopLimit    // 触发后变成限价单
+	TrailingStop // 跟踪止损 触发后另外下一笔市价单
 )
 
 var TypeMap = enum.Enum{
-	MarketPrice: "MARKET_PRICE",
-	LimitPrice:  "LIMIT_PRICE",
+	MarketPrice:  "MARKET_PRICE",
+	LimitPrice:   "LIMIT_PRICE",
+	StopMarket:   "STOP_MARKET",
+	StopLimit:    "STOP_LIMIT",
+	TrailingStop: "TRAILING_STOP",
+}
+
+// TriggerTarget 止损止盈单触发后的订单类型 不是止损止盈单返回-1
+func TriggerTarget(typ int) int {
+	switch typ {
+	case StopMarket:
+		return MarketPrice
+	case StopLimit:
+		return LimitPrice
+	}
+	return -1
+}
+
+// trigger condition 最新成交价从哪个方向碰到触发价
+const (
+	TriggerNone  = iota
+	TriggerAbove // 涨到触发价及以上
+	TriggerBelow // 跌到触发价及以下
+)
+
+var TriggerConditionMap = enum.Enum{
+	TriggerAbove: "ABOVE",
+	TriggerBelow: "BELOW",
+}
+
+// time in force 订单在盘口上的有效方式
+const (
+	GTC = iota // 一直有效 直到成交或者撤单
+	IOC        // 立即成交 剩下的部分撤掉
+	FOK        // 全部成交 否则整单撤掉 不碰盘口
+	GTD        // 有效到 ExpireTime 过期撤掉
+)
+
+var TimeInForceMap = enum.Enum{
+	GTC: "GTC",
+	IOC: "IOC",
+	FOK: "FOK",
+	GTD: "GTD",
+}
+
+// 手续费是否用平台币抵扣
+const (
+	DiscountOff = "0"
+	DiscountOn  = "1" // 结算时用平台币抵扣手续费 平台币余额不够按正常收
+)
+
+// DiscountOf 前端传的是否抵扣 不是 DiscountOn 的都不抵扣
+func DiscountOf(v string) string {
+	if v == DiscountOn {
+		return DiscountOn
+	}
+	return DiscountOff
+}
+
+// post only 只做maker 进入撮合时会立即成交的处理方式
+const (
+	PostOnlyOff     = iota
+	PostOnlyReject  // 拒绝
+	PostOnlyReprice // 改成对手价让开一个最小价位 再挂到盘口上
+)
+
+var PostOnlyMap = enum.Enum{
+	PostOnlyReject:  "REJECT",
+	PostOnlyReprice: "REPRICE",
+}
+
+// 撮合引擎撤单原因
+const (
+	CancelByUser    = "USER"      // 用户撤单
+	CancelIOC       = "IOC"       // IOC没有成交的部分
+	CancelFOK       = "FOK"       // FOK不能全部成交
+	CancelExpired   = "EXPIRED"   // GTD过期
+	CancelPostOnly  = "POST_ONLY" // post only订单会立即成交
+	CancelOCO       = "OCO"       // OCO同组的另一条订单成交或者触发了
+	CancelSTP       = "STP"       // 自成交保护撤掉
+	CancelSweep     = "SWEEP"     // 市价单吃到了离第一档太远的价格 剩下的撤掉
+	CancelAuction   = "AUCTION"   // 集合竞价期间只收普通限价单
+	CancelOverTimed = "OVERTIMED" // 超过交易对的委托超时时间 自动下架
+)
+
+// 自成交保护模式 同一个用户的买卖单撮合到一起时的处理方式 按交易对配置
+const (
+	StpCancelNewest = iota // 撤掉新进来的订单 盘口上的不动
+	StpCancelOldest        // 撤掉盘口上的订单 新订单继续撮合
+	StpCancelBoth          // 两边都撤掉
+	StpDecrement           // 数量多的一边减掉少的一边的数量 少的一边撤掉 有市价买单的按撤掉新订单处理
+)
+
+var StpModeMap = enum.Enum{
+	StpCancelNewest: "CANCEL_NEWEST",
+	StpCancelOldest: "CANCEL_OLDEST",
+	StpCancelBoth:   "CANCEL_BOTH",
+	StpDecrement:    "DECREMENT",
+}
+
+// 撮合引擎拒绝改单的原因
+const (
+	AmendNotFound = "NOT_FOUND" // 订单不在盘口上 已经成交完或者撤掉了
+	AmendAmount   = "AMOUNT"    // 新数量不大于已经成交的数量
+	AmendFunds    = "FUNDS"     // 改单期间有成交 预先冻结的资金不够
+	AmendPostOnly = "POST_ONLY" // post only订单改价以后会立即成交
+	AmendAuction  = "AUCTION"   // 集合竞价期间不能改单
+)
+
+// SymbolHalt 交易对熔断通知 价格在窗口内波动太大暂停撮合 冷却时间过了恢复
+type SymbolHalt struct {
+	Symbol string          `json:"symbol"`
+	Halted bool            `json:"halted"` // true暂停 false恢复
+	Until  int64           `json:"until"`  // 暂停到什么时候 毫秒
+	Low    decimal.Decimal `json:"low"`    // 窗口内的最低成交价
+	High   decimal.Decimal `json:"high"`   // 窗口内的最高成交价
 }
 
 type ExchangeOrderVo struct {
-	OrderId       string  `gorm:"column:order_id"`
-	Amount        float64 `gorm:"column:amount"`
-	BaseSymbol    string  `gorm:"column:base_symbol"`
-	CanceledTime  int64   `gorm:"column:canceled_time"`
-	CoinSymbol    string  `gorm:"column:coin_symbol"`
-	CompletedTime int64   `gorm:"column:completed_time"`
-	Direction     string  `gorm:"column:direction"`
-	MemberId      int64   `gorm:"column:member_id"`
-	Price         float64 `gorm:"column:price"`
-	Status        string  `gorm:"column:status"`
-	Symbol        string  `gorm:"column:symbol"`
-	Time          int64   `gorm:"column:time"`
-	TradedAmount  float64 `gorm:"column:traded_amount"`
-	Turnover      float64 `gorm:"column:turnover"`
-	Type          string  `gorm:"column:type"`
-	UseDiscount   string  `gorm:"column:use_discount"`
+	OrderId          string  `gorm:"column:order_id"`
+	Amount           float64 `gorm:"column:amount"`
+	BaseSymbol       string  `gorm:"column:base_symbol"`
+	CanceledTime     int64   `gorm:"column:canceled_time"`
+	CoinSymbol       string  `gorm:"column:coin_symbol"`
+	CompletedTime    int64   `gorm:"column:completed_time"`
+	Direction        string  `gorm:"column:direction"`
+	MemberId         int64   `gorm:"column:member_id"`
+	Price            float64 `gorm:"column:price"`
+	Status           string  `gorm:"column:status"`
+	Symbol           string  `gorm:"column:symbol"`
+	Time             int64   `gorm:"column:time"`
+	TradedAmount     float64 `gorm:"column:traded_amount"`
+	Turnover         float64 `gorm:"column:turnover"`
+	Type             string  `gorm:"column:type"`
+	UseDiscount      string  `gorm:"column:use_discount"`
+	TimeInForce      string  `gorm:"column:time_in_force"`
+	ExpireTime       int64   `gorm:"column:expire_time"`
+	TriggerPrice     float64 `gorm:"column:trigger_price"`
+	TriggerCondition string  `gorm:"column:trigger_condition"`
+	DisplayAmount    float64 `gorm:"column:display_amount"`
+	TrailAmount      float64 `gorm:"column:trail_amount"`
+	TrailPercent     float64 `gorm:"column:trail_percent"`
+	LinkId           string  `gorm:"column:link_id"`
+	Fee              float64 `gorm:"column:fee"`
 }
 
 func (old *ExchangeOrder) ToVo() *ExchangeOrderVo {
 	eo := &ExchangeOrderVo{}
 	copier.Copy(eo, old)
+	// 金额字段是decimal copier不会转换 对外展示转成float64
+	eo.Amount = old.Amount.Float64()
+	eo.Price = old.Price.Float64()
+	eo.TradedAmount = old.TradedAmount.Float64()
+	eo.Turnover = old.Turnover.Float64()
 	eo.Status = StatusMap.Value(old.Status)
 	eo.Direction = DirectionMap.Value(old.Direction)
 	eo.Type = TypeMap.Value(old.Type)
+	eo.TimeInForce = TimeInForceMap.Value(old.TimeInForce)
+	eo.TriggerPrice = old.TriggerPrice.Float64()
+	eo.TriggerCondition = TriggerConditionMap.Value(old.TriggerCondition)
+	eo.DisplayAmount = old.DisplayAmount.Float64()
+	eo.TrailAmount = old.TrailAmount.Float64()
+	eo.TrailPercent = old.TrailPercent.Float64()
+	eo.Fee = old.Fee.Float64()
 	return eo
 }
 
+// ExchangeOrderCanceled 撮合引擎撤单事件
+// 已成交的部分看 TradedAmount/Turnover 钱包按照这个结算并解冻剩余的部分
+type ExchangeOrderCanceled struct {
+	*ExchangeOrder
+	UntradedAmount decimal.Decimal `json:"untradedAmount"` // 没有成交的部分 市价买是没有花掉的金额
+	Reason         string          `json:"reason"`         // 撤单原因 CancelByUser CancelIOC ...
+	Transfer       decimal.Decimal `json:"transfer"`       // 转给OCO止损单继续冻结的资金 钱包解冻时要扣掉
+}
+
+func NewCanceledOrder(order *ExchangeOrder, reason string) *ExchangeOrderCanceled {
+	untraded := order.Amount.Sub(order.TradedAmount)
+	if order.Type == MarketPrice && order.Direction == BUY {
+		untraded = order.Amount.Sub(order.Turnover)
+	}
+	return &ExchangeOrderCanceled{
+		ExchangeOrder:  order,
+		UntradedAmount: untraded,
+		Reason:         reason,
+	}
+}
+
+// FreezeMoney 订单冻结的资金
+// 买 市价冻结的就是amount(金额) 限价冻结 price*amount 卖 冻结的是amount(数量)
+// 改过单的限价买单按改单时重新算的 Frozen
+func (old *ExchangeOrder) FreezeMoney() decimal.Decimal {
+	if old.Direction == BUY && old.Type == LimitPrice {
+		if !old.Frozen.IsZero() {
+			return old.Frozen
+		}
+		return old.FrozenPrice().Mul(old.Amount).Truncate(8)
+	}
+	return old.Amount
+}
+
+// AmendFrozen 改成price和amount以后要冻结的资金 已经成交的部分按实际花掉的算
+func (old *ExchangeOrder) AmendFrozen(price decimal.Decimal, amount decimal.Decimal) decimal.Decimal {
+	if old.Direction == BUY {
+		return old.Turnover.Add(price.Mul(amount.Sub(old.TradedAmount)).Truncate(8))
+	}
+	return amount
+}
+
+// ExchangeOrderAmend 改单请求 钱包先冻结Hold 撮合引擎改完以后按实际差额退回多冻结的部分
+type ExchangeOrderAmend struct {
+	AmendId    string          `json:"amendId,omitempty"` // 改单号 钱包按它去重 引擎自成交保护减数量的用输出事件的序号
+	OrderId    string          `json:"orderId"`
+	Symbol     string          `json:"symbol"`
+	MemberId   int64           `json:"memberId"`
+	Direction  int             `json:"direction"`
+	BaseSymbol string          `json:"baseSymbol"`
+	CoinSymbol string          `json:"coinSymbol"`
+	Price      decimal.Decimal `json:"price"`  // 新价格 0不改
+	Amount     decimal.Decimal `json:"amount"` // 新数量 0不改
+	Hold       decimal.Decimal `json:"hold"`   // 钱包预先冻结的资金 只减少的改单为0
+}
+
+// ExchangeOrderAmended 撮合引擎改单结果 Reason为空表示改单成功 Price Amount是改完的值
+// 钱包解冻Release 拒绝时就是Hold
+type ExchangeOrderAmended struct {
+	*ExchangeOrderAmend
+	Frozen  decimal.Decimal `json:"frozen"`  // 改完以后订单冻结的资金
+	Release decimal.Decimal `json:"release"` // 要解冻的资金
+	Reason  string          `json:"reason"`
+}
+
+// FrozenPrice 冻结资金时用的价格 设置了OriginalPrice的用它
+func (old *ExchangeOrder) FrozenPrice() decimal.Decimal {
+	if old.OriginalPrice.IsZero() {
+		return old.Price
+	}
+	return old.OriginalPrice
+}
+
+// IsIceberg 是否冰山单
+func (old *ExchangeOrder) IsIceberg() bool {
+	return old.DisplayAmount.Sign() > 0
+}
+
+// Visible 盘口上显示的数量 冰山单只显示当前的一份 其他订单显示全部未成交的数量
+func (old *ExchangeOrder) Visible() decimal.Decimal {
+	if old.IsIceberg() {
+		return old.VisibleAmount
+	}
+	return old.Amount.Sub(old.TradedAmount)
+}
+
+// Refresh 冰山单从隐藏的部分补一份新的显示数量 剩下的不够一份就全部显示
+func (old *ExchangeOrder) Refresh() {
+	remain := old.Amount.Sub(old.TradedAmount)
+	if remain.GreaterThan(old.DisplayAmount) {
+		old.VisibleAmount = old.DisplayAmount
+	} else {
+		old.VisibleAmount = remain
+	}
+}
+
+// TrailTrigger 跟踪止损单按水位线算出来的触发价
+// 卖单在水位线下面 价格回落到这里触发 买单在水位线上面 价格反弹到这里触发
+func (old *ExchangeOrder) TrailTrigger() decimal.Decimal {
+	offset := old.TrailAmount
+	if offset.IsZero() {
+		offset = old.TrailMark.Mul(old.TrailPercent).Div(decimal.New(100, 0), 8, decimal.RoundDown)
+	}
+	if old.Direction == SELL {
+		return old.TrailMark.Sub(offset)
+	}
+	return old.TrailMark.Add(offset)
+}
+
+// Trail 用最新成交价移动水位线 返回水位线有没有变
+func (old *ExchangeOrder) Trail(price decimal.Decimal) bool {
+	if (old.Direction == SELL && price.GreaterThan(old.TrailMark)) ||
+		(old.Direction == BUY && price.LessThan(old.TrailMark)) {
+		old.TrailMark = price
+		old.TriggerPrice = old.TrailTrigger()
+		return true
+	}
+	return false
+}
+
+// IsOcoStop 是否OCO订单里的止损单 用同组止盈单冻结的资金
+func (old *ExchangeOrder) IsOcoStop() bool {
+	return old.LinkId != "" && old.TriggerPrice.Sign() > 0
+}
+
+// IsOcoLimit 是否OCO订单里的止盈限价单 两条腿的资金都由它冻结
+func (old *ExchangeOrder) IsOcoLimit() bool {
+	return old.LinkId != "" && old.TriggerPrice.IsZero()
+}
+
 func NewOrder() *ExchangeOrder {
 	return &ExchangeOrder{}
 }
@@ -0,0 +1,56 @@
+package model
+
+import "mscoin-common/decimal"
+
+// ExchangeTrade 成交记录 撮合引擎每撮合一次就产生一条
+type ExchangeTrade struct {
+	Id           int64           `gorm:"column:id" json:"id"`
+	TradeId      string          `gorm:"column:trade_id" json:"tradeId"`
+	Symbol       string          `gorm:"column:symbol" json:"symbol"`
+	Price        decimal.Decimal `gorm:"column:price" json:"price"`
+	Amount       decimal.Decimal `gorm:"column:amount" json:"amount"`
+	Turnover     decimal.Decimal `gorm:"column:turnover" json:"turnover"`
+	BuyOrderId   string          `gorm:"column:buy_order_id" json:"buyOrderId"`
+	SellOrderId  string          `gorm:"column:sell_order_id" json:"sellOrderId"`
+	BuyMemberId  int64           `gorm:"column:buy_member_id" json:"buyMemberId"`
+	SellMemberId int64           `gorm:"column:sell_member_id" json:"sellMemberId"`
+	Direction    int             `gorm:"column:direction" json:"direction"` // 主动成交方(taker)的方向
+	BuyFee       decimal.Decimal `gorm:"column:buy_fee" json:"buyFee"`      // 买方手续费 从收到的币里扣
+	SellFee      decimal.Decimal `gorm:"column:sell_fee" json:"sellFee"`    // 卖方手续费 从收到的钱里扣
+	BuyDiscount  string          `gorm:"-" json:"buyDiscount"`              // 买单选了平台币抵扣 ucenter逐笔结算时用
+	SellDiscount string          `gorm:"-" json:"sellDiscount"`
+	Time         int64           `gorm:"column:time" json:"time"`
+}
+
+func (*ExchangeTrade) TableName() string {
+	return "exchange_trade"
+}
+
+// MemberTurnover 会员在一个交易对上的成交额 买卖两边都算
+type MemberTurnover struct {
+	MemberId int64           `gorm:"column:member_id"`
+	Symbol   string          `gorm:"column:symbol"`
+	Turnover decimal.Decimal `gorm:"column:turnover"`
+}
+
+// NewTrade taker 是新进入引擎的订单 maker 是挂在盘口上的订单
+func NewTrade(symbol string, taker *ExchangeOrder, maker *ExchangeOrder, price decimal.Decimal, amount decimal.Decimal, turnover decimal.Decimal) *ExchangeTrade {
+	trade := &ExchangeTrade{
+		Symbol:    symbol,
+		Price:     price,
+		Amount:    amount,
+		Turnover:  turnover,
+		Direction: taker.Direction,
+	}
+	buyOrder, sellOrder := taker, maker
+	if taker.Direction == SELL {
+		buyOrder, sellOrder = maker, taker
+	}
+	trade.BuyOrderId = buyOrder.OrderId
+	trade.BuyMemberId = buyOrder.MemberId
+	trade.SellOrderId = sellOrder.OrderId
+	trade.SellMemberId = sellOrder.MemberId
+	trade.BuyDiscount = buyOrder.UseDiscount
+	trade.SellDiscount = sellOrder.UseDiscount
+	return trade
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"fmt"
+	"mscoin-common/decimal"
+	"strings"
+)
+
+// amend 改单 只在撮合协程中调用 结果通过 exchange_order_amended 通知订单服务和钱包
+// 只减少数量的保留原来的排队位置 改价或者加量的从盘口拿下来重新撮合 排到新价格档位的最后
+// 冻结资金按改完的订单重新算 比原来多出来的部分从钱包预先冻结的Hold里出 剩下的退回
+func (t *CoinTrade) amend(in *model.ExchangeOrderAmend) {
+	order := t.findLimit(in.OrderId)
+	if order == nil {
+		t.sendAmended(in, nil, in.Hold, model.AmendNotFound)
+		return
+	}
+	t.uncross()
+	if t.auctioning() {
+		t.sendAmended(in, nil, in.Hold, model.AmendAuction)
+		return
+	}
+	price := in.Price
+	if price.IsZero() {
+		price = order.Price
+	}
+	amount := in.Amount
+	if amount.IsZero() {
+		amount = order.Amount
+	}
+	if amount.LessThanOrEqual(order.TradedAmount) {
+		t.sendAmended(in, nil, in.Hold, model.AmendAmount)
+		return
+	}
+	frozen := order.AmendFrozen(price, amount)
+	delta := frozen.Sub(order.FreezeMoney())
+	if delta.GreaterThan(in.Hold) {
+		t.sendAmended(in, nil, in.Hold, model.AmendFunds)
+		return
+	}
+	var limitPriceList *LimitPriceQueue
+	var marketPriceList *TradeTimeQueue
+	plate := t.buyTradePlate
+	if order.Direction == model.BUY {
+		limitPriceList = t.sellLimitQueue
+		marketPriceList = &t.sellMarketQueue
+	} else {
+		limitPriceList = t.buyLimitQueue
+		marketPriceList = &t.buyMarketQueue
+		plate = t.sellTradePlate
+	}
+	repriced := !price.Equal(order.Price)
+	if repriced && order.PostOnly != model.PostOnlyOff && t.crosses(order, price, limitPriceList, *marketPriceList) {
+		t.sendAmended(in, nil, in.Hold, model.AmendPostOnly)
+		return
+	}
+	if order.Direction == model.BUY {
+		order.Frozen = frozen
+	}
+	if !repriced && amount.LessThanOrEqual(order.Amount) {
+		// 只减少数量 原地修改 排队位置不变
+		t.resize(order, amount)
+		t.sendAmended(in, order, in.Hold.Sub(delta), "")
+		t.sendTradPlateMsg(plate)
+		return
+	}
+	// 改价或者加量 重新进入撮合 没有成交完的排到新价格档位的最后
+	t.remove(order.OrderId)
+	order.Price = price
+	order.Amount = amount
+	t.sendAmended(in, order, in.Hold.Sub(delta), "")
+	t.matchLimitPriceWithLP(limitPriceList, order)
+	if order.Status == model.Trading {
+		t.matchLimitPriceWithMP(marketPriceList, order)
+	}
+	if order.Status == model.Trading {
+		t.addLimitQueue(order)
+	}
+	t.sendTradPlateMsg(plate)
+}
+
+// crosses 限价单改成price以后会不会和对手盘立即成交
+func (t *CoinTrade) crosses(order *model.ExchangeOrder, price decimal.Decimal, lpList *LimitPriceQueue, mpList TradeTimeQueue) bool {
+	for _, matchOrder := range mpList {
+		if matchOrder.MemberId != order.MemberId && matchOrder.Amount.Sub(matchOrder.TradedAmount).Sign() > 0 {
+			return true
+		}
+	}
+	best, ok := bestPrice(lpList, order)
+	if !ok {
+		return false
+	}
+	if order.Direction == model.BUY {
+		return price.GreaterThanOrEqual(best)
+	}
+	return price.LessThanOrEqual(best)
+}
+
+// findLimit 盘口上的限价单 返回引擎里的订单 不是副本
+func (t *CoinTrade) findLimit(orderId string) *model.ExchangeOrder {
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, order := range v.list {
+				if order.OrderId == orderId {
+					return order
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sendAmended 发送改单结果 order是改完的订单 拒绝时为nil
+func (t *CoinTrade) sendAmended(in *model.ExchangeOrderAmend, order *model.ExchangeOrder, release decimal.Decimal, reason string) {
+	out := *in
+	if out.AmendId == "" {
+		// 自成交保护减数量没有改单号 用这条输出事件的序号 回放时也一样
+		out.AmendId = fmt.Sprintf("%s-%d", strings.ReplaceAll(t.symbol, "/", ""), t.seq+1)
+	}
+	amended := &model.ExchangeOrderAmended{
+		ExchangeOrderAmend: &out,
+		Release:            release,
+		Reason:             reason,
+	}
+	if order != nil {
+		out.Price = order.Price
+		out.Amount = order.Amount
+		amended.Frozen = order.FreezeMoney()
+	}
+	t.record(journal.TypeAmended, amended)
+	t.publish("exchange_order_amended", amended, true)
+}
@@ -0,0 +1,263 @@
+package processor
+
+import (
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+	"sort"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// uncrossInput 集合竞价结束撮合 没有参数 时间就是日志里的时间
+type uncrossInput struct{}
+
+// Indicative 集合竞价期间的参考成交价和成交量 每次挂单撤单后推给行情
+type Indicative struct {
+	Symbol string          `json:"symbol"`
+	Price  decimal.Decimal `json:"price"`  // 现在结束能成交的价格 没有交叉为0
+	Volume decimal.Decimal `json:"volume"` // 这个价格能成交的数量
+	Until  int64           `json:"until"`  // 集合竞价结束时间 毫秒
+}
+
+// auctionEnd 集合竞价结束时间 新上线的交易对到开始时间为止 熔断到冷却结束为止
+func (t *CoinTrade) auctionEnd() int64 {
+	if t.breaker.Until > t.conf.AuctionEnd {
+		return t.breaker.Until
+	}
+	return t.conf.AuctionEnd
+}
+
+// auctioning 当前指令的时间是不是在集合竞价中
+func (t *CoinTrade) auctioning() bool {
+	return t.auctionEnd() > t.now
+}
+
+// collect 集合竞价期间的新订单 只收普通限价单 挂到盘口上不撮合
+// 市价单 IOC FOK post only没法等到竞价结束 直接撤掉
+func (t *CoinTrade) collect(order *model.ExchangeOrder) {
+	if order.Type != model.LimitPrice || order.PostOnly != model.PostOnlyOff ||
+		order.TimeInForce == model.IOC || order.TimeInForce == model.FOK {
+		t.sendCanceledOrder(order, model.CancelAuction)
+		return
+	}
+	t.addLimitQueue(order)
+	t.addExpiring(order)
+	if order.Direction == model.BUY {
+		t.sendTradPlateMsg(t.buyTradePlate)
+	} else {
+		t.sendTradPlateMsg(t.sellTradePlate)
+	}
+	t.sendIndicative()
+}
+
+// sendIndicative 推送参考成交价和成交量
+func (t *CoinTrade) sendIndicative() {
+	price, volume := t.clearing()
+	t.publish("exchange_auction_indicative", &Indicative{
+		Symbol: t.symbol,
+		Price:  price,
+		Volume: volume,
+		Until:  t.auctionEnd(),
+	}, false)
+}
+
+// clearing 成交量最大的价格 成交量一样的取买卖剩余最少的
+// 还一样的 买方剩余多取高的 卖方剩余多取低的 都没有剩余取低的
+// 没有交叉返回0
+func (t *CoinTrade) clearing() (decimal.Decimal, decimal.Decimal) {
+	var prices []decimal.Decimal
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			prices = append(prices, v.price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].LessThan(prices[j]) })
+	best, volume, imbalance := decimal.Zero, decimal.Zero, decimal.Zero
+	for _, price := range prices {
+		buy := depth(t.buyLimitQueue, func(p decimal.Decimal) bool { return p.GreaterThanOrEqual(price) })
+		sell := depth(t.sellLimitQueue, func(p decimal.Decimal) bool { return p.LessThanOrEqual(price) })
+		exec := decimal.Min(buy, sell)
+		if exec.Sign() <= 0 {
+			continue
+		}
+		diff := buy.Sub(sell)
+		switch {
+		case exec.GreaterThan(volume):
+		case exec.LessThan(volume):
+			continue
+		case diff.Abs().LessThan(imbalance.Abs()):
+		case diff.Abs().GreaterThan(imbalance.Abs()):
+			continue
+		case diff.Sign() > 0:
+			// 买方剩余多 价格从低往高看 取高的
+		default:
+			continue
+		}
+		best, volume, imbalance = price, exec, diff
+	}
+	return best, volume
+}
+
+// depth 满足价格条件的限价单剩余数量合计 冰山单按全部剩余算
+func depth(lpList *LimitPriceQueue, match func(decimal.Decimal) bool) decimal.Decimal {
+	sum := decimal.Zero
+	for _, v := range lpList.list {
+		if !match(v.price) {
+			continue
+		}
+		for _, order := range v.list {
+			sum = sum.Add(order.Amount.Sub(order.TradedAmount))
+		}
+	}
+	return sum
+}
+
+// uncrossDue 集合竞价已经结束 盘口还是交叉的 要按一个价格撮合
+func (t *CoinTrade) uncrossDue(now int64) bool {
+	if t.auctionEnd() > now {
+		return false
+	}
+	buy, sell := t.tops()
+	return buy != nil && sell != nil && buy.Price.GreaterThanOrEqual(sell.Price)
+}
+
+// tops 买一和卖一档位上排在最前面的订单 档位没排序 要全部看一遍
+func (t *CoinTrade) tops() (*model.ExchangeOrder, *model.ExchangeOrder) {
+	var buy, sell *model.ExchangeOrder
+	for _, v := range t.buyLimitQueue.list {
+		if len(v.list) > 0 && (buy == nil || v.price.GreaterThan(buy.Price)) {
+			buy = v.list[0]
+		}
+	}
+	for _, v := range t.sellLimitQueue.list {
+		if len(v.list) > 0 && (sell == nil || v.price.LessThan(sell.Price)) {
+			sell = v.list[0]
+		}
+	}
+	return buy, sell
+}
+
+// uncross 集合竞价结束 所有能成交的订单都按同一个价格成交 然后回到连续撮合
+// 买单价格从高到低 卖单价格从低到高 同价格按挂单顺序 自己的订单之间不成交
+// 后挂单的一方算taker
+func (t *CoinTrade) uncross() {
+	if !t.uncrossDue(t.now) {
+		return
+	}
+	price, volume := t.clearing()
+	sort.Sort(t.buyLimitQueue.list)
+	sort.Sort(sort.Reverse(t.sellLimitQueue.list))
+	buys := crossing(t.buyLimitQueue, func(p decimal.Decimal) bool { return p.GreaterThanOrEqual(price) })
+	sells := crossing(t.sellLimitQueue, func(p decimal.Decimal) bool { return p.LessThanOrEqual(price) })
+	var trades []*model.ExchangeTrade
+	var completeOrders []*model.ExchangeOrder
+	for _, buy := range buys {
+		for _, sell := range sells {
+			if volume.Sign() <= 0 || buy.Amount.Sub(buy.TradedAmount).Sign() <= 0 {
+				break
+			}
+			remain := sell.Amount.Sub(sell.TradedAmount)
+			if remain.Sign() <= 0 || sell.MemberId == buy.MemberId {
+				continue
+			}
+			amount := decimal.Min(decimal.Min(remain, buy.Amount.Sub(buy.TradedAmount)), volume)
+			turnover := price.Mul(amount).Truncate(8)
+			taker, maker := buy, sell
+			if sell.Time > buy.Time {
+				taker, maker = sell, buy
+			}
+			trades = append(trades, t.newTrade(taker, maker, price, amount, turnover))
+			for _, order := range []*model.ExchangeOrder{buy, sell} {
+				order.TradedAmount = order.TradedAmount.Add(amount)
+				order.Turnover = order.Turnover.Add(turnover)
+				if order.IsOcoLimit() && order.TradedAmount.Equal(amount) {
+					t.sendFilledOrder(order)
+				}
+				if order.Amount.Sub(order.TradedAmount).Sign() <= 0 {
+					order.Status = model.Completed
+					completeOrders = append(completeOrders, order)
+				}
+			}
+			volume = volume.Sub(amount)
+		}
+	}
+	for _, order := range completeOrders {
+		t.remove(order.OrderId)
+	}
+	// 成交以后冰山单重新补显示的部分 盘口按队列重新算
+	t.rebuildPlate()
+	logx.Infof("集合竞价撮合完成,symbol=%s,price=%s,trades=%d", t.symbol, price.String(), len(trades))
+	t.sendTrade(trades)
+	for _, v := range completeOrders {
+		t.sendCompleteOrder(v)
+	}
+	t.uncrossRest()
+	t.sendTradPlateMsg(t.buyTradePlate)
+	t.sendTradPlateMsg(t.sellTradePlate)
+}
+
+// uncrossRest 按一个价格撮合完还交叉的 直到盘口不再交叉
+// 买一卖一是自己的订单 按自成交处理 撤掉后挂的一方
+// 不是自己的 是前面和自己的订单没成交让出来的 后挂的一方当作新订单按连续撮合再撮一次
+func (t *CoinTrade) uncrossRest() {
+	for buy, sell := t.tops(); buy != nil && sell != nil && buy.Price.GreaterThanOrEqual(sell.Price); buy, sell = t.tops() {
+		order, lpList := buy, t.sellLimitQueue
+		if sell.Time > buy.Time {
+			order, lpList = sell, t.buyLimitQueue
+		}
+		t.remove(order.OrderId)
+		if buy.MemberId == sell.MemberId {
+			t.sendCanceledOrder(order, model.CancelSTP)
+			continue
+		}
+		traded := order.TradedAmount
+		t.matchLimitPriceWithLP(lpList, order)
+		if order.IsOcoLimit() && traded.IsZero() && order.TradedAmount.Sign() > 0 {
+			t.sendFilledOrder(order)
+		}
+		if order.Status == model.Trading {
+			t.addLimitQueue(order)
+		}
+	}
+}
+
+// crossing 满足价格条件的限价单 按队列顺序
+func crossing(lpList *LimitPriceQueue, match func(decimal.Decimal) bool) []*model.ExchangeOrder {
+	var list []*model.ExchangeOrder
+	for _, v := range lpList.list {
+		if match(v.price) {
+			list = append(list, v.list...)
+		}
+	}
+	return list
+}
+
+// rebuildPlate 按限价队列重新生成买卖盘
+func (t *CoinTrade) rebuildPlate() {
+	t.buyTradePlate.Clear()
+	t.sellTradePlate.Clear()
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, order := range v.list {
+				if order.IsIceberg() {
+					order.Refresh()
+				}
+				if order.Direction == model.BUY {
+					t.buyTradePlate.Add(order)
+				} else {
+					t.sellTradePlate.Add(order)
+				}
+			}
+		}
+	}
+}
+
+// checkUncross 由撮合协程定时检查 集合竞价结束了就写一条日志再撮合
+func (t *CoinTrade) checkUncross(now int64) {
+	if !t.uncrossDue(now) {
+		return
+	}
+	t.input(journal.TypeUncross, &uncrossInput{})
+	t.uncross()
+}
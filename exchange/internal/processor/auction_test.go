@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"encoding/json"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"fmt"
+	"testing"
+)
+
+// auctionTrade 还在集合竞价中的引擎 结束时间是 now+100
+func auctionTrade(t *testing.T, now int64) *CoinTrade {
+	t.Helper()
+	ct := newTestTrade(t, t.TempDir())
+	ct.conf.AuctionEnd = now + 100
+	return ct
+}
+
+type level struct {
+	direction int
+	price     string
+	amount    string
+}
+
+func TestClearing(t *testing.T) {
+	cases := []struct {
+		name   string
+		book   []level
+		price  string
+		volume string
+	}{
+		{
+			name:   "max volume",
+			book:   []level{{model.BUY, "101", "2"}, {model.BUY, "100", "1"}, {model.SELL, "99", "1"}, {model.SELL, "100", "2"}},
+			price:  "100",
+			volume: "3",
+		},
+		{
+			name:   "same volume smaller imbalance",
+			book:   []level{{model.BUY, "102", "2"}, {model.SELL, "100", "2"}, {model.SELL, "101", "1"}},
+			price:  "100",
+			volume: "2",
+		},
+		{
+			name:   "buy surplus takes higher price",
+			book:   []level{{model.BUY, "102", "3"}, {model.SELL, "100", "1"}, {model.SELL, "101", "1"}},
+			price:  "102",
+			volume: "2",
+		},
+		{
+			name:   "sell surplus takes lower price",
+			book:   []level{{model.SELL, "100", "3"}, {model.BUY, "101", "1"}, {model.BUY, "102", "1"}},
+			price:  "100",
+			volume: "2",
+		},
+		{
+			name:   "no cross",
+			book:   []level{{model.BUY, "99", "1"}, {model.SELL, "100", "1"}},
+			price:  "0",
+			volume: "0",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := int64(1_700_000_000_000)
+			ct := auctionTrade(t, now)
+			for i, l := range c.book {
+				o := limitOrder(fmt.Sprintf("o%d", i), l.direction, l.price, l.amount, int64(i+1), now+int64(i))
+				feed(t, ct, journal.TypePlace, o.Time, o)
+			}
+			// 集合竞价期间只挂单
+			if n := len(entries(t, ct.journalFile, journal.TypeTrade)); n != 0 {
+				t.Fatalf("%d trades during auction", n)
+			}
+			price, volume := ct.clearing()
+			if !price.Equal(dec(c.price)) || !volume.Equal(dec(c.volume)) {
+				t.Fatalf("clearing %s x %s, want %s x %s", price, volume, c.price, c.volume)
+			}
+		})
+	}
+}
+
+// 撮合完只剩自己的订单交叉 撤掉后挂的一方
+func TestUncrossCancelsSelfCross(t *testing.T) {
+	now := int64(1_700_000_000_000)
+	ct := auctionTrade(t, now)
+	feed(t, ct, journal.TypePlace, now, limitOrder("b1", model.BUY, "101", "1", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("s1", model.SELL, "100", "1", 1, now+1))
+	feed(t, ct, journal.TypePlace, now+2, limitOrder("s2", model.SELL, "100", "0.5", 2, now+2))
+	feed(t, ct, journal.TypeUncross, now+100, &uncrossInput{})
+
+	trades := entries(t, ct.journalFile, journal.TypeTrade)
+	if len(trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(trades))
+	}
+	trade := &model.ExchangeTrade{}
+	if err := json.Unmarshal(trades[0].Data, trade); err != nil {
+		t.Fatal(err)
+	}
+	if trade.BuyOrderId != "b1" || trade.SellOrderId != "s2" || !trade.Price.Equal(dec("100")) || !trade.Amount.Equal(dec("0.5")) {
+		t.Fatalf("trade %+v", trade)
+	}
+	got := canceled(t, ct)
+	if len(got) != 1 || got["s1"] == nil || got["s1"].Reason != model.CancelSTP {
+		t.Fatalf("canceled %v, want s1 by STP", got)
+	}
+	if ct.query("s1") != nil || ct.query("s2") != nil {
+		t.Fatal("canceled or completed sell still on the book")
+	}
+	b1 := ct.query("b1")
+	if b1 == nil || !b1.Amount.Sub(b1.TradedAmount).Equal(dec("0.5")) {
+		t.Fatalf("b1 left %+v, want 0.5 resting", b1)
+	}
+	if buy, sell := ct.tops(); buy != nil && sell != nil && buy.Price.GreaterThanOrEqual(sell.Price) {
+		t.Fatal("book still crossed after uncross")
+	}
+}
+
+// 买一卖一是自己的订单没成交 让出来的其他用户的订单还交叉 按连续撮合成交 不能当自成交撤掉
+func TestUncrossMatchesOthersBehindSelfCross(t *testing.T) {
+	now := int64(1_700_000_000_000)
+	ct := auctionTrade(t, now)
+	feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "1", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("b1", model.BUY, "101", "1", 1, now+1))
+	feed(t, ct, journal.TypePlace, now+2, limitOrder("b2", model.BUY, "100", "1", 2, now+2))
+	feed(t, ct, journal.TypeUncross, now+100, &uncrossInput{})
+
+	trades := entries(t, ct.journalFile, journal.TypeTrade)
+	if len(trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(trades))
+	}
+	trade := &model.ExchangeTrade{}
+	if err := json.Unmarshal(trades[0].Data, trade); err != nil {
+		t.Fatal(err)
+	}
+	if trade.BuyOrderId != "b2" || trade.SellOrderId != "s1" || !trade.Price.Equal(dec("100")) || !trade.Amount.Equal(dec("1")) {
+		t.Fatalf("trade %+v", trade)
+	}
+	got := canceled(t, ct)
+	if len(got) != 1 || got["b1"] == nil || got["b1"].Reason != model.CancelSTP {
+		t.Fatalf("canceled %v, want only b1 by STP", got)
+	}
+	for _, id := range []string{"s1", "b1", "b2"} {
+		if ct.query(id) != nil {
+			t.Fatalf("%s still on the book", id)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// breaker 熔断状态 跟着快照保存 恢复后还在冷却中的继续暂停
+type breaker struct {
+	Until int64       `json:"until"` // 暂停撮合到什么时候 毫秒 0没有熔断
+	Ticks []priceTick `json:"ticks"` // 统计窗口内的成交价 按时间排序
+}
+
+type priceTick struct {
+	Time  int64           `json:"time"`
+	Price decimal.Decimal `json:"price"`
+}
+
+// halted 当前指令的时间是不是还在熔断冷却中
+func (t *CoinTrade) halted() bool {
+	return t.breaker.Until > t.now
+}
+
+// observe 记录一笔成交价 窗口内最高最低价相差超过阈值就熔断
+// 正在撮合的订单继续撮合完 从下一条指令开始暂停
+func (t *CoinTrade) observe(price decimal.Decimal) {
+	if t.conf.HaltThreshold <= 0 || t.conf.HaltWindow <= 0 || t.halted() {
+		return
+	}
+	from := t.now - t.conf.HaltWindow
+	i := 0
+	for i < len(t.breaker.Ticks) && t.breaker.Ticks[i].Time < from {
+		i++
+	}
+	t.breaker.Ticks = append(t.breaker.Ticks[i:], priceTick{Time: t.now, Price: price})
+	low, high := price, price
+	for _, v := range t.breaker.Ticks {
+		if v.Price.LessThan(low) {
+			low = v.Price
+		}
+		if v.Price.GreaterThan(high) {
+			high = v.Price
+		}
+	}
+	limit := low.Mul(decimal.NewFromFloat(t.conf.HaltThreshold)).Div(decimal.NewFromInt(100), 8, decimal.RoundDown)
+	if high.Sub(low).LessThanOrEqual(limit) {
+		return
+	}
+	t.breaker.Until = t.now + t.conf.HaltCooldown
+	t.breaker.Ticks = nil
+	halt := &model.SymbolHalt{
+		Symbol: t.symbol,
+		Halted: true,
+		Until:  t.breaker.Until,
+		Low:    low,
+		High:   high,
+	}
+	logx.Infof("交易对熔断,symbol=%s,low=%s,high=%s,until=%d", t.symbol, low.String(), high.String(), t.breaker.Until)
+	t.record(journal.TypeHalt, halt)
+	t.publish("exchange_symbol_halt", halt, true)
+}
+
+// resume 冷却时间过了通知恢复撮合 由撮合协程定时检查
+// 是否暂停只看时间 这里只是清掉状态和发通知 不用写日志
+func (t *CoinTrade) resume(now int64) {
+	if t.breaker.Until == 0 || t.breaker.Until > now {
+		return
+	}
+	t.breaker.Until = 0
+	logx.Infof("交易对恢复撮合,symbol=%s", t.symbol)
+	t.publish("exchange_symbol_halt", &model.SymbolHalt{Symbol: t.symbol}, true)
+}
+
+// sweepBound 市价单能吃到的最远价格 ref是第一笔成交价 ok为false不限制
+func (t *CoinTrade) sweepBound(direction int, ref decimal.Decimal) (decimal.Decimal, bool) {
+	if t.conf.SweepLimit <= 0 {
+		return decimal.Zero, false
+	}
+	offset := ref.Mul(decimal.NewFromFloat(t.conf.SweepLimit)).Div(decimal.NewFromInt(100), 8, decimal.RoundDown)
+	if direction == model.BUY {
+		return ref.Add(offset), true
+	}
+	return ref.Sub(offset), true
+}
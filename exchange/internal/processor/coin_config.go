@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"exchange/internal/journal"
+	"grpc-common/market/types/market"
+	"mscoin-common/decimal"
+)
+
+// CoinConfig 撮合时用到的交易对配置
+// 配置会影响撮合结果 变化时作为输入指令写进撮合日志 回放时用的是当时的配置
+type CoinConfig struct {
+	PriceScale     int32   `json:"priceScale"`     // 价格精度 最小变动价位是 10^-PriceScale
+	StpMode        int     `json:"stpMode"`        // 自成交保护模式 model.StpCancelNewest 等
+	SweepLimit     float64 `json:"sweepLimit"`     // 市价单最多吃到离第一笔成交价多少 百分比 0不限制
+	HaltThreshold  float64 `json:"haltThreshold"`  // 熔断 窗口内成交价波动超过这个百分比暂停撮合 0不启用
+	HaltWindow     int64   `json:"haltWindow"`     // 熔断统计窗口 毫秒
+	HaltCooldown   int64   `json:"haltCooldown"`   // 熔断后暂停多久 毫秒
+	AuctionEnd     int64   `json:"auctionEnd"`     // 新上线的交易对 开始交易之前是集合竞价 毫秒
+	MaxTradingTime int64   `json:"maxTradingTime"` // 委托超时自动下架 挂单超过这么久撤掉 毫秒 0不限制
+	TakerFee       float64 `json:"takerFee"`       // 吃单手续费率
+	MakerFee       float64 `json:"makerFee"`       // 挂单手续费率
+}
+
+func NewCoinConfig(coin *market.ExchangeCoin) CoinConfig {
+	return CoinConfig{
+		PriceScale:    int32(coin.BaseCoinScale),
+		StpMode:       int(coin.StpMode),
+		SweepLimit:    coin.SweepLimit,
+		HaltThreshold: coin.HaltThreshold,
+		// 交易对上配置的是秒
+		HaltWindow:     coin.HaltWindow * 1000,
+		HaltCooldown:   coin.HaltCooldown * 1000,
+		AuctionEnd:     coin.StartTime,
+		MaxTradingTime: coin.MaxTradingTime * 1000,
+		TakerFee:       coin.Fee,
+		MakerFee:       coin.MakerFee,
+	}
+}
+
+// configure 使用新的配置 和当前的一样就什么都不做
+func (t *CoinTrade) configure(c CoinConfig) {
+	if c == t.conf {
+		return
+	}
+	t.input(journal.TypeConfig, c)
+	t.setConf(c)
+}
+
+// setConf 换配置 委托超时变了 要按新的配置重新收集要检查的订单
+func (t *CoinTrade) setConf(c CoinConfig) {
+	rebuild := c.MaxTradingTime != t.conf.MaxTradingTime
+	t.conf = c
+	if rebuild {
+		t.rebuildExpiring()
+	}
+}
+
+// tick 最小变动价位
+func (t *CoinTrade) tick() decimal.Decimal {
+	return decimal.New(1, t.conf.PriceScale)
+}
@@ -3,21 +3,24 @@
 // 1. 支持市价单和限价单的撮合
 // 2. 维护买卖盘口信息
 // 3. 实现价格优先、时间优先的撮合规则
-// 4. 提供并发安全的订单处理
+// 4. 每个交易对一个撮合协程 指令按顺序处理 内部不加锁
 // 5. 支持订单状态管理和通知机制
 package processor
 
 import (
 	"context"
-	"encoding/json"
 	"exchange/internal/database"
-	"exchange/internal/domain"
+	"exchange/internal/journal"
 	"exchange/internal/model"
+	"exchange/internal/snapshot"
+	"fmt"
 	"grpc-common/market/mclient"
 	"grpc-common/market/types/market"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
-	"mscoin-common/op"
+	"mscoin-common/tools"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,6 +33,7 @@ import (
 type CoinTradeFactory struct {
 	tradeMap map[string]*CoinTrade // 存储不同交易对的撮合引擎实例
 	mux      sync.RWMutex          // 读写锁，保护 tradeMap 的并发访问
+	listener TradeListener         // 成交价回调，交给每个撮合引擎
 }
 
 // NewCoinTradeFactory 创建新的交易引擎工厂
@@ -45,7 +49,9 @@ func NewCoinTradeFactory() *CoinTradeFactory {
 // marketRpc: 市场服务客户端
 // client: Kafka客户端，用于发送交易消息
 // db: 数据库连接，用于持久化交易数据
-func (c *CoinTradeFactory) Init(marketRpc mclient.Market, client *database.KafkaClient, db *msdb.MsDB) {
+// jc: 撮合日志配置
+// sc: 快照配置
+func (c *CoinTradeFactory) Init(marketRpc mclient.Market, client *database.KafkaClient, db *msdb.MsDB, jc journal.Config, sc snapshot.Config) {
 	ctx := context.Background()
 	exchangeCoinRes, err := marketRpc.FindExchangeCoinVisible(ctx, &market.MarketReq{})
 	if err != nil {
@@ -53,48 +59,120 @@ func (c *CoinTradeFactory) Init(marketRpc mclient.Market, client *database.Kafka
 		return
 	}
 	for _, v := range exchangeCoinRes.List {
-		c.AddCoinTrade(v.Symbol, NewCoinTrade(v.Symbol, client, db))
+		ct := NewCoinTrade(v.Symbol, NewCoinConfig(v), client, db, jc, sc)
+		ct.Start(c.listener)
+		c.AddCoinTrade(v.Symbol, ct)
 	}
 }
 
+// OnTrade 设置成交价回调 要在 Init 之前调用
+func (c *CoinTradeFactory) OnTrade(listener TradeListener) {
+	c.listener = listener
+}
+
 // NewCoinTrade 创建新的交易对撮合引擎
 // symbol: 交易对符号，如 "BTC/USDT"
+// conf: 交易对配置
 // cli: Kafka客户端，用于发送交易消息
 // db: 数据库连接，用于持久化交易数据
-func NewCoinTrade(symbol string, cli *database.KafkaClient, db *msdb.MsDB) *CoinTrade {
+// jc: 撮合日志配置，目录为空不记录日志
+// sc: 快照配置，目录为空不做快照
+func NewCoinTrade(symbol string, conf CoinConfig, cli *database.KafkaClient, db *msdb.MsDB, jc journal.Config, sc snapshot.Config) *CoinTrade {
 	c := &CoinTrade{
-		symbol:      symbol,
-		kafkaClient: cli,
-		db:          db,
+		symbol:        symbol,
+		kafkaClient:   cli,
+		db:            db,
+		inbox:         make(chan *command, inboxSize),
+		pendingCancel: make(map[string]int64),
+		snapshotConf:  sc,
 	}
-	c.init()
+	c.init(jc)
+	// 恢复出来的是上次的配置 有变化要记进日志
+	c.configure(conf)
 	return c
 }
 
+// Start 启动撮合协程 listener 为空不回调成交价
+func (t *CoinTrade) Start(listener TradeListener) {
+	t.listener = listener
+	go t.run()
+}
+
 // init 初始化交易对撮合引擎
-// 创建买卖盘口和限价队列
-func (t *CoinTrade) init() {
+// 创建买卖盘口和限价队列 恢复顺序:
+// 1. 最新的有效快照 + 快照之后的撮合日志
+// 2. 最新的有效快照 + 数据库(没有撮合日志 或者日志比快照还旧)
+// 3. 完整的撮合日志
+// 4. 数据库
+func (t *CoinTrade) init(jc journal.Config) {
+	t.initBook()
+	if jc.Dir != "" {
+		j, err := journal.Open(jc, t.symbol)
+		if err != nil {
+			logx.Error(err)
+		} else {
+			t.journal = j
+			t.journalFile = journal.FileName(jc.Dir, t.symbol)
+		}
+	}
+	if t.snapshotConf.Dir != "" {
+		snap, err := snapshot.Latest(t.snapshotConf, t.symbol, 0)
+		if err != nil {
+			logx.Error(err)
+		}
+		if snap != nil && t.restore(snap) == nil {
+			if t.journal != nil && t.journal.LastSeq() >= snap.Seq {
+				t.catchUp(snap.Seq)
+			} else {
+				t.reconcile()
+			}
+			return
+		}
+	}
+	if t.journal != nil && t.journal.LastSeq() > 0 {
+		t.catchUp(0)
+		return
+	}
+	t.initData()
+}
+
+// initBook 创建空的买卖盘口和限价队列
+func (t *CoinTrade) initBook() {
 	t.buyTradePlate = NewTradePlate(t.symbol, model.BUY)
 	t.sellTradePlate = NewTradePlate(t.symbol, model.SELL)
 	t.buyLimitQueue = &LimitPriceQueue{}
 	t.sellLimitQueue = &LimitPriceQueue{}
-	t.initData()
 }
 
 // CoinTrade 单个交易对的撮合引擎
 // 负责处理特定交易对的所有订单撮合逻辑
+// 下面的队列和盘口只由 run 协程读写 外部通过 inbox 投递指令
 type CoinTrade struct {
-	symbol          string                // 交易对符号，如 "BTC/USDT"
-	buyMarketQueue  TradeTimeQueue        // 市价买单队列，按时间排序
-	bmMux           sync.RWMutex          // 市价买单队列的读写锁
-	sellMarketQueue TradeTimeQueue        // 市价卖单队列，按时间排序
-	smMux           sync.RWMutex          // 市价卖单队列的读写锁
-	buyLimitQueue   *LimitPriceQueue      // 限价买单队列，按价格从高到低排序
-	sellLimitQueue  *LimitPriceQueue      // 限价卖单队列，按价格从低到高排序
-	buyTradePlate   *TradePlate           // 买盘盘口信息，显示当前可成交的买单
-	sellTradePlate  *TradePlate           // 卖盘盘口信息，显示当前可成交的卖单
-	kafkaClient     *database.KafkaClient // Kafka客户端，用于发送交易消息
-	db              *msdb.MsDB            // 数据库连接，用于持久化交易数据
+	symbol          string                 // 交易对符号，如 "BTC/USDT"
+	inbox           chan *command          // 指令收件箱，有界，满了发送方阻塞
+	pendingCancel   map[string]int64       // 撤单先于订单到达引擎时 记下订单号和撤单时间 订单到达后直接撤掉
+	buyMarketQueue  TradeTimeQueue         // 市价买单队列，按时间排序
+	sellMarketQueue TradeTimeQueue         // 市价卖单队列，按时间排序
+	buyLimitQueue   *LimitPriceQueue       // 限价买单队列，按价格从高到低排序
+	sellLimitQueue  *LimitPriceQueue       // 限价卖单队列，按价格从低到高排序
+	buyTradePlate   *TradePlate            // 买盘盘口信息，显示当前可成交的买单
+	sellTradePlate  *TradePlate            // 卖盘盘口信息，显示当前可成交的卖单
+	kafkaClient     *database.KafkaClient  // Kafka客户端，用于发送交易消息
+	db              *msdb.MsDB             // 数据库连接，用于持久化交易数据
+	journal         *journal.Journal       // 撮合日志，为空不记录
+	journalFile     string                 // 撮合日志文件
+	seq             int64                  // 最后一条日志的序号
+	cmdSeq          int64                  // 当前输入指令的序号，成交id由它生成
+	now             int64                  // 当前输入指令的时间，代替time.Now 保证回放结果一致
+	fills           int                    // 当前输入指令产生的成交笔数
+	replay          func(*journal.Entry)   // 回放时输出事件交给它 不写日志也不发kafka
+	snapshotConf    snapshot.Config        // 快照配置
+	snapshotSeq     int64                  // 最后一次快照的序号
+	expiring        []*model.ExchangeOrder // GTD订单 按过期时间排序 成交或者撤掉的不会马上删 过期时再确认
+	aging           []*model.ExchangeOrder // 交易对配置了委托超时 挂单按委托时间排序 和expiring一样过期时再确认
+	conf            CoinConfig             // 交易对配置
+	breaker         breaker                // 熔断状态
+	listener        TradeListener          // 成交价回调，回放时不调用
 }
 
 // TradeTimeQueue 基于时间的订单队列
@@ -120,14 +198,13 @@ func (t TradeTimeQueue) Swap(i, j int) {
 // LimitPriceQueue 限价单队列
 // 用于限价单的排序和管理，包含价格和对应价格的订单列表
 type LimitPriceQueue struct {
-	mux  sync.RWMutex // 保护队列并发访问的读写锁
-	list TradeQueue   // 按价格排序的订单队列
+	list TradeQueue // 按价格排序的订单队列
 }
 
 // LimitPriceMap 价格档位映射
 // 记录特定价格档位的所有订单
 type LimitPriceMap struct {
-	price float64                // 价格档位
+	price decimal.Decimal        // 价格档位
 	list  []*model.ExchangeOrder // 该价格档位的所有订单
 }
 
@@ -144,7 +221,7 @@ func (t TradeQueue) Len() int {
 // 买单队列：价格高的优先成交
 // 卖单队列：价格低的优先成交
 func (t TradeQueue) Less(i, j int) bool {
-	return t[i].price > t[j].price
+	return t[i].price.GreaterThan(t[j].price)
 }
 
 // Swap 交换队列中的两个价格档位
@@ -152,6 +229,24 @@ func (t TradeQueue) Swap(i, j int) {
 	t[i], t[j] = t[j], t[i]
 }
 
+// better 买单价格高的在前 卖单价格低的在前
+func better(direction int, a decimal.Decimal, b decimal.Decimal) bool {
+	if direction == model.BUY {
+		return a.GreaterThan(b)
+	}
+	return a.LessThan(b)
+}
+
+// insert 新的价格档位按价格插入 撮合从第一个档位开始 队列一直要保持有序
+func (q *LimitPriceQueue) insert(lpm *LimitPriceMap, direction int) {
+	i := sort.Search(len(q.list), func(i int) bool {
+		return better(direction, lpm.price, q.list[i].price)
+	})
+	q.list = append(q.list, nil)
+	copy(q.list[i+1:], q.list[i:])
+	q.list[i] = lpm
+}
+
 // TradePlate 交易盘口
 // 用于维护和展示当前市场的买卖盘深度信息
 // 包含价格档位、数量、方向等信息
@@ -160,29 +255,24 @@ type TradePlate struct {
 	Symbol    string            // 交易对符号，如 "BTC/USDT"
 	direction int               // 方向：1-买盘，2-卖盘
 	maxDepth  int               // 最大深度，控制显示多少档
-	mux       sync.RWMutex      // 读写锁，保护并发访问
 }
 
 // TradePlateItem 盘口档位信息
 // 记录每个价格档位的价格和数量
 type TradePlateItem struct {
-	Price  float64 `json:"price"`  // 价格档位
-	Amount float64 `json:"amount"` // 该价格档位的总数量
+	Price  decimal.Decimal `json:"price"`  // 价格档位
+	Amount decimal.Decimal `json:"amount"` // 该价格档位的总数量
 }
 
 // GetItems 获取盘口信息
 // 返回当前盘口的所有价格档位信息
 func (p *TradePlate) GetItems() []*TradePlateItem {
-	p.mux.RLock()
-	defer p.mux.RUnlock()
 	return p.Items
 }
 
 // Clear 清空盘口信息
 // 用于重置或初始化盘口
 func (p *TradePlate) Clear() {
-	p.mux.Lock()
-	defer p.mux.Unlock()
 	p.Items = make([]*TradePlateItem, 0)
 }
 
@@ -190,15 +280,12 @@ func (p *TradePlate) Clear() {
 // 用于订单成交后更新盘口数量
 // price: 价格档位
 // amount: 要更新的数量
-func (p *TradePlate) UpdateAmount(price float64, amount float64) {
-	p.mux.Lock()
-	defer p.mux.Unlock()
-
+func (p *TradePlate) UpdateAmount(price decimal.Decimal, amount decimal.Decimal) {
 	for _, v := range p.Items {
-		if v.Price == price {
-			v.Amount = op.FloorFloat(v.Amount-amount, 8)
+		if v.Price.Equal(price) {
+			v.Amount = v.Amount.Sub(amount)
 			// 如果数量为0，从盘口中移除该价格档位
-			if v.Amount <= 0 {
+			if v.Amount.Sign() <= 0 {
 				// TODO: 实现移除逻辑
 			}
 			return
@@ -221,10 +308,10 @@ func NewTradePlate(symbol string, direction int) *TradePlate {
 // 包含盘口的方向、最大/最小数量、最高/最低价格等信息
 type TradePlateResult struct {
 	Direction    string            `json:"direction"`    // 方向（买/卖）
-	MaxAmount    float64           `json:"maxAmount"`    // 最大数量
-	MinAmount    float64           `json:"minAmount"`    // 最小数量
-	HighestPrice float64           `json:"highestPrice"` // 最高价格
-	LowestPrice  float64           `json:"lowestPrice"`  // 最低价格
+	MaxAmount    decimal.Decimal   `json:"maxAmount"`    // 最大数量
+	MinAmount    decimal.Decimal   `json:"minAmount"`    // 最小数量
+	HighestPrice decimal.Decimal   `json:"highestPrice"` // 最高价格
+	LowestPrice  decimal.Decimal   `json:"lowestPrice"`  // 最低价格
 	Symbol       string            `json:"symbol"`       // 交易对符号
 	Items        []*TradePlateItem `json:"items"`        // 盘口档位信息列表
 }
@@ -258,18 +345,23 @@ func (p *TradePlate) Result(num int) *TradePlateResult {
 	result.HighestPrice = p.getHighestPrice()
 	result.LowestPrice = p.getLowestPrice()
 	result.Symbol = p.Symbol
-	result.Items = p.Items[:num]
+	// 复制一份 结果会被撮合协程以外的地方读取
+	result.Items = make([]*TradePlateItem, num)
+	for i, v := range p.Items[:num] {
+		item := *v
+		result.Items[i] = &item
+	}
 	return result
 }
 
 // getMaxAmount 获取盘口最大数量
-func (p *TradePlate) getMaxAmount() float64 {
+func (p *TradePlate) getMaxAmount() decimal.Decimal {
 	if len(p.Items) <= 0 {
-		return 0
+		return decimal.Zero
 	}
-	var amount float64 = 0
+	amount := decimal.Zero
 	for _, v := range p.Items {
-		if v.Amount > amount {
+		if v.Amount.GreaterThan(amount) {
 			amount = v.Amount
 		}
 	}
@@ -277,13 +369,13 @@ func (p *TradePlate) getMaxAmount() float64 {
 }
 
 // getMinAmount 获取盘口最小数量
-func (p *TradePlate) getMinAmount() float64 {
+func (p *TradePlate) getMinAmount() decimal.Decimal {
 	if len(p.Items) <= 0 {
-		return 0
+		return decimal.Zero
 	}
-	var amount float64 = p.Items[0].Amount
+	amount := p.Items[0].Amount
 	for _, v := range p.Items {
-		if v.Amount < amount {
+		if v.Amount.LessThan(amount) {
 			amount = v.Amount
 		}
 	}
@@ -291,13 +383,13 @@ func (p *TradePlate) getMinAmount() float64 {
 }
 
 // getHighestPrice 获取盘口最高价格
-func (p *TradePlate) getHighestPrice() float64 {
+func (p *TradePlate) getHighestPrice() decimal.Decimal {
 	if len(p.Items) <= 0 {
-		return 0
+		return decimal.Zero
 	}
-	var price float64 = 0
+	price := decimal.Zero
 	for _, v := range p.Items {
-		if v.Price > price {
+		if v.Price.GreaterThan(price) {
 			price = v.Price
 		}
 	}
@@ -305,13 +397,13 @@ func (p *TradePlate) getHighestPrice() float64 {
 }
 
 // getLowestPrice 获取盘口最低价格
-func (p *TradePlate) getLowestPrice() float64 {
+func (p *TradePlate) getLowestPrice() decimal.Decimal {
 	if len(p.Items) <= 0 {
-		return 0
+		return decimal.Zero
 	}
-	var price float64 = p.Items[0].Price
+	price := p.Items[0].Price
 	for _, v := range p.Items {
-		if v.Price < price {
+		if v.Price.LessThan(price) {
 			price = v.Price
 		}
 	}
@@ -320,12 +412,12 @@ func (p *TradePlate) getLowestPrice() float64 {
 
 // Remove 从盘口移除订单
 // order: 要移除的订单
-// amount: 要移除的数量
-func (p *TradePlate) Remove(order *model.ExchangeOrder, amount float64) {
+// amount: 要移除的数量 冰山单不能超过显示的部分
+func (p *TradePlate) Remove(order *model.ExchangeOrder, amount decimal.Decimal) {
 	for i, v := range p.Items {
-		if v.Price == order.Price {
-			v.Amount = op.SubFloor(v.Amount, amount, 8)
-			if v.Amount <= 0 {
+		if v.Price.Equal(order.Price) {
+			v.Amount = v.Amount.Sub(amount)
+			if v.Amount.Sign() <= 0 {
 				p.Items = append(p.Items[:i], p.Items[i+1:]...)
 			}
 			break
@@ -352,96 +444,90 @@ func (c *CoinTradeFactory) GetCoinTrade(symbol string) *CoinTrade {
 }
 
 func (t *CoinTrade) initData() {
-	orderDomain := domain.NewExchangeOrderDomain(t.db)
 	//应该去查询对应symbol的订单 将其赋值到coinTrade里面的各个队列中，同时加入买卖盘
-	exchangeOrders, err := orderDomain.FindOrderListBySymbol(context.Background(), t.symbol, model.Trading)
+	exchangeOrders, err := t.findTradingOrders()
 	if err != nil {
 		logx.Error(err)
 		return
 	}
 	for _, v := range exchangeOrders {
-		if v.Type == model.MarketPrice {
-			if v.Direction == model.BUY {
-				t.bmMux.Lock()
-				t.buyMarketQueue = append(t.buyMarketQueue, v)
-				t.bmMux.Unlock()
-				continue
-			}
-			if v.Direction == model.SELL {
-				t.smMux.Lock()
-				t.sellMarketQueue = append(t.sellMarketQueue, v)
-				t.smMux.Unlock()
-				continue
-			}
-			//市价单 不进入买卖盘的
-		} else if v.Type == model.LimitPrice {
-			if v.Direction == model.BUY {
-				t.buyLimitQueue.mux.Lock()
-				//deal
-				isPut := false
-				for _, o := range t.buyLimitQueue.list {
-					if o.price == v.Price {
-						o.list = append(o.list, v)
-						isPut = true
-						break
-					}
-				}
-				if !isPut {
-					lpm := &LimitPriceMap{
-						price: v.Price,
-						list:  []*model.ExchangeOrder{v},
-					}
-					t.buyLimitQueue.list = append(t.buyLimitQueue.list, lpm)
-				}
-				t.buyTradePlate.Add(v)
-				t.buyLimitQueue.mux.Unlock()
-			} else if v.Direction == model.SELL {
-				t.sellLimitQueue.mux.Lock()
-				//deal
-				isPut := false
-				for _, o := range t.sellLimitQueue.list {
-					if o.price == v.Price {
-						o.list = append(o.list, v)
-						isPut = true
-						break
-					}
-				}
-				if !isPut {
-					lpm := &LimitPriceMap{
-						price: v.Price,
-						list:  []*model.ExchangeOrder{v},
-					}
-					t.sellLimitQueue.list = append(t.sellLimitQueue.list, lpm)
-				}
-				t.sellTradePlate.Add(v)
-				t.sellLimitQueue.mux.Unlock()
-			}
-		}
+		// 记到日志里 以后就可以从日志恢复 不用再查数据库
+		t.input(journal.TypeLoad, v)
+		t.load(v)
 	}
-	//排序
-	sort.Sort(t.buyMarketQueue)
-	sort.Sort(t.sellMarketQueue)
-	sort.Sort(t.buyLimitQueue.list)                //从高到低
-	sort.Sort(sort.Reverse(t.sellLimitQueue.list)) //从低到高
 	if len(exchangeOrders) > 0 {
-		t.sendTradPlateMsg(t.buyTradePlate)
-		t.sendTradPlateMsg(t.sellTradePlate)
+		t.publishPlate()
 	}
 }
 
-// Trade 处理新订单
+// load 挂单直接放进队列和盘口 不参与撮合
+func (t *CoinTrade) load(order *model.ExchangeOrder) {
+	t.addExpiring(order)
+	if order.Type == model.MarketPrice {
+		t.addMarketQueue(order)
+		return
+	}
+	t.addLimitQueue(order)
+	if order.Direction == model.BUY {
+		sort.Sort(t.buyLimitQueue.list) //从高到低
+	} else {
+		sort.Sort(sort.Reverse(t.sellLimitQueue.list)) //从低到高
+	}
+}
+
+// trade 处理新订单 只在撮合协程中调用
 // 根据订单类型（市价/限价）和方向（买/卖）进行撮合
 // exchangeOrder: 要处理的订单
-func (t *CoinTrade) Trade(exchangeOrder *model.ExchangeOrder) {
+func (t *CoinTrade) trade(exchangeOrder *model.ExchangeOrder) {
+	// 已经过期的GTD订单先撤掉 不能再参与撮合
+	t.expire(t.now)
+	// 集合竞价结束了先按一个价格撮合掉交叉的部分
+	t.uncross()
+	// 集合竞价期间OCO止损单不接止盈单的资金 它没有自己的冻结资金 数量改成0撤掉
+	if t.auctioning() && exchangeOrder.IsOcoStop() {
+		delete(t.pendingCancel, exchangeOrder.OrderId)
+		exchangeOrder.Amount = decimal.Zero
+		t.sendCanceledOrder(exchangeOrder, model.CancelAuction)
+		return
+	}
+	// OCO止损单先接过止盈单的资金 后面被撤单也能按接过来的数量解冻
+	if exchangeOrder.IsOcoStop() && !t.link(exchangeOrder) {
+		delete(t.pendingCancel, exchangeOrder.OrderId)
+		return
+	}
+	if _, ok := t.pendingCancel[exchangeOrder.OrderId]; ok {
+		delete(t.pendingCancel, exchangeOrder.OrderId)
+		t.sendCanceledOrder(exchangeOrder, model.CancelByUser)
+		return
+	}
+	if exchangeOrder.TimeInForce == model.GTD && exchangeOrder.ExpireTime <= t.now {
+		t.sendCanceledOrder(exchangeOrder, model.CancelExpired)
+		return
+	}
+	// 集合竞价期间只挂单不撮合
+	if t.auctioning() {
+		t.collect(exchangeOrder)
+		return
+	}
 	// 根据订单方向选择对应的队列
 	var limitPriceList *LimitPriceQueue
-	var marketPriceList TradeTimeQueue
+	var marketPriceList *TradeTimeQueue
 	if exchangeOrder.Direction == model.BUY {
 		limitPriceList = t.sellLimitQueue
-		marketPriceList = t.sellMarketQueue
+		marketPriceList = &t.sellMarketQueue
 	} else {
 		limitPriceList = t.buyLimitQueue
-		marketPriceList = t.buyMarketQueue
+		marketPriceList = &t.buyMarketQueue
+	}
+	// FOK 不能全部成交就整单撤掉 盘口不动
+	if exchangeOrder.TimeInForce == model.FOK && !t.canFill(exchangeOrder, limitPriceList, *marketPriceList) {
+		t.sendCanceledOrder(exchangeOrder, model.CancelFOK)
+		return
+	}
+	// post only 会立即成交就拒绝 或者改价让开
+	if exchangeOrder.PostOnly != model.PostOnlyOff && !t.postOnly(exchangeOrder, limitPriceList, *marketPriceList) {
+		t.sendCanceledOrder(exchangeOrder, model.CancelPostOnly)
+		return
 	}
 
 	// 根据订单类型进行撮合
@@ -455,69 +541,234 @@ func (t *CoinTrade) Trade(exchangeOrder *model.ExchangeOrder) {
 		if exchangeOrder.Status == model.Trading {
 			t.matchLimitPriceWithMP(marketPriceList, exchangeOrder)
 		}
-		// 如果仍未完全成交，加入限价队列
-		if exchangeOrder.Status == model.Trading {
-			t.addLimitQueue(exchangeOrder)
-			if exchangeOrder.Direction == model.BUY {
-				t.sendTradPlateMsg(t.buyTradePlate)
-			} else {
-				t.sendTradPlateMsg(t.sellTradePlate)
+	}
+	if exchangeOrder.IsOcoLimit() && exchangeOrder.TradedAmount.Sign() > 0 {
+		t.sendFilledOrder(exchangeOrder)
+	}
+	if exchangeOrder.Status != model.Trading {
+		return
+	}
+	// 没有全部成交 IOC剩下的部分撤掉
+	// FOK前面检查过能全部成交 走到这里说明和撮合的结果不一致 同样撤掉 不能挂到盘口上
+	switch exchangeOrder.TimeInForce {
+	case model.IOC:
+		t.sendCanceledOrder(exchangeOrder, model.CancelIOC)
+		return
+	case model.FOK:
+		logx.Errorf("FOK订单没有全部成交,symbol=%s,orderId=%s", t.symbol, exchangeOrder.OrderId)
+		t.sendCanceledOrder(exchangeOrder, model.CancelFOK)
+		return
+	}
+	// GTC GTD 挂到盘口上
+	if exchangeOrder.Type == model.MarketPrice {
+		t.addMarketQueue(exchangeOrder)
+	} else {
+		t.addLimitQueue(exchangeOrder)
+		if exchangeOrder.Direction == model.BUY {
+			t.sendTradPlateMsg(t.buyTradePlate)
+		} else {
+			t.sendTradPlateMsg(t.sellTradePlate)
+		}
+	}
+	t.addExpiring(exchangeOrder)
+}
+
+// postOnly 检查post only订单会不会立即成交 返回false表示要拒绝
+// 会成交并且允许改价时 买单改成卖一价减一个最小价位 卖单改成买一价加一个最小价位
+func (t *CoinTrade) postOnly(order *model.ExchangeOrder, lpList *LimitPriceQueue, mpList TradeTimeQueue) bool {
+	// 对手方有市价单 限价单一进来就会和它成交 改价也躲不开
+	for _, matchOrder := range mpList {
+		if matchOrder.MemberId != order.MemberId && matchOrder.Amount.Sub(matchOrder.TradedAmount).Sign() > 0 {
+			return false
+		}
+	}
+	best, ok := bestPrice(lpList, order)
+	if !ok {
+		return true
+	}
+	if order.Direction == model.BUY && order.Price.LessThan(best) {
+		return true
+	}
+	if order.Direction == model.SELL && order.Price.GreaterThan(best) {
+		return true
+	}
+	if order.PostOnly != model.PostOnlyReprice {
+		return false
+	}
+	price := best.Add(t.tick())
+	if order.Direction == model.BUY {
+		price = best.Sub(t.tick())
+	}
+	if price.Sign() <= 0 {
+		return false
+	}
+	if order.OriginalPrice.IsZero() {
+		order.OriginalPrice = order.Price
+	}
+	order.Price = price
+	t.sendRepricedOrder(order)
+	return true
+}
+
+// bestPrice 对手盘的最优价 自己的订单不算 撮合时也会跳过
+// 价格档位不一定是排好序的 所以要全部看一遍
+func bestPrice(lpList *LimitPriceQueue, order *model.ExchangeOrder) (decimal.Decimal, bool) {
+	var best decimal.Decimal
+	found := false
+	for _, v := range lpList.list {
+		for _, matchOrder := range v.list {
+			if matchOrder.MemberId == order.MemberId || matchOrder.Amount.Sub(matchOrder.TradedAmount).Sign() <= 0 {
+				continue
+			}
+			if !found ||
+				(order.Direction == model.BUY && matchOrder.Price.LessThan(best)) ||
+				(order.Direction == model.SELL && matchOrder.Price.GreaterThan(best)) {
+				best = matchOrder.Price
+				found = true
 			}
 		}
 	}
+	return best, found
 }
 
-// matchLimitPriceWithMP 限价单与市价单撮合
-// mpList: 市价单队列
-// focusedOrder: 当前要撮合的限价单
-func (t *CoinTrade) matchLimitPriceWithMP(mpList TradeTimeQueue, focusedOrder *model.ExchangeOrder) {
-	var delOrders []string
+// canFill FOK订单能不能全部成交 只看不改 规则和撮合一样
+func (t *CoinTrade) canFill(order *model.ExchangeOrder, lpList *LimitPriceQueue, mpList TradeTimeQueue) bool {
+	// 市价买的数量是金额 按对手价换算
+	marketBuy := order.Type == model.MarketPrice && order.Direction == model.BUY
+	need := order.Amount.Sub(order.TradedAmount)
+	if marketBuy {
+		need = order.Amount.Sub(order.Turnover)
+	}
+	for _, v := range lpList.list {
+		for _, matchOrder := range v.list {
+			if order.Type == model.LimitPrice {
+				if order.Direction == model.BUY && order.Price.LessThan(matchOrder.Price) {
+					break
+				}
+				if order.Direction == model.SELL && order.Price.GreaterThan(matchOrder.Price) {
+					break
+				}
+			}
+			available := matchOrder.Amount.Sub(matchOrder.TradedAmount)
+			if available.Sign() <= 0 {
+				continue
+			}
+			// 自己的订单 只有撤掉盘口上的订单时新订单还能继续成交
+			if matchOrder.MemberId == order.MemberId {
+				if t.conf.StpMode != model.StpCancelOldest {
+					return false
+				}
+				continue
+			}
+			if marketBuy {
+				available = matchOrder.Price.Mul(available).Truncate(8)
+			}
+			if available.GreaterThanOrEqual(need) {
+				return true
+			}
+			need = need.Sub(available)
+		}
+	}
+	if order.Type == model.MarketPrice {
+		return false
+	}
+	// 限价单还可以和市价单成交
 	for _, matchOrder := range mpList {
-		// 跳过自己的订单，防止自成交
-		if matchOrder.MemberId == focusedOrder.MemberId {
+		available := matchOrder.Amount.Sub(matchOrder.TradedAmount)
+		if available.Sign() <= 0 {
 			continue
 		}
+		if matchOrder.MemberId == order.MemberId {
+			if t.conf.StpMode != model.StpCancelOldest {
+				return false
+			}
+			continue
+		}
+		if available.GreaterThanOrEqual(need) {
+			return true
+		}
+		need = need.Sub(available)
+	}
+	return false
+}
+
+// matchLimitPriceWithMP 限价单与市价单撮合
+// mpList: 市价单队列 传指针 删除已完成的订单要作用到引擎自己的队列上
+// focusedOrder: 当前要撮合的限价单
+func (t *CoinTrade) matchLimitPriceWithMP(mpList *TradeTimeQueue, focusedOrder *model.ExchangeOrder) {
+	var delOrders []string
+	var completeOrders []*model.ExchangeOrder
+	var canceledOrders []*model.ExchangeOrder
+	var trades []*model.ExchangeTrade
+	for _, matchOrder := range *mpList {
 		price := focusedOrder.Price
 		// 计算可交易的数量
-		matchAmount := op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8)
-		if matchAmount <= 0 {
+		matchAmount := matchOrder.Amount.Sub(matchOrder.TradedAmount)
+		if matchAmount.Sign() <= 0 {
 			continue
 		}
-		focusedAmount := op.SubFloor(focusedOrder.Amount, focusedOrder.TradedAmount, 8)
-		if matchAmount >= focusedAmount {
+		// 自己的订单 按自成交保护模式撤单或者减数量
+		if matchOrder.MemberId == focusedOrder.MemberId {
+			cancelTaker, cancelMaker := t.selfTrade(focusedOrder, matchOrder, false)
+			if cancelMaker {
+				matchOrder.Status = model.Canceled
+				delOrders = append(delOrders, matchOrder.OrderId)
+				canceledOrders = append(canceledOrders, matchOrder)
+			}
+			if cancelTaker {
+				focusedOrder.Status = model.Canceled
+				canceledOrders = append(canceledOrders, focusedOrder)
+				break
+			}
+			continue
+		}
+		focusedAmount := focusedOrder.Amount.Sub(focusedOrder.TradedAmount)
+		if matchAmount.GreaterThanOrEqual(focusedAmount) {
 			// 完全成交
-			turnover := op.MulFloor(price, focusedAmount, 8)
-			matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, focusedAmount, 8)
-			matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
-			if op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8) <= 0 {
+			turnover := price.Mul(focusedAmount).Truncate(8)
+			trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, focusedAmount, turnover))
+			matchOrder.TradedAmount = matchOrder.TradedAmount.Add(focusedAmount)
+			matchOrder.Turnover = matchOrder.Turnover.Add(turnover)
+			if matchOrder.Amount.Sub(matchOrder.TradedAmount).Sign() <= 0 {
 				matchOrder.Status = model.Completed
 				delOrders = append(delOrders, matchOrder.OrderId)
+				completeOrders = append(completeOrders, matchOrder)
 			}
-			focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, focusedAmount, 8)
-			focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+			focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(focusedAmount)
+			focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 			focusedOrder.Status = model.Completed
+			completeOrders = append(completeOrders, focusedOrder)
 			break
 		} else {
 			// 部分成交
-			turnover := op.MulFloor(price, matchAmount, 8)
-			matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, matchAmount, 8)
-			matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
+			turnover := price.Mul(matchAmount).Truncate(8)
+			trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, matchAmount, turnover))
+			matchOrder.TradedAmount = matchOrder.TradedAmount.Add(matchAmount)
+			matchOrder.Turnover = matchOrder.Turnover.Add(turnover)
 			matchOrder.Status = model.Completed
 			delOrders = append(delOrders, matchOrder.OrderId)
-			focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, matchAmount, 8)
-			focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+			completeOrders = append(completeOrders, matchOrder)
+			focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(matchAmount)
+			focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 			continue
 		}
 	}
 	// 删除已完成的订单
 	for _, orderId := range delOrders {
-		for index, matchOrder := range mpList {
+		for index, matchOrder := range *mpList {
 			if matchOrder.OrderId == orderId {
-				mpList = append(mpList[:index], mpList[index+1:]...)
+				*mpList = append((*mpList)[:index], (*mpList)[index+1:]...)
 				break
 			}
 		}
 	}
+	t.sendTrade(trades)
+	for _, v := range completeOrders {
+		t.sendCompleteOrder(v)
+	}
+	for _, v := range canceledOrders {
+		t.sendCanceledOrder(v, model.CancelSTP)
+	}
 }
 
 // matchLimitPriceWithLP 限价单与限价单撮合
@@ -528,75 +779,94 @@ func (t *CoinTrade) matchLimitPriceWithMP(mpList TradeTimeQueue, focusedOrder *m
 // 这样可以避免重复发送通知
 
 func (t *CoinTrade) matchLimitPriceWithLP(lpList *LimitPriceQueue, focusedOrder *model.ExchangeOrder) {
-	lpList.mux.Lock()
-	defer lpList.mux.Unlock()
 	var delOrders []string
 	buyNotify := false
 	sellNotify := false
 	var completeOrders []*model.ExchangeOrder
+	var canceledOrders []*model.ExchangeOrder
+	var trades []*model.ExchangeTrade
 
 	// 遍历限价队列
 	for _, v := range lpList.list {
-		for _, matchOrder := range v.list {
-			// 跳过自己的订单
-			if matchOrder.MemberId == focusedOrder.MemberId {
-				continue
-			}
+		// 已经全部成交或者被自成交保护撤掉 后面的价格档位不用再看
+		if focusedOrder.Status != model.Trading {
+			break
+		}
+		// 冰山单补上显示的部分以后会排到档位的最后 所以按下标遍历
+		for i := 0; i < len(v.list); i++ {
+			matchOrder := v.list[i]
 			// 检查价格是否满足成交条件
 			if model.BUY == focusedOrder.Direction {
-				if focusedOrder.Price < matchOrder.Price {
+				if focusedOrder.Price.LessThan(matchOrder.Price) {
 					break
 				}
 			}
 			if model.SELL == focusedOrder.Direction {
-				if focusedOrder.Price > matchOrder.Price {
+				if focusedOrder.Price.GreaterThan(matchOrder.Price) {
 					break
 				}
 			}
 			// 计算可交易数量
 			price := matchOrder.Price
-			matchAmount := op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8)
-			if matchAmount <= 0 {
+			matchAmount := matchOrder.Visible()
+			if matchAmount.Sign() <= 0 {
 				continue
 			}
-			focusedAmount := op.SubFloor(focusedOrder.Amount, focusedOrder.TradedAmount, 8)
-			if matchAmount >= focusedAmount {
+			// 自己的订单 按自成交保护模式撤单或者减数量
+			if matchOrder.MemberId == focusedOrder.MemberId {
+				cancelTaker, cancelMaker := t.selfTrade(focusedOrder, matchOrder, true)
+				if cancelMaker {
+					t.dropMaker(matchOrder)
+					delOrders = append(delOrders, matchOrder.OrderId)
+					canceledOrders = append(canceledOrders, matchOrder)
+				}
+				if matchOrder.Direction == model.BUY {
+					buyNotify = true
+				} else {
+					sellNotify = true
+				}
+				if cancelTaker {
+					focusedOrder.Status = model.Canceled
+					canceledOrders = append(canceledOrders, focusedOrder)
+					break
+				}
+				continue
+			}
+			focusedAmount := focusedOrder.Amount.Sub(focusedOrder.TradedAmount)
+			if matchAmount.GreaterThanOrEqual(focusedAmount) {
 				// 完全成交
-				turnover := op.MulFloor(price, focusedAmount, 8)
-				matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, focusedAmount, 8)
-				matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
-				if op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8) <= 0 {
-					matchOrder.Status = model.Completed
+				turnover := price.Mul(focusedAmount).Truncate(8)
+				trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, focusedAmount, turnover))
+				if t.fillMaker(v, i, matchOrder, focusedAmount, turnover) {
 					delOrders = append(delOrders, matchOrder.OrderId)
 					completeOrders = append(completeOrders, matchOrder)
 				}
-				focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, focusedAmount, 8)
-				focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+				focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(focusedAmount)
+				focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 				focusedOrder.Status = model.Completed
 				completeOrders = append(completeOrders, focusedOrder)
 				if matchOrder.Direction == model.BUY {
-					t.buyTradePlate.Remove(matchOrder, focusedAmount)
 					buyNotify = true
 				} else {
-					t.sellTradePlate.Remove(matchOrder, focusedAmount)
 					sellNotify = true
 				}
 				break
 			} else {
 				// 部分成交
-				turnover := op.MulFloor(price, matchAmount, 8)
-				matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, matchAmount, 8)
-				matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
-				matchOrder.Status = model.Completed
-				completeOrders = append(completeOrders, matchOrder)
-				delOrders = append(delOrders, matchOrder.OrderId)
-				focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, matchAmount, 8)
-				focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+				turnover := price.Mul(matchAmount).Truncate(8)
+				trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, matchAmount, turnover))
+				if t.fillMaker(v, i, matchOrder, matchAmount, turnover) {
+					delOrders = append(delOrders, matchOrder.OrderId)
+					completeOrders = append(completeOrders, matchOrder)
+				} else {
+					// 只有冰山单会走到这里 补了新的显示数量排到了最后 当前位置已经是下一个订单
+					i--
+				}
+				focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(matchAmount)
+				focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 				if matchOrder.Direction == model.BUY {
-					t.buyTradePlate.Remove(matchOrder, matchAmount)
 					buyNotify = true
 				} else {
-					t.sellTradePlate.Remove(matchOrder, matchAmount)
 					sellNotify = true
 				}
 				continue
@@ -621,81 +891,125 @@ func (t *CoinTrade) matchLimitPriceWithLP(lpList *LimitPriceQueue, focusedOrder
 	if sellNotify {
 		t.sendTradPlateMsg(t.sellTradePlate)
 	}
+	t.sendTrade(trades)
 	for _, v := range completeOrders {
 		t.sendCompleteOrder(v)
 	}
+	for _, v := range canceledOrders {
+		t.sendCanceledOrder(v, model.CancelSTP)
+	}
 }
 
 // matchMarketPriceWithLP 市价单与限价单撮合
 // lpList: 限价单队列
 // focusedOrder: 当前要撮合的市价单
 func (t *CoinTrade) matchMarketPriceWithLP(lpList *LimitPriceQueue, focusedOrder *model.ExchangeOrder) {
-	// 加写锁，保证并发安全
-	lpList.mux.Lock()
-	defer lpList.mux.Unlock()
-
 	var delOrders []string
 	buyNotify := false
 	sellNotify := false
+	var completeOrders []*model.ExchangeOrder
+	var canceledOrders []*model.ExchangeOrder
+	var trades []*model.ExchangeTrade
+	// 市价单能吃到的最远价格 按第一笔成交价算
+	var bound decimal.Decimal
+	bounded := false
+	swept := false
 
 	// 遍历限价队列
 	for _, v := range lpList.list {
-		for _, matchOrder := range v.list {
-			// 跳过自己的订单
-			if matchOrder.MemberId == focusedOrder.MemberId {
-				continue
-			}
+		// 已经全部成交或者被自成交保护撤掉 后面的价格档位不用再看
+		if focusedOrder.Status != model.Trading || swept {
+			break
+		}
+		// 冰山单补上显示的部分以后会排到档位的最后 所以按下标遍历
+		for i := 0; i < len(v.list); i++ {
+			matchOrder := v.list[i]
 
 			// 获取对方订单价格
 			price := matchOrder.Price
+			if bounded && ((focusedOrder.Direction == model.BUY && price.GreaterThan(bound)) ||
+				(focusedOrder.Direction == model.SELL && price.LessThan(bound))) {
+				swept = true
+				break
+			}
 
 			// 计算可交易数量
-			matchAmount := op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8)
-			if matchAmount <= 0 {
+			matchAmount := matchOrder.Visible()
+			if matchAmount.Sign() <= 0 {
 				continue
 			}
 
-			focusedAmount := op.SubFloor(focusedOrder.Amount, focusedOrder.TradedAmount, 8)
+			// 自己的订单 按自成交保护模式撤单或者减数量
+			if matchOrder.MemberId == focusedOrder.MemberId {
+				cancelTaker, cancelMaker := t.selfTrade(focusedOrder, matchOrder, true)
+				if cancelMaker {
+					t.dropMaker(matchOrder)
+					delOrders = append(delOrders, matchOrder.OrderId)
+					canceledOrders = append(canceledOrders, matchOrder)
+				}
+				if matchOrder.Direction == model.BUY {
+					buyNotify = true
+				} else {
+					sellNotify = true
+				}
+				if cancelTaker {
+					focusedOrder.Status = model.Canceled
+					canceledOrders = append(canceledOrders, focusedOrder)
+					break
+				}
+				continue
+			}
+
+			focusedAmount := focusedOrder.Amount.Sub(focusedOrder.TradedAmount)
 
 			// 市价买单需要根据价格换算数量
 			if focusedOrder.Direction == model.BUY {
-				focusedAmount = op.DivFloor(op.SubFloor(focusedOrder.Amount, focusedOrder.Turnover, 8), price, 8)
+				focusedAmount = focusedOrder.Amount.Sub(focusedOrder.Turnover).Div(price, 8, decimal.RoundDown)
+				// 剩下的钱买不到最小单位 不能成交0个 直接完成 剩下的钱由订单结束时解冻
+				if focusedAmount.Sign() <= 0 {
+					focusedOrder.Status = model.Completed
+					completeOrders = append(completeOrders, focusedOrder)
+					break
+				}
+			}
+			if len(trades) == 0 {
+				bound, bounded = t.sweepBound(focusedOrder.Direction, price)
 			}
 
-			if matchAmount >= focusedAmount {
+			if matchAmount.GreaterThanOrEqual(focusedAmount) {
 				// 完全成交
-				turnover := op.MulFloor(price, focusedAmount, 8)
-				matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, focusedAmount, 8)
-				matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
-				if op.SubFloor(matchOrder.Amount, matchOrder.TradedAmount, 8) <= 0 {
-					matchOrder.Status = model.Completed
+				turnover := price.Mul(focusedAmount).Truncate(8)
+				trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, focusedAmount, turnover))
+				if t.fillMaker(v, i, matchOrder, focusedAmount, turnover) {
 					delOrders = append(delOrders, matchOrder.OrderId)
+					completeOrders = append(completeOrders, matchOrder)
 				}
-				focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, focusedAmount, 8)
-				focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+				focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(focusedAmount)
+				focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 				focusedOrder.Status = model.Completed
+				completeOrders = append(completeOrders, focusedOrder)
 				if matchOrder.Direction == model.BUY {
-					t.buyTradePlate.Remove(matchOrder, focusedAmount)
 					buyNotify = true
 				} else {
-					t.sellTradePlate.Remove(matchOrder, focusedAmount)
 					sellNotify = true
 				}
 				break
 			} else {
 				// 部分成交
-				turnover := op.MulFloor(price, matchAmount, 8)
-				matchOrder.TradedAmount = op.AddFloor(matchOrder.TradedAmount, matchAmount, 8)
-				matchOrder.Turnover = op.AddFloor(matchOrder.Turnover, turnover, 8)
-				matchOrder.Status = model.Completed
-				delOrders = append(delOrders, matchOrder.OrderId)
-				focusedOrder.TradedAmount = op.AddFloor(focusedOrder.TradedAmount, matchAmount, 8)
-				focusedOrder.Turnover = op.AddFloor(focusedOrder.Turnover, turnover, 8)
+				turnover := price.Mul(matchAmount).Truncate(8)
+				trades = append(trades, t.newTrade(focusedOrder, matchOrder, price, matchAmount, turnover))
+				if t.fillMaker(v, i, matchOrder, matchAmount, turnover) {
+					delOrders = append(delOrders, matchOrder.OrderId)
+					completeOrders = append(completeOrders, matchOrder)
+				} else {
+					// 只有冰山单会走到这里 补了新的显示数量排到了最后 当前位置已经是下一个订单
+					i--
+				}
+				focusedOrder.TradedAmount = focusedOrder.TradedAmount.Add(matchAmount)
+				focusedOrder.Turnover = focusedOrder.Turnover.Add(turnover)
 				if matchOrder.Direction == model.BUY {
-					t.buyTradePlate.Remove(matchOrder, matchAmount)
 					buyNotify = true
 				} else {
-					t.sellTradePlate.Remove(matchOrder, matchAmount)
 					sellNotify = true
 				}
 				continue
@@ -715,10 +1029,7 @@ func (t *CoinTrade) matchMarketPriceWithLP(lpList *LimitPriceQueue, focusedOrder
 		}
 	}
 
-	// 如果未完全成交，重新放入队列
-	if focusedOrder.Status == model.Trading {
-		t.addMarketQueue(focusedOrder)
-	}
+	t.sendTrade(trades)
 
 	// 通知盘口更新
 	if buyNotify {
@@ -727,6 +1038,46 @@ func (t *CoinTrade) matchMarketPriceWithLP(lpList *LimitPriceQueue, focusedOrder
 	if sellNotify {
 		t.sendTradPlateMsg(t.sellTradePlate)
 	}
+	for _, v := range completeOrders {
+		t.sendCompleteOrder(v)
+	}
+	for _, v := range canceledOrders {
+		t.sendCanceledOrder(v, model.CancelSTP)
+	}
+	// 吃到了限制的价格 剩下的撤掉 不能挂到市价队列上等着和后来的限价单成交
+	if swept && focusedOrder.Status == model.Trading {
+		t.sendCanceledOrder(focusedOrder, model.CancelSweep)
+	}
+	// 没有全部成交的部分 由 trade 根据 TimeInForce 决定挂单还是撤掉
+}
+
+// fillMaker 盘口上的限价单成交了amount 更新成交量和盘口 返回订单是否已经全部成交
+// 冰山单显示的部分成交完还有剩下的 补一份新的显示数量 排到同价格档位的最后
+// level: 订单所在的价格档位 index: 订单在档位中的位置
+func (t *CoinTrade) fillMaker(level *LimitPriceMap, index int, order *model.ExchangeOrder, amount decimal.Decimal, turnover decimal.Decimal) bool {
+	order.TradedAmount = order.TradedAmount.Add(amount)
+	order.Turnover = order.Turnover.Add(turnover)
+	plate := t.sellTradePlate
+	if order.Direction == model.BUY {
+		plate = t.buyTradePlate
+	}
+	plate.Remove(order, amount)
+	if order.IsIceberg() {
+		order.VisibleAmount = order.VisibleAmount.Sub(amount)
+	}
+	if order.IsOcoLimit() && order.TradedAmount.Equal(amount) {
+		t.sendFilledOrder(order)
+	}
+	if order.Amount.Sub(order.TradedAmount).Sign() <= 0 {
+		order.Status = model.Completed
+		return true
+	}
+	if order.IsIceberg() && order.VisibleAmount.Sign() <= 0 {
+		order.Refresh()
+		level.list = append(append(level.list[:index:index], level.list[index+1:]...), order)
+		plate.Add(order)
+	}
+	return false
 }
 
 // addMarketQueue 添加市价单到队列
@@ -750,73 +1101,256 @@ func (t *CoinTrade) addLimitQueue(order *model.ExchangeOrder) {
 	if order.Type != model.LimitPrice {
 		return
 	}
+	// 冰山单挂到盘口上只显示一份
+	if order.IsIceberg() {
+		order.Refresh()
+	}
 	if order.Direction == model.BUY {
-		t.buyLimitQueue.mux.Lock()
 		isPut := false
 		for _, o := range t.buyLimitQueue.list {
-			if o.price == order.Price {
+			if o.price.Equal(order.Price) {
 				o.list = append(o.list, order)
 				isPut = true
 				break
 			}
 		}
 		if !isPut {
-			lpm := &LimitPriceMap{
+			t.buyLimitQueue.insert(&LimitPriceMap{
 				price: order.Price,
 				list:  []*model.ExchangeOrder{order},
-			}
-			t.buyLimitQueue.list = append(t.buyLimitQueue.list, lpm)
+			}, model.BUY)
 		}
 		t.buyTradePlate.Add(order)
-		t.buyLimitQueue.mux.Unlock()
 	} else if order.Direction == model.SELL {
-		t.sellLimitQueue.mux.Lock()
 		isPut := false
 		for _, o := range t.sellLimitQueue.list {
-			if o.price == order.Price {
+			if o.price.Equal(order.Price) {
 				o.list = append(o.list, order)
 				isPut = true
 				break
 			}
 		}
 		if !isPut {
-			lpm := &LimitPriceMap{
+			t.sellLimitQueue.insert(&LimitPriceMap{
 				price: order.Price,
 				list:  []*model.ExchangeOrder{order},
-			}
-			t.sellLimitQueue.list = append(t.sellLimitQueue.list, lpm)
+			}, model.SELL)
 		}
 		t.sellTradePlate.Add(order)
-		t.sellLimitQueue.mux.Unlock()
 	}
 }
 
+// cancel 从队列和盘口中撤掉订单 只在撮合协程中调用
+// 返回被撤掉的订单 订单已经成交完或者不在引擎里返回nil
+func (t *CoinTrade) cancel(orderId string) *model.ExchangeOrder {
+	order := t.remove(orderId)
+	if order == nil {
+		// 订单还在去撮合引擎的路上 先记下来
+		// 引擎里已经成交完 数据库还是撮合中的订单也会走到这里 它不会再来了 超时丢掉
+		t.dropPendingCancel()
+		t.pendingCancel[orderId] = t.now
+		return nil
+	}
+	if order.Type == model.LimitPrice {
+		if order.Direction == model.BUY {
+			t.sendTradPlateMsg(t.buyTradePlate)
+		} else {
+			t.sendTradPlateMsg(t.sellTradePlate)
+		}
+	}
+	t.sendCanceledOrder(order, model.CancelByUser)
+	if t.auctioning() {
+		t.sendIndicative()
+	}
+	return order
+}
+
+// pendingCancelTTL 撤单等订单到达引擎的最长时间 毫秒
+const pendingCancelTTL = 10 * 60 * 1000
+
+// dropPendingCancel 丢掉等太久的撤单 按输入指令的时间算 回放结果一样
+func (t *CoinTrade) dropPendingCancel() {
+	for orderId, at := range t.pendingCancel {
+		if t.now-at > pendingCancelTTL {
+			delete(t.pendingCancel, orderId)
+			logx.Infof("撤单等待超时,symbol=%s,orderId=%s", t.symbol, orderId)
+		}
+	}
+}
+
+// link OCO止损单触发后进入撮合 撤掉同组还挂在盘口上的止盈单 剩下的数量和冻结的资金转给止损单
+// 止盈单已经不在盘口上(成交完了或者撤掉了) 止损单没有自己的冻结资金 数量改成0撤掉 返回false
+// 止盈单还没进入撮合(钱包还在冻结)也会走到这里 这时止盈单会当成普通限价单留下来
+func (t *CoinTrade) link(order *model.ExchangeOrder) bool {
+	sibling := t.findLinked(order)
+	if sibling == nil {
+		order.Amount = decimal.Zero
+		t.sendCanceledOrder(order, model.CancelOCO)
+		return false
+	}
+	t.remove(sibling.OrderId)
+	if sibling.Direction == model.BUY {
+		t.sendTradPlateMsg(t.buyTradePlate)
+	} else {
+		t.sendTradPlateMsg(t.sellTradePlate)
+	}
+	if order.Type == model.MarketPrice && order.Direction == model.BUY {
+		// 市价买的数量是金额 就是止盈单还没花掉的冻结资金
+		order.Amount = sibling.FreezeMoney().Sub(sibling.Turnover)
+	} else {
+		order.Amount = sibling.Amount.Sub(sibling.TradedAmount)
+	}
+	t.record(journal.TypeLinked, order)
+	t.publish("exchange_order_linked", order, true)
+	sibling.Status = model.Canceled
+	sibling.CanceledTime = t.now
+	canceled := model.NewCanceledOrder(sibling, model.CancelOCO)
+	canceled.Transfer = order.FreezeMoney()
+	t.record(journal.TypeCanceled, canceled)
+	t.publish("exchange_order_canceled", canceled, true)
+	return true
+}
+
+// findLinked 盘口上和OCO止损单同一组的止盈单
+func (t *CoinTrade) findLinked(order *model.ExchangeOrder) *model.ExchangeOrder {
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, o := range v.list {
+				if o.LinkId == order.LinkId && o.OrderId != order.OrderId {
+					return o
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// remove 从队列和盘口中拿掉订单 不发送任何事件
+func (t *CoinTrade) remove(orderId string) *model.ExchangeOrder {
+	for _, queue := range []*TradeTimeQueue{&t.buyMarketQueue, &t.sellMarketQueue} {
+		for index, order := range *queue {
+			if order.OrderId == orderId {
+				*queue = append((*queue)[:index], (*queue)[index+1:]...)
+				return order
+			}
+		}
+	}
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for i, v := range lpList.list {
+			for index, order := range v.list {
+				if order.OrderId != orderId {
+					continue
+				}
+				v.list = append(v.list[:index], v.list[index+1:]...)
+				if len(v.list) == 0 {
+					lpList.list = append(lpList.list[:i], lpList.list[i+1:]...)
+				}
+				// 盘口上扣掉显示的部分
+				if order.Direction == model.BUY {
+					t.buyTradePlate.Remove(order, order.Visible())
+				} else {
+					t.sellTradePlate.Remove(order, order.Visible())
+				}
+				return order
+			}
+		}
+	}
+	return nil
+}
+
+// query 查询引擎中的订单 只在撮合协程中调用
+// 返回副本 调用方拿到以后引擎还会继续修改原订单
+func (t *CoinTrade) query(orderId string) *model.ExchangeOrder {
+	for _, queue := range []TradeTimeQueue{t.buyMarketQueue, t.sellMarketQueue} {
+		for _, order := range queue {
+			if order.OrderId == orderId {
+				o := *order
+				return &o
+			}
+		}
+	}
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, order := range v.list {
+				if order.OrderId == orderId {
+					o := *order
+					return &o
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // sendCompleteOrder 发送订单完成通知
 // order: 已完成的订单
 func (t *CoinTrade) sendCompleteOrder(order *model.ExchangeOrder) {
 	if order.Status != model.Completed {
 		return
 	}
-	marshal, _ := json.Marshal(order)
-	kafkaData := database.KafkaData{
-		Topic: "exchange_order_complete",
-		Key:   []byte(t.symbol),
-		Data:  marshal,
+	t.record(journal.TypeComplete, order)
+	t.publish("exchange_order_complete", order, true)
+}
+
+// sendCanceledOrder 发送撤单事件 带上已成交和未成交的数量 钱包据此解冻
+// reason: 撤单原因 model.CancelByUser 等
+func (t *CoinTrade) sendCanceledOrder(order *model.ExchangeOrder, reason string) {
+	order.Status = model.Canceled
+	if reason == model.CancelOverTimed {
+		order.Status = model.OverTimed
 	}
-	for {
-		err := t.kafkaClient.SendSync(kafkaData)
-		if err != nil {
-			logx.Error(err)
-			time.Sleep(250 * time.Millisecond)
-			continue
-		} else {
-			break
+	order.CanceledTime = t.now
+	canceled := model.NewCanceledOrder(order, reason)
+	t.record(journal.TypeCanceled, canceled)
+	t.publish("exchange_order_canceled", canceled, true)
+}
+
+// sendRepricedOrder post only订单改价以后通知订单服务更新价格
+func (t *CoinTrade) sendRepricedOrder(order *model.ExchangeOrder) {
+	t.record(journal.TypeRepriced, order)
+	t.publish("exchange_order_repriced", order, true)
+}
+
+// sendFilledOrder OCO止盈单开始成交 通知订单服务撤掉同组的止损单
+func (t *CoinTrade) sendFilledOrder(order *model.ExchangeOrder) {
+	t.record(journal.TypeFilled, order)
+	t.publish("exchange_order_link_filled", order, true)
+}
+
+// newTrade 生成一条成交记录
+// taker: 新进入引擎的订单
+// maker: 盘口上被撮合的订单
+func (t *CoinTrade) newTrade(taker *model.ExchangeOrder, maker *model.ExchangeOrder, price decimal.Decimal, amount decimal.Decimal, turnover decimal.Decimal) *model.ExchangeTrade {
+	trade := model.NewTrade(t.symbol, taker, maker, price, amount, turnover)
+	t.charge(trade, taker, maker)
+	if t.journal == nil && t.replay == nil {
+		// 没有撮合日志 序号重启后会从头开始 只能用随机的id
+		trade.TradeId = tools.Unq("T")
+		trade.Time = time.Now().UnixMilli()
+		return trade
+	}
+	// 成交id和时间都由输入指令决定 回放时生成一模一样的成交
+	t.fills++
+	trade.TradeId = fmt.Sprintf("T%s-%d-%d", strings.ReplaceAll(t.symbol, "/", ""), t.cmdSeq, t.fills)
+	trade.Time = t.now
+	return trade
+}
+
+// sendTrade 发送成交记录
+// 每一笔撮合都要发送 报表、手续费、K线都依赖真实的成交
+func (t *CoinTrade) sendTrade(trades []*model.ExchangeTrade) {
+	for _, v := range trades {
+		t.record(journal.TypeTrade, v)
+		t.publish("exchange_order_trade", v, true)
+		if t.replay == nil && t.listener != nil {
+			t.listener(t.symbol, v.Price)
 		}
+		t.observe(v.Price)
 	}
 }
 
 // Add 添加订单到交易盘口
-// 根据订单类型和方向更新盘口信息
+// 根据订单类型和方向更新盘口信息 冰山单只加显示的部分
 // order: 要添加的订单
 func (p *TradePlate) Add(order *model.ExchangeOrder) {
 	// 检查订单方向是否匹配
@@ -824,10 +1358,6 @@ func (p *TradePlate) Add(order *model.ExchangeOrder) {
 		return
 	}
 
-	// 加锁保护并发访问
-	p.mux.Lock()
-	defer p.mux.Unlock()
-
 	// 市价单不进入买卖盘
 	if order.Type == model.MarketPrice {
 		return
@@ -839,37 +1369,42 @@ func (p *TradePlate) Add(order *model.ExchangeOrder) {
 		// 遍历现有价格档位
 		for _, v := range p.Items {
 			// 如果找到相同价格档位，更新数量
-			if v.Price == order.Price {
-				v.Amount = op.FloorFloat(v.Amount+(order.Amount-order.TradedAmount), 8)
+			if v.Price.Equal(order.Price) {
+				v.Amount = v.Amount.Add(order.Visible())
 				return
 			}
 		}
 	}
 
-	// 如果是新的价格档位，且未超过最大深度限制
-	if size < p.maxDepth {
-		tpi := &TradePlateItem{
-			Amount: op.FloorFloat(order.Amount-order.TradedAmount, 8),
-			Price:  order.Price,
-		}
-		p.Items = append(p.Items, tpi)
+	// 新的价格档位按价格插入 超过最大深度的去掉最差的档位
+	i := sort.Search(size, func(i int) bool {
+		return better(p.direction, order.Price, p.Items[i].Price)
+	})
+	if i >= p.maxDepth {
+		return
+	}
+	tpi := &TradePlateItem{
+		Amount: order.Visible(),
+		Price:  order.Price,
+	}
+	p.Items = append(p.Items, nil)
+	copy(p.Items[i+1:], p.Items[i:])
+	p.Items[i] = tpi
+	if len(p.Items) > p.maxDepth {
+		p.Items = p.Items[:p.maxDepth]
 	}
 }
 
 // sendTradPlateMsg 发送盘口更新消息
 // tradePlate: 要发送的盘口信息
-func (p *CoinTrade) sendTradPlateMsg(tradePlate *TradePlate) {
+func (t *CoinTrade) sendTradPlateMsg(tradePlate *TradePlate) {
 	result := tradePlate.Result(24)
-	marshal, _ := json.Marshal(result)
-	data := database.KafkaData{
-		Topic: "exchange_order_trade_plate",
-		Key:   []byte(tradePlate.Symbol),
-		Data:  marshal,
-	}
-	err := p.kafkaClient.SendSync(data)
-	if err != nil {
-		logx.Error(err)
-	} else {
-		logx.Info("======exchange_order_trade_plate send 成功....==========")
-	}
+	t.record(journal.TypePlate, result)
+	t.publish("exchange_order_trade_plate", result, false)
+}
+
+// publishPlate 启动的时候把盘口推给行情 不是撮合产生的 不写日志
+func (t *CoinTrade) publishPlate() {
+	t.publish("exchange_order_trade_plate", t.buyTradePlate.Result(24), false)
+	t.publish("exchange_order_trade_plate", t.sellTradePlate.Result(24), false)
 }
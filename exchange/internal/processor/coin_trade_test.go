@@ -0,0 +1,228 @@
+package processor
+
+import (
+	"encoding/json"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+	"testing"
+)
+
+// canceled 日志里的撤单事件 按订单id
+func canceled(t *testing.T, ct *CoinTrade) map[string]*model.ExchangeOrderCanceled {
+	t.Helper()
+	m := make(map[string]*model.ExchangeOrderCanceled)
+	for _, e := range entries(t, ct.journalFile, journal.TypeCanceled) {
+		c := &model.ExchangeOrderCanceled{}
+		if err := json.Unmarshal(e.Data, c); err != nil {
+			t.Fatal(err)
+		}
+		m[c.OrderId] = c
+	}
+	return m
+}
+
+// traded 订单在日志里所有成交的数量合计
+func traded(t *testing.T, ct *CoinTrade, orderId string) decimal.Decimal {
+	t.Helper()
+	sum := decimal.Zero
+	for _, e := range entries(t, ct.journalFile, journal.TypeTrade) {
+		trade := &model.ExchangeTrade{}
+		if err := json.Unmarshal(e.Data, trade); err != nil {
+			t.Fatal(err)
+		}
+		if trade.BuyOrderId == orderId || trade.SellOrderId == orderId {
+			sum = sum.Add(trade.Amount)
+		}
+	}
+	return sum
+}
+
+type fokCase struct {
+	name  string
+	stp   int
+	book  func(now int64) []*model.ExchangeOrder
+	order func(now int64) *model.ExchangeOrder
+	fill  bool
+}
+
+func asks(now int64) []*model.ExchangeOrder {
+	return []*model.ExchangeOrder{
+		limitOrder("s1", model.SELL, "100", "1", 1, now),
+		limitOrder("s2", model.SELL, "101", "1", 2, now+1),
+	}
+}
+
+var fokCases = []fokCase{
+	{
+		name:  "limit buy fills across levels",
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1.5", 9, now) },
+		fill:  true,
+	},
+	{
+		name:  "limit buy bigger than book",
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "2.5", 9, now) },
+	},
+	{
+		name:  "limit buy price below book",
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "100.5", "1.5", 9, now) },
+	},
+	{
+		name:  "own order cancels newest",
+		stp:   model.StpCancelNewest,
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1", 1, now) },
+	},
+	{
+		name:  "own order cancels oldest",
+		stp:   model.StpCancelOldest,
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1", 1, now) },
+		fill:  true,
+	},
+	{
+		name:  "market buy within money",
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return marketOrder("b", model.BUY, "150", 9, now) },
+		fill:  true,
+	},
+	{
+		name:  "market buy more money than book",
+		book:  asks,
+		order: func(now int64) *model.ExchangeOrder { return marketOrder("b", model.BUY, "250", 9, now) },
+	},
+	{
+		name: "limit buy fills against resting market sell",
+		book: func(now int64) []*model.ExchangeOrder {
+			return []*model.ExchangeOrder{
+				limitOrder("s1", model.SELL, "100", "1", 1, now),
+				marketOrder("m1", model.SELL, "1", 2, now+1),
+			}
+		},
+		order: func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "100", "1.5", 9, now) },
+		fill:  true,
+	},
+}
+
+// run 按用例挂好盘口 再下一条指定有效方式的订单
+func (c fokCase) run(t *testing.T, tif int) (*CoinTrade, *model.ExchangeOrder) {
+	t.Helper()
+	ct := newTestTrade(t, t.TempDir())
+	ct.conf.StpMode = c.stp
+	now := int64(1_700_000_000_000)
+	for _, o := range c.book(now) {
+		feed(t, ct, journal.TypePlace, o.Time, o)
+	}
+	order := c.order(now + 10)
+	order.TimeInForce = tif
+	feed(t, ct, journal.TypePlace, order.Time, order)
+	return ct, order
+}
+
+// canFill 的判断要和同一个订单按IOC真正撮合的结果一致
+func TestFOKAgreesWithMatching(t *testing.T) {
+	for _, c := range fokCases {
+		t.Run(c.name, func(t *testing.T) {
+			ioc, _ := c.run(t, model.IOC)
+			_, iocCanceled := canceled(t, ioc)["b"]
+			if iocCanceled == c.fill {
+				t.Fatalf("IOC canceled=%v, case expects fill=%v", iocCanceled, c.fill)
+			}
+
+			fok, order := c.run(t, model.FOK)
+			got, ok := canceled(t, fok)["b"]
+			if c.fill {
+				if ok {
+					t.Fatalf("FOK canceled with reason %s", got.Reason)
+				}
+				if order.Type == model.LimitPrice && !traded(t, fok, "b").Equal(order.Amount) {
+					t.Fatalf("FOK traded %s, want %s", traded(t, fok, "b"), order.Amount)
+				}
+				return
+			}
+			if !ok || got.Reason != model.CancelFOK {
+				t.Fatalf("FOK canceled=%v reason=%v, want %s", ok, got, model.CancelFOK)
+			}
+			// 不能全部成交的 盘口不动
+			if n := len(entries(t, fok.journalFile, journal.TypeTrade)); n != 0 {
+				t.Fatalf("rejected FOK produced %d trades", n)
+			}
+			if n := len(canceled(t, fok)); n != 1 {
+				t.Fatalf("rejected FOK canceled %d orders, want only itself", n)
+			}
+		})
+	}
+}
+
+// 市价买剩下的钱买不到最小单位 直接完成 不能成交0个
+func TestMarketBuyDustCompletes(t *testing.T) {
+	ct := newTestTrade(t, t.TempDir())
+	now := int64(1_700_000_000_000)
+	feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "0.99999999", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("s2", model.SELL, "101", "1", 2, now+1))
+	// 吃完s1剩0.000001 按101买不到0.00000001个
+	feed(t, ct, journal.TypePlace, now+10, marketOrder("b", model.BUY, "100", 9, now+10))
+
+	for _, e := range entries(t, ct.journalFile, journal.TypeTrade) {
+		trade := &model.ExchangeTrade{}
+		if err := json.Unmarshal(e.Data, trade); err != nil {
+			t.Fatal(err)
+		}
+		if trade.Amount.Sign() <= 0 || trade.SellOrderId != "s1" {
+			t.Fatalf("unexpected trade %+v", trade)
+		}
+	}
+	if !traded(t, ct, "b").Equal(decimal.RequireFromString("0.99999999")) {
+		t.Fatalf("market buy traded %s, want 0.99999999", traded(t, ct, "b"))
+	}
+	completed := false
+	for _, e := range entries(t, ct.journalFile, journal.TypeComplete) {
+		order := &model.ExchangeOrder{}
+		if err := json.Unmarshal(e.Data, order); err != nil {
+			t.Fatal(err)
+		}
+		completed = completed || order.OrderId == "b"
+	}
+	if !completed {
+		t.Fatal("dust market buy not completed")
+	}
+	if ct.query("b") != nil {
+		t.Fatal("dust market buy rests in the market queue")
+	}
+	s2 := ct.query("s2")
+	if s2 == nil || s2.TradedAmount.Sign() != 0 {
+		t.Fatalf("s2 touched by dust %+v", s2)
+	}
+}
+
+func TestIOCCancelsRemainder(t *testing.T) {
+	ct := newTestTrade(t, t.TempDir())
+	now := int64(1_700_000_000_000)
+	for _, o := range asks(now) {
+		feed(t, ct, journal.TypePlace, o.Time, o)
+	}
+	order := limitOrder("b", model.BUY, "100.5", "3", 9, now+10)
+	order.TimeInForce = model.IOC
+	feed(t, ct, journal.TypePlace, order.Time, order)
+
+	if !traded(t, ct, "b").Equal(decimal.RequireFromString("1")) {
+		t.Fatalf("IOC traded %s, want 1", traded(t, ct, "b"))
+	}
+	got, ok := canceled(t, ct)["b"]
+	if !ok || got.Reason != model.CancelIOC {
+		t.Fatalf("IOC remainder canceled=%v reason=%v", ok, got)
+	}
+	if !got.UntradedAmount.Equal(decimal.RequireFromString("2")) {
+		t.Fatalf("IOC untraded %s, want 2", got.UntradedAmount)
+	}
+	// 剩下的不能挂到盘口上
+	if ct.query("b") != nil {
+		t.Fatal("IOC remainder rests on the book")
+	}
+	if ct.query("s2") == nil {
+		t.Fatal("untouched ask was removed")
+	}
+}
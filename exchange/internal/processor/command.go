@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/metric"
+)
+
+// 每个交易对的收件箱大小 满了以后调用方会阻塞 也就是背压
+const inboxSize = 1024
+
+const (
+	cmdPlace  = iota // 新订单进入撮合
+	cmdCancel        // 从盘口撤掉订单
+	cmdQuery         // 查询盘口上的订单
+	cmdPlate         // 查询买卖盘
+	cmdAmend         // 改单
+)
+
+var cmdNames = map[int]string{
+	cmdPlace:  "place",
+	cmdCancel: "cancel",
+	cmdQuery:  "query",
+	cmdPlate:  "plate",
+	cmdAmend:  "amend",
+}
+
+// command 发给撮合协程的指令
+// 撮合协程按照收到的顺序逐条处理 需要结果的指令通过reply返回
+type command struct {
+	kind      int
+	order     *model.ExchangeOrder
+	orderId   string
+	direction int
+	amend     *model.ExchangeOrderAmend
+	reply     chan any
+}
+
+var (
+	inboxLength = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "exchange",
+		Subsystem: "engine",
+		Name:      "inbox_length",
+		Help:      "number of commands waiting in the symbol inbox",
+		Labels:    []string{"symbol"},
+	})
+	inboxFull = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "exchange",
+		Subsystem: "engine",
+		Name:      "inbox_full_total",
+		Help:      "times a sender blocked because the symbol inbox was full",
+		Labels:    []string{"symbol"},
+	})
+	commandTotal = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: "exchange",
+		Subsystem: "engine",
+		Name:      "command_total",
+		Help:      "commands processed by the symbol engine",
+		Labels:    []string{"symbol", "kind"},
+	})
+)
+
+// send 投递指令 收件箱满了就阻塞等待 同时记录一次背压
+func (t *CoinTrade) send(cmd *command) {
+	select {
+	case t.inbox <- cmd:
+	default:
+		inboxFull.Inc(t.symbol)
+		logx.Infof("撮合引擎收件箱已满,symbol=%s,kind=%s", t.symbol, cmdNames[cmd.kind])
+		t.inbox <- cmd
+	}
+	inboxLength.Set(float64(len(t.inbox)), t.symbol)
+}
+
+// call 投递指令并等待撮合协程返回结果
+func (t *CoinTrade) call(cmd *command) any {
+	cmd.reply = make(chan any, 1)
+	t.send(cmd)
+	return <-cmd.reply
+}
+
+// 多久检查一次到期的GTD订单
+const expireInterval = time.Second
+
+// run 撮合协程 交易对的所有状态只在这里读写 所以内部不需要加锁
+// 快照也在这里做 拿到的一定是某条指令处理完之后的状态
+func (t *CoinTrade) run() {
+	expireTicker := time.NewTicker(expireInterval)
+	defer expireTicker.Stop()
+	var tick <-chan time.Time
+	if t.snapshotConf.Dir != "" {
+		interval := t.snapshotConf.Interval
+		if interval <= 0 {
+			interval = 60
+		}
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case cmd, ok := <-t.inbox:
+			if !ok {
+				return
+			}
+			t.handle(cmd)
+		case <-tick:
+			t.takeSnapshot()
+		case <-expireTicker.C:
+			// 到期撤单也是输入指令 要先写日志 回放时在同样的位置撤掉
+			now := time.Now().UnixMilli()
+			if t.due(now) {
+				t.input(journal.TypeExpire, &expireInput{})
+				t.expire(t.now)
+			}
+			t.checkUncross(now)
+			t.resume(now)
+		}
+	}
+}
+
+func (t *CoinTrade) handle(cmd *command) {
+	inboxLength.Set(float64(len(t.inbox)), t.symbol)
+	commandTotal.Inc(t.symbol, cmdNames[cmd.kind])
+	switch cmd.kind {
+	case cmdPlace:
+		t.input(journal.TypePlace, cmd.order)
+		t.trade(cmd.order)
+	case cmdCancel:
+		t.input(journal.TypeCancel, &cancelInput{OrderId: cmd.orderId})
+		cmd.reply <- t.cancel(cmd.orderId)
+	case cmdAmend:
+		t.input(journal.TypeAmend, cmd.amend)
+		t.amend(cmd.amend)
+	case cmdQuery:
+		cmd.reply <- t.query(cmd.orderId)
+	case cmdPlate:
+		if cmd.direction == model.BUY {
+			cmd.reply <- t.buyTradePlate.Result(24)
+		} else {
+			cmd.reply <- t.sellTradePlate.Result(24)
+		}
+	}
+}
+
+// Trade 新订单进入撮合 只负责投递 撮合在交易对自己的协程里按顺序执行
+func (t *CoinTrade) Trade(order *model.ExchangeOrder) {
+	t.send(&command{kind: cmdPlace, order: order})
+}
+
+// Cancel 从盘口撤掉订单 返回被撤掉的订单 订单不在盘口上返回nil
+func (t *CoinTrade) Cancel(orderId string) *model.ExchangeOrder {
+	order, _ := t.call(&command{kind: cmdCancel, orderId: orderId}).(*model.ExchangeOrder)
+	return order
+}
+
+// Amend 改单 只负责投递 结果由撮合引擎发出 exchange_order_amended
+func (t *CoinTrade) Amend(amend *model.ExchangeOrderAmend) {
+	t.send(&command{kind: cmdAmend, amend: amend})
+}
+
+// Query 查询盘口上的订单 返回的是副本 不在盘口上返回nil
+func (t *CoinTrade) Query(orderId string) *model.ExchangeOrder {
+	order, _ := t.call(&command{kind: cmdQuery, orderId: orderId}).(*model.ExchangeOrder)
+	return order
+}
+
+// Plate 查询买盘或者卖盘
+func (t *CoinTrade) Plate(direction int) *TradePlateResult {
+	result, _ := t.call(&command{kind: cmdPlate, direction: direction}).(*TradePlateResult)
+	return result
+}
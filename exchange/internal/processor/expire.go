@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"exchange/internal/model"
+	"sort"
+)
+
+// expireInput 过期检查写入日志的内容 过期时间就是日志记录的时间
+type expireInput struct{}
+
+// expiringLess 过期时间相同按订单号 不管是撮合出来的还是快照恢复的 过期撤单的顺序都一样
+func expiringLess(a *model.ExchangeOrder, b *model.ExchangeOrder) bool {
+	if a.ExpireTime != b.ExpireTime {
+		return a.ExpireTime < b.ExpireTime
+	}
+	return a.OrderId < b.OrderId
+}
+
+// agingLess 委托时间相同按订单号
+func agingLess(a *model.ExchangeOrder, b *model.ExchangeOrder) bool {
+	if a.Time != b.Time {
+		return a.Time < b.Time
+	}
+	return a.OrderId < b.OrderId
+}
+
+// addExpiring 挂到盘口上的订单 GTD订单按过期时间插入 交易对配置了委托超时的还要按委托时间插入
+func (t *CoinTrade) addExpiring(order *model.ExchangeOrder) {
+	t.addAging(order)
+	if order.TimeInForce != model.GTD {
+		return
+	}
+	i := sort.Search(len(t.expiring), func(i int) bool {
+		return expiringLess(order, t.expiring[i])
+	})
+	t.expiring = append(t.expiring, nil)
+	copy(t.expiring[i+1:], t.expiring[i:])
+	t.expiring[i] = order
+}
+
+// addAging 交易对配置了委托超时 按委托时间插入 超时时间所有订单都一样 按委托时间排就是按超时时间排
+func (t *CoinTrade) addAging(order *model.ExchangeOrder) {
+	if t.conf.MaxTradingTime <= 0 {
+		return
+	}
+	i := sort.Search(len(t.aging), func(i int) bool {
+		return agingLess(order, t.aging[i])
+	})
+	t.aging = append(t.aging, nil)
+	copy(t.aging[i+1:], t.aging[i:])
+	t.aging[i] = order
+}
+
+// rebuildExpiring 从盘口重新收集GTD订单和委托超时要检查的订单 快照恢复和委托超时配置变化以后调用
+func (t *CoinTrade) rebuildExpiring() {
+	t.expiring = nil
+	t.aging = nil
+	for _, queue := range []TradeTimeQueue{t.buyMarketQueue, t.sellMarketQueue} {
+		for _, order := range queue {
+			t.addExpiring(order)
+		}
+	}
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, order := range v.list {
+				t.addExpiring(order)
+			}
+		}
+	}
+}
+
+// due 是否有到期的GTD订单或者委托超时的订单
+func (t *CoinTrade) due(now int64) bool {
+	return t.expiredCount(now) > 0 || t.overTimedCount(now) > 0
+}
+
+// expiredCount 排在前面的到期GTD订单数
+func (t *CoinTrade) expiredCount(now int64) int {
+	n := 0
+	for n < len(t.expiring) && t.expiring[n].ExpireTime <= now {
+		n++
+	}
+	return n
+}
+
+// overTimedCount 排在前面的委托超时订单数 没有配置委托超时为0
+func (t *CoinTrade) overTimedCount(now int64) int {
+	if t.conf.MaxTradingTime <= 0 {
+		return 0
+	}
+	n := 0
+	for n < len(t.aging) && t.aging[n].Time+t.conf.MaxTradingTime <= now {
+		n++
+	}
+	return n
+}
+
+// expire 撤掉到期的GTD订单 再把委托超时的订单下架 只在撮合协程中调用
+// now 用输入指令的时间 回放时结果一样
+// 已经成交完或者撤掉的订单不在盘口上 跳过 重复执行不会重复撤单
+func (t *CoinTrade) expire(now int64) {
+	n := t.expiredCount(now)
+	m := t.overTimedCount(now)
+	if n == 0 && m == 0 {
+		return
+	}
+	due := t.expiring[:n]
+	t.expiring = append([]*model.ExchangeOrder(nil), t.expiring[n:]...)
+	aged := t.aging[:m]
+	t.aging = append([]*model.ExchangeOrder(nil), t.aging[m:]...)
+	buyNotify := false
+	sellNotify := false
+	var expired []*model.ExchangeOrder
+	var overTimed []*model.ExchangeOrder
+	for i, order := range append(due, aged...) {
+		// 已经成交完或者被撤掉的订单不在盘口上了
+		if t.remove(order.OrderId) == nil {
+			continue
+		}
+		if order.Type == model.LimitPrice {
+			if order.Direction == model.BUY {
+				buyNotify = true
+			} else {
+				sellNotify = true
+			}
+		}
+		if i < n {
+			expired = append(expired, order)
+		} else {
+			overTimed = append(overTimed, order)
+		}
+	}
+	if buyNotify {
+		t.sendTradPlateMsg(t.buyTradePlate)
+	}
+	if sellNotify {
+		t.sendTradPlateMsg(t.sellTradePlate)
+	}
+	for _, order := range expired {
+		t.sendCanceledOrder(order, model.CancelExpired)
+	}
+	for _, order := range overTimed {
+		t.sendCanceledOrder(order, model.CancelOverTimed)
+	}
+}
@@ -0,0 +1,35 @@
+package processor
+
+import (
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+)
+
+// feeRate 吃单还是挂单的手续费率 订单上有会员手续费等级的按等级的费率
+func (t *CoinTrade) feeRate(order *model.ExchangeOrder, taker bool) decimal.Decimal {
+	if order.FeeTier > 0 {
+		if taker {
+			return order.TakerFee
+		}
+		return order.MakerFee
+	}
+	if taker {
+		return decimal.NewFromFloat(t.conf.TakerFee)
+	}
+	return decimal.NewFromFloat(t.conf.MakerFee)
+}
+
+// charge 每一笔成交都按双方的角色收手续费 累加到订单上 钱包结算时从收到的资产里扣
+// 买方收到的是币 手续费按成交数量算 卖方收到的是钱 手续费按成交额算
+func (t *CoinTrade) charge(trade *model.ExchangeTrade, taker *model.ExchangeOrder, maker *model.ExchangeOrder) {
+	for _, order := range []*model.ExchangeOrder{taker, maker} {
+		rate := t.feeRate(order, order == taker)
+		if order.Direction == model.BUY {
+			trade.BuyFee = trade.Amount.Mul(rate).Truncate(8)
+			order.Fee = order.Fee.Add(trade.BuyFee)
+		} else {
+			trade.SellFee = trade.Turnover.Mul(rate).Truncate(8)
+			order.Fee = order.Fee.Add(trade.SellFee)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"exchange/internal/database"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"exchange/internal/snapshot"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// cancelInput 撤单指令写入日志的内容
+type cancelInput struct {
+	OrderId string `json:"orderId"`
+}
+
+// outputTopics 输出事件发到哪个topic 重启补发时用 盘口最后整个推一次 不在这里
+var outputTopics = map[string]string{
+	journal.TypeTrade:    "exchange_order_trade",
+	journal.TypeComplete: "exchange_order_complete",
+	journal.TypeCanceled: "exchange_order_canceled",
+	journal.TypeRepriced: "exchange_order_repriced",
+	journal.TypeLinked:   "exchange_order_linked",
+	journal.TypeFilled:   "exchange_order_link_filled",
+	journal.TypeAmended:  "exchange_order_amended",
+	journal.TypeHalt:     "exchange_symbol_halt",
+}
+
+// input 输入指令先写日志再执行 日志写不进去就一直重试 不能跳过
+func (t *CoinTrade) input(typ string, v any) {
+	now := time.Now().UnixMilli()
+	if t.journal == nil {
+		t.seq++
+		t.begin(t.seq, now)
+		return
+	}
+	for {
+		e, err := t.journal.Append(typ, now, v)
+		if err != nil {
+			logx.Error(err)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		t.begin(e.Seq, e.Time)
+		return
+	}
+}
+
+// begin 开始处理一条输入指令
+func (t *CoinTrade) begin(seq int64, now int64) {
+	t.seq = seq
+	t.cmdSeq = seq
+	t.now = now
+	t.fills = 0
+}
+
+// record 输出事件写入日志 回放时交给回放函数
+func (t *CoinTrade) record(typ string, v any) {
+	if t.replay != nil {
+		data, _ := json.Marshal(v)
+		t.seq++
+		t.replay(&journal.Entry{Seq: t.seq, Type: typ, Time: t.now, Data: data})
+		return
+	}
+	if t.journal == nil {
+		t.seq++
+		return
+	}
+	for {
+		e, err := t.journal.Append(typ, t.now, v)
+		if err != nil {
+			logx.Error(err)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		t.seq = e.Seq
+		return
+	}
+}
+
+// publish 发送到kafka 回放的时候不发
+// retry: 发送失败是否一直重试 盘口这种下一次会覆盖的消息不需要
+// 发送成功记下最后一条日志的序号 输出事件都是先写日志再发送 之前的都已经发过了
+func (t *CoinTrade) publish(topic string, v any, retry bool) {
+	if t.replay != nil || t.kafkaClient == nil {
+		return
+	}
+	marshal, _ := json.Marshal(v)
+	if t.sendKafka(topic, marshal, retry) {
+		t.ack(t.seq)
+	}
+}
+
+func (t *CoinTrade) sendKafka(topic string, marshal []byte, retry bool) bool {
+	data := database.KafkaData{
+		Topic: topic,
+		Key:   []byte(t.symbol),
+		Data:  marshal,
+	}
+	for {
+		err := t.kafkaClient.SendKeyed(data)
+		if err == nil {
+			return true
+		}
+		logx.Error(err)
+		if !retry {
+			return false
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func (t *CoinTrade) ack(seq int64) {
+	if t.journal == nil {
+		return
+	}
+	if err := t.journal.Ack(seq); err != nil {
+		logx.Error(err)
+	}
+}
+
+// republish 重启后补发日志里没确认发送的输出事件
+// 成交id由输入指令的序号决定 重发的和原来的一模一样 下游按id去重
+func (t *CoinTrade) republish(entries []*journal.Entry) {
+	if t.kafkaClient == nil || len(entries) == 0 {
+		return
+	}
+	for _, e := range entries {
+		if topic, ok := outputTopics[e.Type]; ok {
+			t.sendKafka(topic, e.Data, true)
+		}
+		t.ack(e.Seq)
+	}
+	logx.Infof("撮合日志补发完成,symbol=%s,count=%d,seq=%d", t.symbol, len(entries), entries[len(entries)-1].Seq)
+}
+
+// apply 执行日志中的一条输入指令 只在恢复和回放时调用
+func (t *CoinTrade) apply(e *journal.Entry) error {
+	t.begin(e.Seq, e.Time)
+	switch e.Type {
+	case journal.TypeLoad, journal.TypePlace:
+		order := &model.ExchangeOrder{}
+		if err := json.Unmarshal(e.Data, order); err != nil {
+			return fmt.Errorf("seq %d: %w", e.Seq, err)
+		}
+		if e.Type == journal.TypeLoad {
+			t.load(order)
+		} else {
+			t.trade(order)
+		}
+	case journal.TypeCancel:
+		var in cancelInput
+		if err := json.Unmarshal(e.Data, &in); err != nil {
+			return fmt.Errorf("seq %d: %w", e.Seq, err)
+		}
+		t.cancel(in.OrderId)
+	case journal.TypeAmend:
+		in := &model.ExchangeOrderAmend{}
+		if err := json.Unmarshal(e.Data, in); err != nil {
+			return fmt.Errorf("seq %d: %w", e.Seq, err)
+		}
+		t.amend(in)
+	case journal.TypeExpire:
+		t.expire(t.now)
+	case journal.TypeUncross:
+		t.uncross()
+	case journal.TypeConfig:
+		var c CoinConfig
+		if err := json.Unmarshal(e.Data, &c); err != nil {
+			return fmt.Errorf("seq %d: %w", e.Seq, err)
+		}
+		t.setConf(c)
+	}
+	return nil
+}
+
+// catchUp 启动时按日志重新执行序号大于after的输入指令 恢复盘口
+// 重新执行产生的输出事件和日志里的一一对应 最后一条输入指令执行到一半挂了的
+// 没写进日志的输出事件先补写进去 再接收新的指令 日志里不会留下缺了输出的指令
+// 确认发送的序号之后的输出事件 可能没发到kafka 全部重新发一遍
+func (t *CoinTrade) catchUp(after int64) {
+	acked := t.journal.Acked()
+	var produced, unsent []*journal.Entry
+	t.replay = func(e *journal.Entry) {
+		produced = append(produced, e)
+	}
+	err := journal.Read(t.journalFile, func(e *journal.Entry) error {
+		if journal.IsInput(e.Type) {
+			if len(produced) > 0 {
+				// 之前的版本重启时没有补写 这些事件已经丢了
+				logx.Errorf("撮合日志缺少输出事件,symbol=%s,seq=%d,count=%d", t.symbol, e.Seq, len(produced))
+				produced = nil
+			}
+			if e.Seq > after {
+				return t.apply(e)
+			}
+			return nil
+		}
+		if e.Seq > after && len(produced) > 0 {
+			produced = produced[1:]
+		}
+		if e.Seq > acked {
+			unsent = append(unsent, e)
+		}
+		return nil
+	})
+	t.replay = nil
+	if err != nil {
+		t.seq = t.journal.LastSeq()
+		logx.Errorf("撮合日志恢复失败,symbol=%s,err=%v", t.symbol, err)
+		return
+	}
+	for _, p := range produced {
+		for {
+			e, err := t.journal.Append(p.Type, p.Time, p.Data)
+			if err != nil {
+				logx.Error(err)
+				time.Sleep(250 * time.Millisecond)
+				continue
+			}
+			unsent = append(unsent, e)
+			break
+		}
+	}
+	t.seq = t.journal.LastSeq()
+	logx.Infof("撮合日志恢复完成,symbol=%s,from=%d,seq=%d,completed=%d", t.symbol, after, t.seq, len(produced))
+	t.republish(unsent)
+	t.publishPlate()
+}
+
+// ReplayResult 回放结果
+// 同一份日志回放多少次 Digest 都应该一样
+type ReplayResult struct {
+	Symbol   string
+	Snapshot int64  // 从哪个快照开始 0表示从空盘口开始
+	Entries  int64  // 回放的日志条数
+	Inputs   int64  // 输入指令条数
+	Trades   int64  // 回放产生的成交笔数
+	LastSeq  int64  // 最后一条日志的序号
+	Digest   string // 所有成交按顺序计算的sha256
+}
+
+// Replay 离线回放一个交易对的撮合日志
+// 有快照从快照开始 没有从空盘口开始 执行之后的输入指令 产生的每一个输出事件都要和日志里记录的一模一样
+func Replay(c journal.Config, sc snapshot.Config, symbol string) (*ReplayResult, error) {
+	t := &CoinTrade{
+		symbol:        symbol,
+		pendingCancel: make(map[string]int64),
+	}
+	t.initBook()
+	result := &ReplayResult{Symbol: symbol}
+	var from int64
+	if sc.Dir != "" {
+		var last int64
+		journal.Read(journal.FileName(c.Dir, symbol), func(e *journal.Entry) error {
+			last = e.Seq
+			return nil
+		})
+		snap, err := snapshot.Latest(sc, symbol, last)
+		if err != nil {
+			logx.Error(err)
+		}
+		if snap != nil {
+			if err := t.restore(snap); err != nil {
+				return nil, err
+			}
+			from = snap.Seq
+			result.Snapshot = snap.Seq
+		}
+	}
+	hash := sha256.New()
+	var produced []*journal.Entry
+	t.replay = func(e *journal.Entry) {
+		produced = append(produced, e)
+		if e.Type == journal.TypeTrade {
+			result.Trades++
+			hash.Write(e.Data)
+			hash.Write([]byte{'\n'})
+		}
+	}
+	err := journal.Read(journal.FileName(c.Dir, symbol), func(e *journal.Entry) error {
+		if e.Seq <= from {
+			return nil
+		}
+		result.Entries++
+		result.LastSeq = e.Seq
+		if journal.IsInput(e.Type) {
+			if len(produced) > 0 {
+				return fmt.Errorf("seq %d: replay produced %s event seq %d that is not in the journal", e.Seq, produced[0].Type, produced[0].Seq)
+			}
+			result.Inputs++
+			return t.apply(e)
+		}
+		if len(produced) == 0 {
+			return fmt.Errorf("seq %d: journal has %s event that replay did not produce", e.Seq, e.Type)
+		}
+		p := produced[0]
+		produced = produced[1:]
+		if p.Seq != e.Seq || p.Type != e.Type || !bytes.Equal(p.Data, e.Data) {
+			return fmt.Errorf("seq %d: journal has %s %s, replay produced %s %s", e.Seq, e.Type, e.Data, p.Type, p.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 最后一条输入指令的输出可能没来得及写进日志 这种情况不算不一致
+	result.Digest = hex.EncodeToString(hash.Sum(nil))
+	return result, nil
+}
+
+// ReplayAll 回放目录下所有交易对的撮合日志
+func ReplayAll(c journal.Config, sc snapshot.Config) ([]*ReplayResult, error) {
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*.journal"))
+	if err != nil {
+		return nil, err
+	}
+	var results []*ReplayResult
+	for _, f := range files {
+		symbol := strings.ReplaceAll(strings.TrimSuffix(filepath.Base(f), ".journal"), "_", "/")
+		result, err := Replay(c, sc, symbol)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", symbol, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,197 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"exchange/internal/snapshot"
+	"mscoin-common/decimal"
+	"os"
+	"testing"
+)
+
+const testSymbol = "BTC/USDT"
+
+// newTestTrade 写日志 不发kafka的撮合引擎
+func newTestTrade(t *testing.T, dir string) *CoinTrade {
+	t.Helper()
+	ct := &CoinTrade{
+		symbol:        testSymbol,
+		pendingCancel: make(map[string]int64),
+		conf:          CoinConfig{PriceScale: 2},
+	}
+	ct.initBook()
+	j, err := journal.Open(journal.Config{Dir: dir}, testSymbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	ct.journal = j
+	ct.journalFile = journal.FileName(dir, testSymbol)
+	return ct
+}
+
+// feed 按指定时间写入一条输入指令再执行 和撮合协程收到指令时一样
+func feed(t *testing.T, ct *CoinTrade, typ string, now int64, v any) {
+	t.Helper()
+	e, err := ct.journal.Append(typ, now, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ct.apply(e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func limitOrder(orderId string, direction int, price string, amount string, memberId int64, now int64) *model.ExchangeOrder {
+	return &model.ExchangeOrder{
+		OrderId:   orderId,
+		Symbol:    testSymbol,
+		MemberId:  memberId,
+		Direction: direction,
+		Type:      model.LimitPrice,
+		Price:     decimal.RequireFromString(price),
+		Amount:    decimal.RequireFromString(amount),
+		Status:    model.Trading,
+		Time:      now,
+	}
+}
+
+func marketOrder(orderId string, direction int, amount string, memberId int64, now int64) *model.ExchangeOrder {
+	o := limitOrder(orderId, direction, "0", amount, memberId, now)
+	o.Type = model.MarketPrice
+	return o
+}
+
+// entries 日志里的记录 typ为空返回全部
+func entries(t *testing.T, file string, typ string) []*journal.Entry {
+	t.Helper()
+	var list []*journal.Entry
+	err := journal.Read(file, func(e *journal.Entry) error {
+		if typ == "" || e.Type == typ {
+			list = append(list, e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// tradeDigest 和 Replay 一样按顺序算成交的sha256
+func tradeDigest(list []*journal.Entry) string {
+	hash := sha256.New()
+	for _, e := range list {
+		hash.Write(e.Data)
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// runMixed 下单 撤单 改单 到期撤单都走一遍
+func runMixed(t *testing.T, ct *CoinTrade) {
+	now := int64(1_700_000_000_000)
+	feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "1", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("s2", model.SELL, "101", "2", 2, now+1))
+	gtd := limitOrder("s3", model.SELL, "102", "1", 3, now+2)
+	gtd.TimeInForce = model.GTD
+	gtd.ExpireTime = now + 100
+	feed(t, ct, journal.TypePlace, now+2, gtd)
+	feed(t, ct, journal.TypePlace, now+3, limitOrder("b1", model.BUY, "101", "1.5", 4, now+3))
+	feed(t, ct, journal.TypeCancel, now+4, &cancelInput{OrderId: "s2"})
+	feed(t, ct, journal.TypePlace, now+5, limitOrder("s4", model.SELL, "99", "3", 5, now+5))
+	feed(t, ct, journal.TypeAmend, now+6, &model.ExchangeOrderAmend{
+		OrderId: "s4",
+		Symbol:  testSymbol,
+		Price:   decimal.RequireFromString("98"),
+	})
+	feed(t, ct, journal.TypePlace, now+7, marketOrder("b2", model.BUY, "150", 6, now+7))
+	feed(t, ct, journal.TypeExpire, now+200, &expireInput{})
+	feed(t, ct, journal.TypePlace, now+201, limitOrder("b3", model.BUY, "98", "1", 7, now+201))
+}
+
+func TestReplayTwiceSameFills(t *testing.T) {
+	dir := t.TempDir()
+	ct := newTestTrade(t, dir)
+	runMixed(t, ct)
+	live := entries(t, ct.journalFile, journal.TypeTrade)
+	if len(live) == 0 {
+		t.Fatal("live run produced no trades")
+	}
+	if len(entries(t, ct.journalFile, journal.TypeCanceled)) < 2 {
+		t.Fatal("cancel and expire should both produce canceled events")
+	}
+	if len(entries(t, ct.journalFile, journal.TypeAmended)) != 1 {
+		t.Fatal("amend should produce one amended event")
+	}
+	jc := journal.Config{Dir: dir}
+	r1, err := Replay(jc, snapshot.Config{}, testSymbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := Replay(jc, snapshot.Config{}, testSymbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.Digest != r2.Digest {
+		t.Fatalf("replay digests differ: %s %s", r1.Digest, r2.Digest)
+	}
+	if r1.Trades != int64(len(live)) || r1.Digest != tradeDigest(live) {
+		t.Fatalf("replay trades %d digest %s, live trades %d digest %s", r1.Trades, r1.Digest, len(live), tradeDigest(live))
+	}
+	if r1.LastSeq != ct.journal.LastSeq() {
+		t.Fatalf("replay last seq %d, journal %d", r1.LastSeq, ct.journal.LastSeq())
+	}
+}
+
+// 最后一条输入指令的输出只写了一部分就挂了 重启后补写完 后面的指令回放还能对上
+func TestCatchUpCompletesPartialCommand(t *testing.T) {
+	dir := t.TempDir()
+	ct := newTestTrade(t, dir)
+	now := int64(1_700_000_000_000)
+	feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "1", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("s2", model.SELL, "101", "1", 2, now+1))
+	feed(t, ct, journal.TypePlace, now+2, limitOrder("b1", model.BUY, "101", "2", 3, now+2))
+	full, err := os.ReadFile(ct.journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := entries(t, ct.journalFile, "")
+	var input int
+	for i, e := range all {
+		if journal.IsInput(e.Type) {
+			input = i
+		}
+	}
+	if len(all)-input < 3 {
+		t.Fatalf("last input has %d outputs, want at least 2", len(all)-input-1)
+	}
+	// 只留下最后一条输入指令和它的第一个输出事件
+	lines := bytes.SplitAfter(full, []byte{'\n'})
+	crashed := t.TempDir()
+	partial := bytes.Join(lines[:input+2], nil)
+	if err := os.WriteFile(journal.FileName(crashed, testSymbol), partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := &CoinTrade{symbol: testSymbol, pendingCancel: make(map[string]int64)}
+	restarted.init(journal.Config{Dir: crashed})
+	t.Cleanup(func() { restarted.journal.Close() })
+	recovered, err := os.ReadFile(restarted.journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, full) {
+		t.Fatalf("recovered journal differs from the live one\nlive:\n%s\nrecovered:\n%s", full, recovered)
+	}
+	if restarted.seq != ct.journal.LastSeq() {
+		t.Fatalf("restarted seq %d, want %d", restarted.seq, ct.journal.LastSeq())
+	}
+	feed(t, restarted, journal.TypePlace, now+3, limitOrder("s3", model.SELL, "101", "1", 4, now+3))
+	if _, err := Replay(journal.Config{Dir: crashed}, snapshot.Config{}, testSymbol); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"exchange/internal/domain"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"exchange/internal/snapshot"
+	"fmt"
+	"mscoin-common/decimal"
+	"sort"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// bookSnapshot 快照里的盘口内容
+// 队列和盘口都按原来的顺序保存 恢复后撮合顺序和盘口消息都和没重启一样
+type bookSnapshot struct {
+	BuyMarket     TradeTimeQueue     `json:"buyMarket"`
+	SellMarket    TradeTimeQueue     `json:"sellMarket"`
+	BuyLimit      []*levelSnapshot   `json:"buyLimit"`
+	SellLimit     []*levelSnapshot   `json:"sellLimit"`
+	BuyPlate      []*TradePlateItem  `json:"buyPlate"`
+	SellPlate     []*TradePlateItem  `json:"sellPlate"`
+	PendingCancel []*pendingSnapshot `json:"pendingCancel"`
+	Config        CoinConfig         `json:"config"`
+	Breaker       breaker            `json:"breaker"`
+}
+
+// pendingSnapshot 还在等订单到达的撤单
+type pendingSnapshot struct {
+	OrderId string `json:"orderId"`
+	Time    int64  `json:"time"`
+}
+
+// levelSnapshot 一个价格档位
+type levelSnapshot struct {
+	Price  decimal.Decimal        `json:"price"`
+	Orders []*model.ExchangeOrder `json:"orders"`
+}
+
+func levels(q *LimitPriceQueue) []*levelSnapshot {
+	list := make([]*levelSnapshot, 0, len(q.list))
+	for _, v := range q.list {
+		list = append(list, &levelSnapshot{Price: v.price, Orders: v.list})
+	}
+	return list
+}
+
+func fromLevels(list []*levelSnapshot) *LimitPriceQueue {
+	q := &LimitPriceQueue{}
+	for _, v := range list {
+		q.list = append(q.list, &LimitPriceMap{price: v.Price, list: v.Orders})
+	}
+	return q
+}
+
+// book 当前盘口 只在撮合协程中调用
+func (t *CoinTrade) book() *bookSnapshot {
+	b := &bookSnapshot{
+		BuyMarket:     t.buyMarketQueue,
+		SellMarket:    t.sellMarketQueue,
+		BuyLimit:      levels(t.buyLimitQueue),
+		SellLimit:     levels(t.sellLimitQueue),
+		BuyPlate:      t.buyTradePlate.Items,
+		SellPlate:     t.sellTradePlate.Items,
+		PendingCancel: make([]*pendingSnapshot, 0, len(t.pendingCancel)),
+		Config:        t.conf,
+		Breaker:       t.breaker,
+	}
+	for orderId, at := range t.pendingCancel {
+		b.PendingCancel = append(b.PendingCancel, &pendingSnapshot{OrderId: orderId, Time: at})
+	}
+	sort.Slice(b.PendingCancel, func(i, j int) bool {
+		return b.PendingCancel[i].OrderId < b.PendingCancel[j].OrderId
+	})
+	return b
+}
+
+// restore 用快照替换当前盘口
+func (t *CoinTrade) restore(snap *snapshot.Snapshot) error {
+	b := &bookSnapshot{}
+	if err := json.Unmarshal(snap.Book, b); err != nil {
+		return fmt.Errorf("snapshot %s seq %d: %w", snap.Symbol, snap.Seq, err)
+	}
+	t.initBook()
+	t.buyMarketQueue = b.BuyMarket
+	t.sellMarketQueue = b.SellMarket
+	t.buyLimitQueue = fromLevels(b.BuyLimit)
+	t.sellLimitQueue = fromLevels(b.SellLimit)
+	if b.BuyPlate != nil {
+		t.buyTradePlate.Items = b.BuyPlate
+	}
+	if b.SellPlate != nil {
+		t.sellTradePlate.Items = b.SellPlate
+	}
+	t.pendingCancel = make(map[string]int64, len(b.PendingCancel))
+	for _, p := range b.PendingCancel {
+		t.pendingCancel[p.OrderId] = p.Time
+	}
+	t.conf = b.Config
+	t.rebuildExpiring()
+	t.breaker = b.Breaker
+	t.seq = snap.Seq
+	t.snapshotSeq = snap.Seq
+	logx.Infof("撮合快照恢复完成,symbol=%s,seq=%d", t.symbol, snap.Seq)
+	return nil
+}
+
+// takeSnapshot 写一份快照 上次快照之后没有新的指令就跳过
+// 在撮合协程中生成内容 拿到的一定是某条指令处理完之后的状态
+func (t *CoinTrade) takeSnapshot() {
+	if t.seq == t.snapshotSeq {
+		return
+	}
+	if _, err := snapshot.Write(t.snapshotConf, t.symbol, t.seq, time.Now().UnixMilli(), t.book()); err != nil {
+		logx.Errorf("撮合快照写入失败,symbol=%s,seq=%d,err=%v", t.symbol, t.seq, err)
+		return
+	}
+	t.snapshotSeq = t.seq
+}
+
+// findTradingOrders 数据库中交易对所有撮合中的订单
+func (t *CoinTrade) findTradingOrders() ([]*model.ExchangeOrder, error) {
+	orderDomain := domain.NewExchangeOrderDomain(t.db)
+	return orderDomain.FindOrderListBySymbol(context.Background(), t.symbol, model.Trading)
+}
+
+// reconcile 快照之后没有撮合日志可以追 用数据库对齐
+// 数据库里已经不是撮合中的订单从盘口拿掉 快照里没有的订单加进来
+// 快照之后成交的部分数据库也没有记录 只能以数据库为准
+func (t *CoinTrade) reconcile() {
+	orders, err := t.findTradingOrders()
+	if err != nil {
+		logx.Error(err)
+		return
+	}
+	trading := make(map[string]*model.ExchangeOrder, len(orders))
+	for _, v := range orders {
+		trading[v.OrderId] = v
+	}
+	var stale []string
+	for _, queue := range []TradeTimeQueue{t.buyMarketQueue, t.sellMarketQueue} {
+		for _, order := range queue {
+			if _, ok := trading[order.OrderId]; !ok {
+				stale = append(stale, order.OrderId)
+			}
+			delete(trading, order.OrderId)
+		}
+	}
+	for _, lpList := range []*LimitPriceQueue{t.buyLimitQueue, t.sellLimitQueue} {
+		for _, v := range lpList.list {
+			for _, order := range v.list {
+				if _, ok := trading[order.OrderId]; !ok {
+					stale = append(stale, order.OrderId)
+				}
+				delete(trading, order.OrderId)
+			}
+		}
+	}
+	for _, orderId := range stale {
+		t.remove(orderId)
+	}
+	for _, v := range orders {
+		if _, ok := trading[v.OrderId]; !ok {
+			continue
+		}
+		t.input(journal.TypeLoad, v)
+		t.load(v)
+	}
+	logx.Infof("撮合快照按数据库对齐完成,symbol=%s,removed=%d,added=%d", t.symbol, len(stale), len(trading))
+	if t.journal != nil {
+		// 日志比快照旧 快照的序号在日志里对不上 以日志为准重新做一份快照
+		t.seq = t.journal.LastSeq()
+		if t.snapshotConf.Dir != "" {
+			snapshot.RemoveAfter(t.snapshotConf, t.symbol, t.seq)
+			t.snapshotSeq = -1
+			t.takeSnapshot()
+		}
+	}
+	t.publishPlate()
+}
+
+// PrintSnapshot 打印快照文件的内容概要 用来检查快照是否完整
+func PrintSnapshot(name string) error {
+	snap, err := snapshot.Read(name)
+	if err != nil {
+		return err
+	}
+	b := &bookSnapshot{}
+	if err := json.Unmarshal(snap.Book, b); err != nil {
+		return fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	count := func(list []*levelSnapshot) int {
+		n := 0
+		for _, v := range list {
+			n += len(v.Orders)
+		}
+		return n
+	}
+	fmt.Printf("symbol=%s version=%d seq=%d time=%s checksum=ok\n",
+		snap.Symbol, snap.Version, snap.Seq, time.UnixMilli(snap.Time).Format(time.DateTime))
+	fmt.Printf("buy: market=%d limit=%d levels/%d orders plate=%d\n",
+		len(b.BuyMarket), len(b.BuyLimit), count(b.BuyLimit), len(b.BuyPlate))
+	fmt.Printf("sell: market=%d limit=%d levels/%d orders plate=%d\n",
+		len(b.SellMarket), len(b.SellLimit), count(b.SellLimit), len(b.SellPlate))
+	fmt.Printf("pending cancel=%d\n", len(b.PendingCancel))
+	return nil
+}
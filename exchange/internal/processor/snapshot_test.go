@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"exchange/internal/snapshot"
+	"testing"
+)
+
+func bookJSON(t *testing.T, ct *CoinTrade) []byte {
+	t.Helper()
+	data, err := json.Marshal(ct.book())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 快照之后还有指令 重启从快照恢复再追日志 盘口要和没重启的一模一样
+func TestSnapshotRestoreCatchUpSameBook(t *testing.T) {
+	dir := t.TempDir()
+	sc := snapshot.Config{Dir: t.TempDir(), Keep: 3}
+	ct := newTestTrade(t, dir)
+	ct.snapshotConf = sc
+	now := int64(1_700_000_000_000)
+	feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "1", 1, now))
+	feed(t, ct, journal.TypePlace, now+1, limitOrder("s2", model.SELL, "101", "2", 2, now+1))
+	feed(t, ct, journal.TypePlace, now+2, limitOrder("b1", model.BUY, "99", "1", 3, now+2))
+	feed(t, ct, journal.TypeCancel, now+3, &cancelInput{OrderId: "not-arrived"})
+	ct.takeSnapshot()
+	if ct.snapshotSeq != ct.seq {
+		t.Fatalf("snapshot seq %d, engine seq %d", ct.snapshotSeq, ct.seq)
+	}
+	feed(t, ct, journal.TypePlace, now+4, limitOrder("b2", model.BUY, "100.5", "1.5", 4, now+4))
+	feed(t, ct, journal.TypeCancel, now+5, &cancelInput{OrderId: "s2"})
+	feed(t, ct, journal.TypePlace, now+6, limitOrder("s3", model.SELL, "99", "0.5", 5, now+6))
+	feed(t, ct, journal.TypePlace, now+7, limitOrder("b3", model.BUY, "98", "1", 6, now+7))
+	live := bookJSON(t, ct)
+
+	restarted := &CoinTrade{symbol: testSymbol, pendingCancel: make(map[string]int64), snapshotConf: sc}
+	restarted.init(journal.Config{Dir: dir})
+	t.Cleanup(func() { restarted.journal.Close() })
+	if restarted.snapshotSeq == 0 {
+		t.Fatal("restart did not use the snapshot")
+	}
+	if got := bookJSON(t, restarted); !bytes.Equal(got, live) {
+		t.Fatalf("restored book differs\nlive:     %s\nrestored: %s", live, got)
+	}
+	if restarted.seq != ct.seq {
+		t.Fatalf("restored seq %d, live %d", restarted.seq, ct.seq)
+	}
+
+	// 快照加日志回放 和从头回放的成交一样
+	fromSnap, err := Replay(journal.Config{Dir: dir}, sc, testSymbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromSnap.Snapshot == 0 {
+		t.Fatal("replay did not start from the snapshot")
+	}
+	live2 := entries(t, ct.journalFile, journal.TypeTrade)
+	var after []*journal.Entry
+	for _, e := range live2 {
+		if e.Seq > fromSnap.Snapshot {
+			after = append(after, e)
+		}
+	}
+	if fromSnap.Digest != tradeDigest(after) {
+		t.Fatalf("replay from snapshot digest %s, live %s", fromSnap.Digest, tradeDigest(after))
+	}
+}
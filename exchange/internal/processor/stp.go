@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+)
+
+// selfTrade 自成交保护 taker和maker是同一个用户的订单 按交易对配置的模式处理
+// 返回要不要撤掉taker 要不要撤掉maker 撤单由撮合函数在发完成交以后统一发送
+// resting: maker是不是挂在盘口上的限价单 减数量时要一起改盘口
+func (t *CoinTrade) selfTrade(taker *model.ExchangeOrder, maker *model.ExchangeOrder, resting bool) (bool, bool) {
+	switch t.conf.StpMode {
+	case model.StpCancelOldest:
+		return false, true
+	case model.StpCancelBoth:
+		return true, true
+	case model.StpDecrement:
+		// 市价买的数量是金额 没法和对方按数量相减
+		if isMarketBuy(taker) || isMarketBuy(maker) {
+			return true, false
+		}
+		takerRemain := taker.Amount.Sub(taker.TradedAmount)
+		makerRemain := maker.Amount.Sub(maker.TradedAmount)
+		switch takerRemain.Cmp(makerRemain) {
+		case 1:
+			t.decrement(taker, makerRemain, false)
+			return false, true
+		case -1:
+			t.decrement(maker, takerRemain, resting)
+			return true, false
+		}
+		return true, true
+	}
+	return true, false
+}
+
+// decrement 自成交保护减掉订单的数量 按改单通知订单服务和钱包 减掉的部分解冻
+func (t *CoinTrade) decrement(order *model.ExchangeOrder, amount decimal.Decimal, resting bool) {
+	remain := order.Amount.Sub(amount)
+	release := amount
+	if order.Direction == model.BUY {
+		frozen := order.AmendFrozen(order.Price, remain)
+		release = order.FreezeMoney().Sub(frozen)
+		order.Frozen = frozen
+	}
+	if resting {
+		t.resize(order, remain)
+	} else {
+		order.Amount = remain
+	}
+	in := &model.ExchangeOrderAmend{
+		OrderId:    order.OrderId,
+		Symbol:     order.Symbol,
+		MemberId:   order.MemberId,
+		Direction:  order.Direction,
+		BaseSymbol: order.BaseSymbol,
+		CoinSymbol: order.CoinSymbol,
+	}
+	t.sendAmended(in, order, release, "")
+}
+
+// resize 盘口上的限价单原地改数量 排队位置不变 冰山单显示的部分不能超过剩下的
+func (t *CoinTrade) resize(order *model.ExchangeOrder, amount decimal.Decimal) {
+	plate := t.sellTradePlate
+	if order.Direction == model.BUY {
+		plate = t.buyTradePlate
+	}
+	plate.Remove(order, order.Visible())
+	order.Amount = amount
+	if order.IsIceberg() && order.VisibleAmount.GreaterThan(amount.Sub(order.TradedAmount)) {
+		order.VisibleAmount = amount.Sub(order.TradedAmount)
+	}
+	plate.Add(order)
+}
+
+// dropMaker 自成交保护撤掉盘口上的限价单 先从盘口扣掉 队列由撮合函数统一删除
+func (t *CoinTrade) dropMaker(order *model.ExchangeOrder) {
+	if order.Direction == model.BUY {
+		t.buyTradePlate.Remove(order, order.Visible())
+	} else {
+		t.sellTradePlate.Remove(order, order.Visible())
+	}
+	order.Status = model.Canceled
+}
+
+func isMarketBuy(order *model.ExchangeOrder) bool {
+	return order.Type == model.MarketPrice && order.Direction == model.BUY
+}
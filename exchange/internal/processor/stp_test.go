@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"encoding/json"
+	"exchange/internal/journal"
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+	"testing"
+)
+
+// amended 日志里的改单事件 按订单id
+func amended(t *testing.T, ct *CoinTrade) map[string]*model.ExchangeOrderAmended {
+	t.Helper()
+	m := make(map[string]*model.ExchangeOrderAmended)
+	for _, e := range entries(t, ct.journalFile, journal.TypeAmended) {
+		a := &model.ExchangeOrderAmended{}
+		if err := json.Unmarshal(e.Data, a); err != nil {
+			t.Fatal(err)
+		}
+		m[a.OrderId] = a
+	}
+	return m
+}
+
+// plateAmount 卖盘上某个价格的数量
+func plateAmount(ct *CoinTrade, price string) decimal.Decimal {
+	for _, item := range ct.sellTradePlate.GetItems() {
+		if item.Price.Equal(decimal.RequireFromString(price)) {
+			return item.Amount
+		}
+	}
+	return decimal.Zero
+}
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+type stpCase struct {
+	name     string
+	mode     int
+	taker    func(now int64) *model.ExchangeOrder
+	canceled []string          // 按STP撤掉的订单
+	amended  map[string]string // 减数量的订单 减完以后的数量
+	release  map[string]string // 减数量解冻的资金
+	traded   string            // taker成交的数量
+	plate    string            // 卖盘100这一档剩下的数量
+}
+
+// 盘口上 s1 是自己的 100卖1 s2 是别人的 101卖1 taker是s1同一个用户的买单
+var stpCases = []stpCase{
+	{
+		name:     "cancel newest",
+		mode:     model.StpCancelNewest,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1.5", 1, now) },
+		canceled: []string{"b"},
+		traded:   "0",
+		plate:    "1",
+	},
+	{
+		name:     "cancel oldest",
+		mode:     model.StpCancelOldest,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1.5", 1, now) },
+		canceled: []string{"s1"},
+		traded:   "1",
+		plate:    "0",
+	},
+	{
+		name:     "cancel both",
+		mode:     model.StpCancelBoth,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1.5", 1, now) },
+		canceled: []string{"b", "s1"},
+		traded:   "0",
+		plate:    "0",
+	},
+	{
+		name:     "decrement taker bigger",
+		mode:     model.StpDecrement,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1.5", 1, now) },
+		canceled: []string{"s1"},
+		amended:  map[string]string{"b": "0.5"},
+		release:  map[string]string{"b": "101"},
+		traded:   "0.5",
+		plate:    "0",
+	},
+	{
+		name:     "decrement maker bigger",
+		mode:     model.StpDecrement,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "0.4", 1, now) },
+		canceled: []string{"b"},
+		amended:  map[string]string{"s1": "0.6"},
+		release:  map[string]string{"s1": "0.4"},
+		traded:   "0",
+		plate:    "0.6",
+	},
+	{
+		name:     "decrement equal",
+		mode:     model.StpDecrement,
+		taker:    func(now int64) *model.ExchangeOrder { return limitOrder("b", model.BUY, "101", "1", 1, now) },
+		canceled: []string{"b", "s1"},
+		traded:   "0",
+		plate:    "0",
+	},
+	{
+		name:     "decrement market buy cancels taker",
+		mode:     model.StpDecrement,
+		taker:    func(now int64) *model.ExchangeOrder { return marketOrder("b", model.BUY, "150", 1, now) },
+		canceled: []string{"b"},
+		traded:   "0",
+		plate:    "1",
+	},
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	for _, c := range stpCases {
+		t.Run(c.name, func(t *testing.T) {
+			ct := newTestTrade(t, t.TempDir())
+			ct.conf.StpMode = c.mode
+			now := int64(1_700_000_000_000)
+			feed(t, ct, journal.TypePlace, now, limitOrder("s1", model.SELL, "100", "1", 1, now))
+			feed(t, ct, journal.TypePlace, now+1, limitOrder("s2", model.SELL, "101", "1", 2, now+1))
+			taker := c.taker(now + 2)
+			feed(t, ct, journal.TypePlace, taker.Time, taker)
+
+			got := canceled(t, ct)
+			if len(got) != len(c.canceled) {
+				t.Fatalf("canceled %d orders, want %v", len(got), c.canceled)
+			}
+			for _, id := range c.canceled {
+				if got[id] == nil || got[id].Reason != model.CancelSTP {
+					t.Fatalf("order %s canceled=%v, want reason %s", id, got[id], model.CancelSTP)
+				}
+			}
+			am := amended(t, ct)
+			if len(am) != len(c.amended) {
+				t.Fatalf("amended %d orders, want %v", len(am), c.amended)
+			}
+			for id, amount := range c.amended {
+				a := am[id]
+				// 钱包按改单号去重 引擎发起的减数量也要有
+				if a == nil || a.AmendId == "" || !a.Amount.Equal(dec(amount)) || !a.Release.Equal(dec(c.release[id])) {
+					t.Fatalf("order %s amended %+v, want amount %s release %s", id, a, amount, c.release[id])
+				}
+			}
+			if !traded(t, ct, "b").Equal(dec(c.traded)) {
+				t.Fatalf("taker traded %s, want %s", traded(t, ct, "b"), c.traded)
+			}
+			// 自己的订单之间不能有成交
+			if !traded(t, ct, "s1").IsZero() {
+				t.Fatal("self trade happened")
+			}
+			if !plateAmount(ct, "100").Equal(dec(c.plate)) {
+				t.Fatalf("plate at 100 is %s, want %s", plateAmount(ct, "100"), c.plate)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"exchange/internal/database"
+	"exchange/internal/domain"
+	"exchange/internal/model"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/tran"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// TradeListener 成交价回调 在撮合协程中调用 不能阻塞
+type TradeListener func(symbol string, price decimal.Decimal)
+
+// TrailSubmit 跟踪止损单触发后下市价单 返回新订单的订单号
+// 市价单和跟踪止损单改成已触发在同一个事务里提交 跟踪止损单已经撤销的返回 ErrTrailCanceled
+type TrailSubmit func(order *model.ExchangeOrder) (string, error)
+
+var ErrTrailCanceled = errors.New("跟踪止损单已经撤销")
+
+// TriggerBook 止损止盈单触发簿
+// 按交易对保存等待触发的订单 撮合引擎每成交一笔就用成交价检查一次
+// 触发的订单交给单独的协程 按普通订单走冻结资金 -> exchange_order_trading 的流程
+// 跟踪止损单跟着成交价移动水位线 触发后另外下一笔市价单
+type TriggerBook struct {
+	mux         sync.Mutex
+	books       map[string]*triggerList         // 交易对 -> 等待触发的订单
+	lastPrice   map[string]decimal.Decimal      // 交易对最新成交价
+	due         []*model.ExchangeOrder          // 已经触发 等待处理的订单
+	trails      map[string]*model.ExchangeOrder // 水位线移动了还没保存的跟踪止损单
+	submit      TrailSubmit                     // 跟踪止损单触发后的下单方法
+	signal      chan struct{}
+	orderDomain *domain.ExchangeOrderDomain
+	tradeDomain *domain.ExchangeTradeDomain
+	kafkaDomain *domain.KafkaDomain
+	transaction tran.Transaction
+}
+
+// triggerList 一个交易对的触发单 离触发价最近的排在最前面
+type triggerList struct {
+	above    []*model.ExchangeOrder // 涨到触发价触发 按触发价从低到高
+	below    []*model.ExchangeOrder // 跌到触发价触发 按触发价从高到低
+	trailing []*model.ExchangeOrder // 跟踪止损单 触发价会变 不排序
+}
+
+func NewTriggerBook(db *msdb.MsDB, cli *database.KafkaClient) *TriggerBook {
+	orderDomain := domain.NewExchangeOrderDomain(db)
+	b := &TriggerBook{
+		books:       make(map[string]*triggerList),
+		lastPrice:   make(map[string]decimal.Decimal),
+		trails:      make(map[string]*model.ExchangeOrder),
+		signal:      make(chan struct{}, 1),
+		orderDomain: orderDomain,
+		tradeDomain: domain.NewExchangeTradeDomain(db),
+		kafkaDomain: domain.NewKafkaDomain(db, cli, orderDomain),
+		transaction: tran.NewTransaction(db.Conn),
+	}
+	go b.run()
+	return b
+}
+
+// OnTrail 设置跟踪止损单触发后的下单方法
+func (b *TriggerBook) OnTrail(submit TrailSubmit) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.submit = submit
+}
+
+// Init 从数据库加载所有等待触发的订单
+func (b *TriggerBook) Init() {
+	orders, err := b.orderDomain.FindOrderListByStatus(context.Background(), model.Waiting)
+	if err != nil {
+		logx.Error(err)
+		return
+	}
+	for _, v := range orders {
+		b.Add(v)
+	}
+	logx.Infof("止损止盈单加载完成,count=%d", len(orders))
+}
+
+// Condition 按最新成交价决定触发方向 触发价高于最新价的涨上去触发 否则跌下来触发
+// 还没有成交过的交易对 买单按涨上去触发 卖单按跌下来触发
+func (b *TriggerBook) Condition(ctx context.Context, order *model.ExchangeOrder) int {
+	last, ok := b.LastPrice(ctx, order.Symbol)
+	if !ok {
+		if order.Direction == model.BUY {
+			return model.TriggerAbove
+		}
+		return model.TriggerBelow
+	}
+	if order.TriggerPrice.GreaterThan(last) {
+		return model.TriggerAbove
+	}
+	return model.TriggerBelow
+}
+
+// LastPrice 交易对最新成交价 内存里没有的从数据库最后一笔成交取
+func (b *TriggerBook) LastPrice(ctx context.Context, symbol string) (decimal.Decimal, bool) {
+	b.mux.Lock()
+	price, ok := b.lastPrice[symbol]
+	b.mux.Unlock()
+	if ok {
+		return price, true
+	}
+	trade, err := b.tradeDomain.FindLastBySymbol(ctx, symbol)
+	if err != nil || trade == nil {
+		return decimal.Zero, false
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	// 查询期间可能已经有新的成交
+	if price, ok := b.lastPrice[symbol]; ok {
+		return price, true
+	}
+	b.lastPrice[symbol] = trade.Price
+	return trade.Price, true
+}
+
+// Add 加入触发簿 订单要已经保存到数据库
+func (b *TriggerBook) Add(order *model.ExchangeOrder) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	l, ok := b.books[order.Symbol]
+	if !ok {
+		l = &triggerList{}
+		b.books[order.Symbol] = l
+	}
+	if order.Type == model.TrailingStop {
+		l.trailing = append(l.trailing, order)
+		return
+	}
+	if order.TriggerCondition == model.TriggerAbove {
+		i := sort.Search(len(l.above), func(i int) bool {
+			return l.above[i].TriggerPrice.GreaterThan(order.TriggerPrice)
+		})
+		l.above = insertOrder(l.above, i, order)
+	} else {
+		i := sort.Search(len(l.below), func(i int) bool {
+			return l.below[i].TriggerPrice.LessThan(order.TriggerPrice)
+		})
+		l.below = insertOrder(l.below, i, order)
+	}
+}
+
+// Remove 从触发簿中拿掉 撤单时调用
+func (b *TriggerBook) Remove(symbol string, orderId string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	l, ok := b.books[symbol]
+	if !ok {
+		return
+	}
+	l.above = removeOrder(l.above, orderId)
+	l.below = removeOrder(l.below, orderId)
+	l.trailing = removeOrder(l.trailing, orderId)
+}
+
+// OnTrade 撮合引擎的成交价回调 只在内存里挑出触发的订单 数据库和kafka交给 run 协程
+func (b *TriggerBook) OnTrade(symbol string, price decimal.Decimal) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.lastPrice[symbol] = price
+	l, ok := b.books[symbol]
+	if !ok {
+		return
+	}
+	n := len(b.due)
+	i := 0
+	for i < len(l.above) && l.above[i].TriggerPrice.LessThanOrEqual(price) {
+		i++
+	}
+	b.due = append(b.due, l.above[:i]...)
+	l.above = l.above[i:]
+	i = 0
+	for i < len(l.below) && l.below[i].TriggerPrice.GreaterThanOrEqual(price) {
+		i++
+	}
+	b.due = append(b.due, l.below[:i]...)
+	l.below = l.below[i:]
+	// 跟踪止损单先移动水位线 再看有没有回撤到触发价
+	trailed := false
+	i = 0
+	for _, order := range l.trailing {
+		if order.Trail(price) {
+			c := *order
+			b.trails[order.OrderId] = &c
+			trailed = true
+		}
+		if (order.Direction == model.SELL && price.LessThanOrEqual(order.TriggerPrice)) ||
+			(order.Direction == model.BUY && price.GreaterThanOrEqual(order.TriggerPrice)) {
+			b.due = append(b.due, order)
+			continue
+		}
+		l.trailing[i] = order
+		i++
+	}
+	l.trailing = l.trailing[:i]
+	if len(b.due) > n || trailed {
+		select {
+		case b.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run 保存跟踪止损单的水位线 处理触发的订单
+func (b *TriggerBook) run() {
+	for range b.signal {
+		b.mux.Lock()
+		due := b.due
+		b.due = nil
+		trails := b.trails
+		b.trails = make(map[string]*model.ExchangeOrder)
+		b.mux.Unlock()
+		for _, order := range trails {
+			if err := b.orderDomain.UpdateTrail(context.Background(), order); err != nil {
+				logx.Error(err)
+			}
+		}
+		for _, order := range due {
+			if order.Type == model.TrailingStop {
+				b.fireTrail(order)
+			} else {
+				b.fire(order)
+			}
+		}
+	}
+}
+
+// fire 触发的订单改成普通订单 发消息给钱包冻结资金
+// 冻结成功后和普通订单一样进入撮合 余额不足会被钱包撤掉
+// OCO止损单不冻结 直接进入撮合 由撮合引擎撤掉同组的止盈单接过资金
+func (b *TriggerBook) fire(order *model.ExchangeOrder) {
+	for {
+		// 失败会重试 每次都用原来的订单
+		o := *order
+		triggered := false
+		err := b.transaction.Action(func(conn msdb.DbConn) error {
+			ctx := context.Background()
+			ok, err := b.orderDomain.Triggered(ctx, conn, &o)
+			if err != nil || !ok {
+				return err
+			}
+			triggered = true
+			if o.IsOcoStop() {
+				return b.kafkaDomain.SaveTradingOrder(ctx, conn, &o)
+			}
+			return b.kafkaDomain.SaveOrder(ctx, conn, "add-exchange-order",
+				o.MemberId,
+				o.OrderId,
+				o.FreezeMoney(),
+				o.Symbol,
+				o.Direction,
+				o.BaseSymbol,
+				o.CoinSymbol)
+		})
+		if err == nil {
+			if triggered {
+				logx.Infof("止损止盈单触发,orderId=%s,triggerPrice=%s", o.OrderId, o.TriggerPrice.String())
+			}
+			return
+		}
+		logx.Error(err)
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// fireTrail 跟踪止损单触发 走下单流程另外下一笔同方向同数量的市价单
+// 市价单和触发状态一起提交 余额不足之类下单失败的 跟踪止损单改成撤销
+func (b *TriggerBook) fireTrail(order *model.ExchangeOrder) {
+	orderId, err := b.trailSubmit()(order)
+	if errors.Is(err, ErrTrailCanceled) {
+		return
+	}
+	if err != nil {
+		logx.Errorw("跟踪止损单下单失败", logx.Field("orderId", order.OrderId), logx.Field("error", err))
+		if err := b.orderDomain.TrailFailed(context.Background(), order.OrderId); err != nil {
+			logx.Error(err)
+		}
+		return
+	}
+	logx.Infof("跟踪止损单触发,orderId=%s,triggerPrice=%s,marketOrderId=%s", order.OrderId, order.TriggerPrice.String(), orderId)
+}
+
+// trailSubmit 启动时下单方法可能还没设置 等它设置好
+func (b *TriggerBook) trailSubmit() TrailSubmit {
+	for {
+		b.mux.Lock()
+		submit := b.submit
+		b.mux.Unlock()
+		if submit != nil {
+			return submit
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func insertOrder(list []*model.ExchangeOrder, i int, order *model.ExchangeOrder) []*model.ExchangeOrder {
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = order
+	return list
+}
+
+func removeOrder(list []*model.ExchangeOrder, orderId string) []*model.ExchangeOrder {
+	for i, v := range list {
+		if v.OrderId == orderId {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
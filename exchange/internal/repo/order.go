@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"exchange/internal/model"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 )
 
@@ -12,8 +13,20 @@ type ExchangeOrderRepo interface {
 	FindCurrentTradingCount(ctx context.Context, id int64, symbol string, direction int) (int64, error)
 	Save(ctx context.Context, conn msdb.DbConn, order *model.ExchangeOrder) error
 	FindOrderByOrderId(ctx context.Context, orderId string) (*model.ExchangeOrder, error)
-	UpdateStatusCancel(ctx context.Context, orderId string) error
-	UpdateOrderStatusTrading(ctx context.Context, orderId string) error
+	UpdateStatusCancel(ctx context.Context, orderId string) (bool, error)
+	UpdateOrderStatusTrading(ctx context.Context, conn msdb.DbConn, orderId string) (bool, error)
 	FindOrderListBySymbol(ctx context.Context, symbol string, status int) ([]*model.ExchangeOrder, error)
-	UpdateOrderComplete(ctx context.Context, orderId string, tradedAmount float64, turnover float64, status int) error
+	UpdateOrderComplete(ctx context.Context, orderId string, tradedAmount decimal.Decimal, turnover decimal.Decimal, fee decimal.Decimal, status int) error
+	UpdateOrderCanceled(ctx context.Context, orderId string, tradedAmount decimal.Decimal, turnover decimal.Decimal, fee decimal.Decimal, status int, canceledTime int64) error
+	UpdateOrderPrice(ctx context.Context, orderId string, price decimal.Decimal, originalPrice decimal.Decimal) error
+	FindTriggerOrder(ctx context.Context, symbol string, page int64, size int64, memberId int64) ([]*model.ExchangeOrder, int64, error)
+	FindOrderListByStatus(ctx context.Context, status int) ([]*model.ExchangeOrder, error)
+	UpdateTriggered(ctx context.Context, conn msdb.DbConn, orderId string, typ int, status int, time int64) (bool, error)
+	UpdateTriggerCancel(ctx context.Context, orderId string, canceledTime int64) (bool, error)
+	UpdateTrail(ctx context.Context, orderId string, trailMark decimal.Decimal, triggerPrice decimal.Decimal) error
+	UpdateTrailTriggered(ctx context.Context, conn msdb.DbConn, orderId string, completedTime int64) (bool, error)
+	UpdateTrailFailed(ctx context.Context, orderId string, canceledTime int64) error
+	FindOrderListByLinkId(ctx context.Context, linkId string) ([]*model.ExchangeOrder, error)
+	UpdateOrderAmount(ctx context.Context, orderId string, amount decimal.Decimal) error
+	UpdateOrderAmend(ctx context.Context, orderId string, price decimal.Decimal, amount decimal.Decimal, frozen decimal.Decimal) error
 }
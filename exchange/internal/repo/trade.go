@@ -0,0 +1,12 @@
+package repo
+
+import (
+	"context"
+	"exchange/internal/model"
+)
+
+type ExchangeTradeRepo interface {
+	Save(ctx context.Context, trade *model.ExchangeTrade) error
+	FindLastBySymbol(ctx context.Context, symbol string) (*model.ExchangeTrade, error)
+	FindMemberTurnover(ctx context.Context, startTime int64) ([]*model.MemberTurnover, error)
+}
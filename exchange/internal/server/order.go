@@ -39,7 +39,26 @@ func (e *OrderServer) FindByOrderId(ctx context.Context, req *order.OrderReq) (*
 	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
 	return l.FindByOrderId(req)
 }
+
+func (e *OrderServer) AddOco(ctx context.Context, req *order.OrderReq) (*order.AddOcoRes, error) {
+	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
+	return l.AddOco(req)
+}
+
+func (e *OrderServer) AmendOrder(ctx context.Context, req *order.OrderReq) (*order.AmendOrderRes, error) {
+	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
+	return l.AmendOrder(req)
+}
+
+func (e *OrderServer) FindTriggerOrder(ctx context.Context, req *order.OrderReq) (*order.OrderRes, error) {
+	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
+	return l.FindTriggerOrder(req)
+}
 func (e *OrderServer) CancelOrder(ctx context.Context, req *order.OrderReq) (*order.CancelOrderRes, error) {
 	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
 	return l.CancelOrder(req)
-}
\ No newline at end of file
+}
+func (e *OrderServer) FindMemberVolume(ctx context.Context, req *order.VolumeReq) (*order.VolumeRes, error) {
+	l := logic.NewExchangeOrderLogic(ctx, e.svcCtx)
+	return l.FindMemberVolume(req)
+}
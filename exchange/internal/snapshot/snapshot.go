@@ -0,0 +1,165 @@
+// Package snapshot 撮合引擎盘口快照
+// 定时把交易对的队列和盘口写到文件 启动时从最新的有效快照恢复 再从撮合日志或者数据库追上之后的变化
+// 文件名 BTC_USDT.<seq>.snapshot 先写临时文件再改名 不会留下写了一半的快照
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version 快照格式版本 格式不兼容的修改要加1 旧版本的快照不再加载
+const Version = 2
+
+type Config struct {
+	Dir      string `json:"dir,optional"`        // 为空不做快照
+	Interval int    `json:"interval,default=60"` // 间隔秒数
+	Keep     int    `json:"keep,default=3"`      // 每个交易对保留几份
+}
+
+type Snapshot struct {
+	Version  int             `json:"version"`
+	Symbol   string          `json:"symbol"`
+	Seq      int64           `json:"seq"`  // 快照包含了这个序号及之前的所有指令
+	Time     int64           `json:"time"` // 生成时间
+	Checksum string          `json:"checksum"`
+	Book     json.RawMessage `json:"book"`
+}
+
+func prefix(symbol string) string {
+	return strings.ReplaceAll(symbol, "/", "_") + "."
+}
+
+// FileName BTC/USDT 123 -> dir/BTC_USDT.000000000123.snapshot 补0是为了按文件名排序
+func FileName(dir string, symbol string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%012d.snapshot", prefix(symbol), seq))
+}
+
+func checksum(book []byte) string {
+	sum := sha256.Sum256(book)
+	return hex.EncodeToString(sum[:])
+}
+
+// Write 写入快照 并删除多余的旧快照
+func Write(c Config, symbol string, seq int64, time int64, book any) (string, error) {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return "", err
+	}
+	s := &Snapshot{
+		Version:  Version,
+		Symbol:   symbol,
+		Seq:      seq,
+		Time:     time,
+		Checksum: checksum(data),
+		Book:     data,
+	}
+	content, _ := json.Marshal(s)
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return "", err
+	}
+	name := FileName(c.Dir, symbol, seq)
+	tmp := name + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", err
+	}
+	clean(c, symbol)
+	return name, nil
+}
+
+// clean 只保留最新的 Keep 份
+func clean(c Config, symbol string) {
+	keep := c.Keep
+	if keep <= 0 {
+		keep = 1
+	}
+	files := list(c.Dir, symbol)
+	for i := keep; i < len(files); i++ {
+		os.Remove(files[i])
+	}
+}
+
+// list 交易对的快照文件 新的在前
+func list(dir string, symbol string) []string {
+	files, _ := filepath.Glob(filepath.Join(dir, prefix(symbol)+"*.snapshot"))
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files
+}
+
+// RemoveAfter 删除序号大于seq的快照 撮合日志比快照旧的时候 这些快照已经和日志对不上了
+func RemoveAfter(c Config, symbol string, seq int64) {
+	for _, name := range list(c.Dir, symbol) {
+		if fileSeq(name, symbol) > seq {
+			os.Remove(name)
+		}
+	}
+}
+
+func fileSeq(name string, symbol string) int64 {
+	seq, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), prefix(symbol)), ".snapshot"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return seq
+}
+
+// Read 读取并校验快照文件
+func Read(name string) (*Snapshot, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	if s.Version != Version {
+		return s, fmt.Errorf("snapshot %s: version %d, want %d", name, s.Version, Version)
+	}
+	if s.Checksum != checksum(s.Book) {
+		return s, fmt.Errorf("snapshot %s: checksum mismatch", name)
+	}
+	return s, nil
+}
+
+// Latest 最新的有效快照 maxSeq大于0时只找序号不超过它的 没有返回nil
+// 损坏的快照会跳过 继续找更早的
+func Latest(c Config, symbol string, maxSeq int64) (*Snapshot, error) {
+	var errs []error
+	for _, name := range list(c.Dir, symbol) {
+		seq := fileSeq(name, symbol)
+		if seq < 0 || (maxSeq > 0 && seq > maxSeq) {
+			continue
+		}
+		s, err := Read(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return s, errors.Join(errs...)
+	}
+	return nil, errors.Join(errs...)
+}
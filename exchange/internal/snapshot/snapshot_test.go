@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testBook struct {
+	Orders []string `json:"orders"`
+}
+
+func write(t *testing.T, c Config, seq int64) string {
+	t.Helper()
+	name, err := Write(c, "BTC/USDT", seq, seq*1000, &testBook{Orders: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// rewrite 改掉快照文件里的内容
+func rewrite(t *testing.T, name string, fn func(s *Snapshot)) {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(content, s); err != nil {
+		t.Fatal(err)
+	}
+	fn(s)
+	content, _ = json.Marshal(s)
+	if err := os.WriteFile(name, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corrupt 改掉盘口内容 不动校验和
+func corrupt(t *testing.T, name string) {
+	t.Helper()
+	rewrite(t, name, func(s *Snapshot) {
+		s.Book = json.RawMessage(`{"orders":["a","c"]}`)
+	})
+}
+
+func TestReadRejectsChecksumMismatch(t *testing.T) {
+	c := Config{Dir: t.TempDir(), Keep: 3}
+	name := write(t, c, 5)
+	if _, err := Read(name); err != nil {
+		t.Fatal(err)
+	}
+	corrupt(t, name)
+	_, err := Read(name)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("corrupt snapshot read err = %v", err)
+	}
+}
+
+func TestReadRejectsOtherVersion(t *testing.T) {
+	c := Config{Dir: t.TempDir(), Keep: 3}
+	name := write(t, c, 5)
+	rewrite(t, name, func(s *Snapshot) {
+		s.Version = Version - 1
+	})
+	if _, err := Read(name); err == nil {
+		t.Fatal("old version snapshot should be rejected")
+	}
+}
+
+func TestLatestSkipsCorrupt(t *testing.T) {
+	c := Config{Dir: t.TempDir(), Keep: 3}
+	write(t, c, 5)
+	write(t, c, 10)
+	corrupt(t, write(t, c, 15))
+	s, err := Latest(c, "BTC/USDT", 0)
+	if s == nil || s.Seq != 10 {
+		t.Fatalf("latest = %+v, want seq 10", s)
+	}
+	// 跳过的快照要报出来
+	if err == nil {
+		t.Fatal("corrupt snapshot should be reported")
+	}
+}
+
+func TestLatestSkipsNewerThanJournal(t *testing.T) {
+	c := Config{Dir: t.TempDir(), Keep: 3}
+	write(t, c, 5)
+	write(t, c, 10)
+	write(t, c, 15)
+	s, err := Latest(c, "BTC/USDT", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil || s.Seq != 10 {
+		t.Fatalf("latest = %+v, want seq 10", s)
+	}
+	s, _ = Latest(c, "BTC/USDT", 4)
+	if s != nil {
+		t.Fatalf("latest = %+v, want none", s)
+	}
+}
+
+func TestWriteKeepsNewest(t *testing.T) {
+	c := Config{Dir: t.TempDir(), Keep: 2}
+	for _, seq := range []int64{5, 10, 15} {
+		write(t, c, seq)
+	}
+	files := list(c.Dir, "BTC/USDT")
+	if len(files) != 2 || fileSeq(files[0], "BTC/USDT") != 15 || fileSeq(files[1], "BTC/USDT") != 10 {
+		t.Fatalf("files = %v", files)
+	}
+}
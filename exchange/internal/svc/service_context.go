@@ -9,6 +9,7 @@ import (
 	"grpc-common/market/mclient"
 	"grpc-common/ucenter/ucclient"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
 
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/zrpc"
@@ -23,12 +24,21 @@ type ServiceContext struct {
 	MarketRpc   mclient.Market
 	AssetRpc    ucclient.Asset
 	KafkaClient *database.KafkaClient
+	TriggerBook *processor.TriggerBook
 }
 
 func (sc *ServiceContext) init() {
+	// 事务里写进outbox的消息 提交以后由relay发给kafka
+	outbox.NewRelay(sc.Db, func(topic string, key []byte, data []byte) error {
+		return sc.KafkaClient.SendKeyed(database.KafkaData{Topic: topic, Key: key, Data: data})
+	}).Start()
+	// 止损止盈单看撮合引擎的成交价触发
+	sc.TriggerBook = processor.NewTriggerBook(sc.Db, sc.KafkaClient)
+	sc.TriggerBook.Init()
 	factory := processor.NewCoinTradeFactory()
-	factory.Init(sc.MarketRpc, sc.KafkaClient, sc.Db)
-	kafkaConsumer := consumer.NewKafkaConsumer(sc.KafkaClient, factory, sc.Db)
+	factory.OnTrade(sc.TriggerBook.OnTrade)
+	factory.Init(sc.MarketRpc, sc.KafkaClient, sc.Db, sc.Config.Journal, sc.Config.Snapshot)
+	kafkaConsumer := consumer.NewKafkaConsumer(sc.KafkaClient, factory, sc.Db, sc.TriggerBook)
 	kafkaConsumer.Run()
 }
 
@@ -2,6 +2,8 @@ package main
 
 import (
 	"exchange/internal/config"
+	"exchange/internal/logic"
+	"exchange/internal/processor"
 	"exchange/internal/server"
 	"exchange/internal/svc"
 	"flag"
@@ -13,17 +15,33 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"grpc-common/exchange/types/order"
+	"os"
 )
 
 var configFile = flag.String("f", "etc/conf.yaml", "the config file")
+var replay = flag.Bool("replay", false, "replay the matching journal of every symbol, print the fill digest and exit")
+var snapshotFile = flag.String("snapshot", "", "verify a matching engine snapshot file, print its summary and exit")
 
 func main() {
 	flag.Parse()
+	if *snapshotFile != "" {
+		if err := processor.PrintSnapshot(*snapshotFile); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	//日志的打印格式替换一下
 	logx.MustSetup(logx.LogConf{Stat: false, Encoding: "plain"})
 	var c config.Config
 	conf.MustLoad(*configFile, &c)
+	if *replay {
+		replayJournal(c)
+		return
+	}
 	ctx := svc.NewServiceContext(c)
+	// 跟踪止损单触发后走普通下单流程
+	ctx.TriggerBook.OnTrail(logic.NewTrailSubmit(ctx))
 
 	s := zrpc.MustNewServer(c.RpcServerConf, func(grpcServer *grpc.Server) {
 		order.RegisterOrderServer(grpcServer, server.NewOrderServer(ctx))
@@ -37,3 +55,15 @@ func main() {
 	fmt.Printf("Starting rpc server at %s...\n", c.ListenOn)
 	s.Start()
 }
+
+// replayJournal 回放撮合日志 同一份日志每次回放的成交摘要必须一样
+func replayJournal(c config.Config) {
+	results, err := processor.ReplayAll(c.Journal, c.Snapshot)
+	for _, r := range results {
+		fmt.Printf("%s snapshot=%d entries=%d inputs=%d trades=%d seq=%d digest=%s\n", r.Symbol, r.Snapshot, r.Entries, r.Inputs, r.Trades, r.LastSeq, r.Digest)
+	}
+	if err != nil {
+		logx.Error(err)
+		os.Exit(1)
+	}
+}
@@ -14,8 +14,13 @@ type (
 	OrderReq            = order.OrderReq
 	OrderRes            = order.OrderRes
 	AddOrderRes         = order.AddOrderRes
+	AddOcoRes           = order.AddOcoRes
 	ExchangeOrderOrigin = order.ExchangeOrderOrigin
 	CancelOrderRes      = order.CancelOrderRes
+	AmendOrderRes       = order.AmendOrderRes
+	VolumeReq           = order.VolumeReq
+	VolumeRes           = order.VolumeRes
+	MemberVolume        = order.MemberVolume
 
 	Order interface {
 		FindOrderHistory(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*OrderRes, error)
@@ -23,6 +28,10 @@ type (
 		Add(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*AddOrderRes, error)
 		FindByOrderId(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*ExchangeOrderOrigin, error)
 		CancelOrder(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*CancelOrderRes, error)
+		FindTriggerOrder(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*OrderRes, error)
+		AddOco(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*AddOcoRes, error)
+		AmendOrder(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*AmendOrderRes, error)
+		FindMemberVolume(ctx context.Context, in *VolumeReq, opts ...grpc.CallOption) (*VolumeRes, error)
 	}
 
 	defaultOrder struct {
@@ -55,6 +64,26 @@ func (d *defaultOrder) FindOrderCurrent(ctx context.Context, in *OrderReq, opts
 	return client.FindOrderCurrent(ctx, in, opts...)
 }
 
+func (d *defaultOrder) FindTriggerOrder(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*OrderRes, error) {
+	client := order.NewOrderClient(d.cli.Conn())
+	return client.FindTriggerOrder(ctx, in, opts...)
+}
+
+func (d *defaultOrder) AddOco(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*AddOcoRes, error) {
+	client := order.NewOrderClient(d.cli.Conn())
+	return client.AddOco(ctx, in, opts...)
+}
+
+func (d *defaultOrder) AmendOrder(ctx context.Context, in *OrderReq, opts ...grpc.CallOption) (*AmendOrderRes, error) {
+	client := order.NewOrderClient(d.cli.Conn())
+	return client.AmendOrder(ctx, in, opts...)
+}
+
+func (d *defaultOrder) FindMemberVolume(ctx context.Context, in *VolumeReq, opts ...grpc.CallOption) (*VolumeRes, error) {
+	client := order.NewOrderClient(d.cli.Conn())
+	return client.FindMemberVolume(ctx, in, opts...)
+}
+
 func NewOrder(cli zrpc.Client) Order {
 	return &defaultOrder{
 		cli: cli,
@@ -17,6 +17,8 @@ type (
 	AssetResp     = asset.AssetResp
 	MemberTransactionList     = asset.MemberTransactionList
 	AddressList = asset.AddressList
+	MemberLedgerList = asset.MemberLedgerList
+	LedgerStatement  = asset.LedgerStatement
 
 	Asset interface {
 		FindWalletBySymbol(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*MemberWallet, error)
@@ -24,6 +26,8 @@ type (
 		ResetAddress(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*AssetResp, error)
 		FindTransaction(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*MemberTransactionList, error)
 		GetAddress(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*AddressList, error)
+		FindLedger(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*MemberLedgerList, error)
+		FindStatement(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*LedgerStatement, error)
 	}
 
 	defaultAsset struct {
@@ -57,4 +61,13 @@ func (m *defaultAsset) FindTransaction(ctx context.Context, in *AssetReq, opts .
 func (m *defaultAsset) GetAddress(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*AddressList, error) {
 	client := asset.NewAssetClient(m.cli.Conn())
 	return client.GetAddress(ctx, in, opts...)
-}
\ No newline at end of file
+}
+func (m *defaultAsset) FindLedger(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*MemberLedgerList, error) {
+	client := asset.NewAssetClient(m.cli.Conn())
+	return client.FindLedger(ctx, in, opts...)
+}
+
+func (m *defaultAsset) FindStatement(ctx context.Context, in *AssetReq, opts ...grpc.CallOption) (*LedgerStatement, error) {
+	client := asset.NewAssetClient(m.cli.Conn())
+	return client.FindStatement(ctx, in, opts...)
+}
@@ -13,9 +13,19 @@ import (
 type (
 	MemberReq     = member.MemberReq
 	MemberInfo     = member.MemberInfo
+	FeeTierReq     = member.FeeTierReq
+	FeeTierRes     = member.FeeTierRes
+	MemberVolume   = member.MemberVolume
+	CommissionReq    = member.CommissionReq
+	CommissionRes    = member.CommissionRes
+	CommissionInfo   = member.CommissionInfo
+	CommissionAmount = member.CommissionAmount
 
 	Member interface {
 		FindMemberById(ctx context.Context, in *MemberReq, opts ...grpc.CallOption) (*MemberInfo, error)
+		RefreshFeeTier(ctx context.Context, in *FeeTierReq, opts ...grpc.CallOption) (*FeeTierRes, error)
+		PayCommission(ctx context.Context, in *CommissionReq, opts ...grpc.CallOption) (*CommissionRes, error)
+		FindCommission(ctx context.Context, in *MemberReq, opts ...grpc.CallOption) (*CommissionInfo, error)
 	}
 
 	defaultMember struct {
@@ -32,4 +42,18 @@ func NewMember(cli zrpc.Client) Member {
 func (m *defaultMember) FindMemberById(ctx context.Context, in *MemberReq, opts ...grpc.CallOption) (*MemberInfo, error) {
 	client := member.NewMemberClient(m.cli.Conn())
 	return client.FindMemberById(ctx, in, opts...)
-}
\ No newline at end of file
+}
+
+func (m *defaultMember) RefreshFeeTier(ctx context.Context, in *FeeTierReq, opts ...grpc.CallOption) (*FeeTierRes, error) {
+	client := member.NewMemberClient(m.cli.Conn())
+	return client.RefreshFeeTier(ctx, in, opts...)
+}
+func (m *defaultMember) PayCommission(ctx context.Context, in *CommissionReq, opts ...grpc.CallOption) (*CommissionRes, error) {
+	client := member.NewMemberClient(m.cli.Conn())
+	return client.PayCommission(ctx, in, opts...)
+}
+
+func (m *defaultMember) FindCommission(ctx context.Context, in *MemberReq, opts ...grpc.CallOption) (*CommissionInfo, error) {
+	client := member.NewMemberClient(m.cli.Conn())
+	return client.FindCommission(ctx, in, opts...)
+}
@@ -14,5 +14,9 @@ type Config struct {
 	CacheRedis cache.CacheConf
 	Kafka      database.KafkaConfig
 	UCenterRpc zrpc.RpcClientConf
-	Bitcoin    logic.BitCoinConfig
+	// ExchangeRpc 统计会员成交额 计算手续费等级
+	ExchangeRpc zrpc.RpcClientConf
+	Bitcoin     logic.BitCoinConfig
+	// PlatformCoin 平台币 定时缓存它的USDT价格 ucenter用平台币抵扣手续费时换算
+	PlatformCoin string
 }
@@ -0,0 +1,30 @@
+package logic
+
+import (
+	"context"
+	"grpc-common/ucenter/ucclient"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type Commission struct {
+	memberRpc ucclient.Member
+}
+
+func NewCommission(memberRpc ucclient.Member) *Commission {
+	return &Commission{
+		memberRpc: memberRpc,
+	}
+}
+
+// Do 让ucenter把结算时记下的邀请返佣批量转给邀请人 每次的条数按ucenter的配置
+func (c *Commission) Do() {
+	res, err := c.memberRpc.PayCommission(context.Background(), &ucclient.CommissionReq{})
+	if err != nil {
+		logx.Errorw("PayCommission failed", logx.Field("error", err))
+		return
+	}
+	if res.Total > 0 {
+		logx.Infof("邀请返佣发放完成,count=%d", res.Total)
+	}
+}
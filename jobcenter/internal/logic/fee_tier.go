@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"context"
+	"grpc-common/exchange/eclient"
+	"grpc-common/ucenter/ucclient"
+	"mscoin-common/tools"
+	"strings"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+)
+
+// feeTierDays 手续费等级按多少天的成交额算
+const feeTierDays = 30
+
+type FeeTier struct {
+	orderRpc  eclient.Order
+	memberRpc ucclient.Member
+	cache     cache.Cache
+}
+
+func NewFeeTier(orderRpc eclient.Order, memberRpc ucclient.Member, cache cache.Cache) *FeeTier {
+	return &FeeTier{
+		orderRpc:  orderRpc,
+		memberRpc: memberRpc,
+		cache:     cache,
+	}
+}
+
+// Do 统计每个会员30天的成交额 换算成USDT 交给ucenter重新计算手续费等级
+// 成交额是结算币种的 不是USDT结算的按缓存的最新价格换算 没有价格的交易对不算
+func (f *FeeTier) Do() {
+	ctx := context.Background()
+	startTime := time.Now().AddDate(0, 0, -feeTierDays).UnixMilli()
+	volumeRes, err := f.orderRpc.FindMemberVolume(ctx, &eclient.VolumeReq{StartTime: startTime})
+	if err != nil {
+		logx.Errorw("FindMemberVolume failed", logx.Field("error", err))
+		return
+	}
+	volumes := make(map[int64]float64)
+	rates := make(map[string]float64)
+	for _, v := range volumeRes.List {
+		baseSymbol := v.Symbol[strings.Index(v.Symbol, "/")+1:]
+		rate, ok := rates[baseSymbol]
+		if !ok {
+			rate = f.usdtRate(baseSymbol)
+			rates[baseSymbol] = rate
+		}
+		if rate <= 0 {
+			continue
+		}
+		volumes[v.MemberId] += v.Turnover * rate
+	}
+	req := &ucclient.FeeTierReq{}
+	for memberId, volume := range volumes {
+		req.List = append(req.List, &ucclient.MemberVolume{MemberId: memberId, Volume: volume})
+	}
+	res, err := f.memberRpc.RefreshFeeTier(ctx, req)
+	if err != nil {
+		logx.Errorw("RefreshFeeTier failed", logx.Field("error", err))
+		return
+	}
+	logx.Infof("手续费等级计算完成,members=%d", res.Total)
+}
+
+// usdtRate k线任务缓存的最新价格 没有缓存返回0
+func (f *FeeTier) usdtRate(symbol string) float64 {
+	if symbol == "USDT" {
+		return 1
+	}
+	var rate string
+	f.cache.Get(symbol+"::USDT::RATE", &rate)
+	if rate == "" {
+		logx.Infof("没有%s的USDT价格,不计入手续费等级", symbol)
+		return 0
+	}
+	return tools.ToFloat64(rate)
+}
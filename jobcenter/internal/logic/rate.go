@@ -11,15 +11,17 @@ import (
 )
 
 type Rate struct {
-	wg    sync.WaitGroup
-	okx   OkxConfig
-	Cache cache.Cache
+	wg           sync.WaitGroup
+	okx          OkxConfig
+	Cache        cache.Cache
+	platformCoin string
 }
 
-func NewRate(okx OkxConfig, cache cache.Cache) *Rate {
+func NewRate(okx OkxConfig, cache cache.Cache, platformCoin string) *Rate {
 	return &Rate{
-		okx:   okx,
-		Cache: cache,
+		okx:          okx,
+		Cache:        cache,
+		platformCoin: platformCoin,
 	}
 }
 
@@ -32,11 +34,24 @@ type ExchangeRate struct {
 	UsdCny string `json:"usdCny"`
 }
 
+type OkxTickerResult struct {
+	Code string   `json:"code"`
+	Msg  string   `json:"msg"`
+	Data []Ticker `json:"data"`
+}
+type Ticker struct {
+	Last string `json:"last"`
+}
+
 var redisKey = "USDT::CNY::RATE"
 
 func (r *Rate) Do() {
 	r.wg.Add(1)
 	go r.CnyUsdRate()
+	if r.platformCoin != "" {
+		r.wg.Add(1)
+		go r.PlatformCoinRate()
+	}
 	r.wg.Wait()
 
 }
@@ -76,3 +91,32 @@ func (r *Rate) CnyUsdRate() {
 	r.wg.Done()
 
 }
+
+// PlatformCoinRate 平台币的USDT价格 和k线里缓存的最新价格用一样的key
+func (r *Rate) PlatformCoinRate() {
+	defer r.wg.Done()
+	instId := r.platformCoin + "-USDT"
+	api := r.okx.Host + "/api/v5/market/ticker?instId=" + instId
+	timestamp := tools.ISO(time.Now())
+	sign := tools.ComputeHmacSha256(timestamp+"GET"+"/api/v5/market/ticker?instId="+instId, r.okx.SecretKey)
+	header := make(map[string]string)
+	header["OK-ACCESS-KEY"] = r.okx.ApiKey
+	header["OK-ACCESS-SIGN"] = sign
+	header["OK-ACCESS-TIMESTAMP"] = timestamp
+	header["OK-ACCESS-PASSPHRASE"] = r.okx.Pass
+	res, err := tools.GetWithHeader(api, header, r.okx.Proxy)
+	if err != nil {
+		logx.Errorw("get platform coin rate failed", logx.Field("error", err))
+		return
+	}
+	var result OkxTickerResult
+	err = json.Unmarshal(res, &result)
+	if err != nil || len(result.Data) == 0 {
+		logx.Errorw("unmarshal platform coin rate failed", logx.Field("error", err), logx.Field("msg", result.Msg))
+		return
+	}
+	err = r.Cache.Set(r.platformCoin+"::USDT::RATE", result.Data[0].Last)
+	if err != nil {
+		logx.Errorw("set platform coin rate failed", logx.Field("error", err))
+	}
+}
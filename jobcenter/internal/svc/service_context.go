@@ -1,6 +1,7 @@
 package svc
 
 import (
+	"grpc-common/exchange/eclient"
 	"grpc-common/ucenter/ucclient"
 	"jobcenter/internal/config"
 	"jobcenter/internal/database"
@@ -15,6 +16,8 @@ type ServiceContext struct {
 	Cache          cache.Cache
 	KafkaClient    *database.KafkaClient
 	AssetRpc       ucclient.Asset
+	MemberRpc      ucclient.Member
+	OrderRpc       eclient.Order
 	BitCoinAddress string
 }
 
@@ -29,13 +32,16 @@ func NewServiceContext(c config.Config) *ServiceContext {
 	// 初始化 kafka
 	client := database.NewKafkaClient(c.Kafka)
 	client.StartWrite()
+	ucenterCli := zrpc.MustNewClient(c.UCenterRpc)
 
 	return &ServiceContext{
 		Config:         c,
 		MongoClient:    database.ConnectMongo(c.Mongo),
 		Cache:          redisCache,
 		KafkaClient:    client,
-		AssetRpc:       ucclient.NewAsset(zrpc.MustNewClient(c.UCenterRpc)),
+		AssetRpc:       ucclient.NewAsset(ucenterCli),
+		MemberRpc:      ucclient.NewMember(ucenterCli),
+		OrderRpc:       eclient.NewOrder(zrpc.MustNewClient(c.ExchangeRpc)),
 		BitCoinAddress: c.Bitcoin.Address,
 	}
 }
@@ -57,7 +57,17 @@ func (t *Task) Run() {
 	})
 
 	t.s.Every(1).Minute().Do(func() {
-		logic.NewRate(t.ctx.Config.Okx, t.ctx.Cache).Do()
+		logic.NewRate(t.ctx.Config.Okx, t.ctx.Cache, t.ctx.Config.PlatformCoin).Do()
+	})
+
+	// 每天按30天成交额重新计算会员的手续费等级
+	t.s.Every(1).Day().At("00:05").Do(func() {
+		logic.NewFeeTier(t.ctx.OrderRpc, t.ctx.MemberRpc, t.ctx.Cache).Do()
+	})
+
+	// 每10分钟发一次邀请返佣
+	t.s.Every(10).Minute().Do(func() {
+		logic.NewCommission(t.ctx.MemberRpc).Do()
 	})
 
 	//十分钟生成一个区块
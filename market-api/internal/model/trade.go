@@ -13,3 +13,20 @@ type TradePlateItem struct {
 	Price  float64 `json:"price"`
 	Amount float64 `json:"amount"`
 }
+
+// SymbolHalt 交易对熔断通知 halted为false表示恢复撮合
+type SymbolHalt struct {
+	Symbol string  `json:"symbol"`
+	Halted bool    `json:"halted"`
+	Until  int64   `json:"until"`
+	Low    float64 `json:"low"`
+	High   float64 `json:"high"`
+}
+
+// AuctionIndicative 集合竞价期间的参考成交价和成交量
+type AuctionIndicative struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+	Volume float64 `json:"volume"`
+	Until  int64   `json:"until"`
+}
@@ -15,6 +15,10 @@ const KLINE = "kline"
 const TRADE = "trade"
 const TradePlateTopic = "exchange_order_trade_plate"
 const TradePlate = "tradePlate"
+const HaltTopic = "exchange_symbol_halt"
+const Halt = "halt"
+const IndicativeTopic = "exchange_auction_indicative"
+const Indicative = "indicative"
 
 // 主题接口（Subject）
 type Processor interface {
@@ -28,6 +32,8 @@ type MarketHandler interface {
 	HandleTrade(symbol string, data []byte)
 	HandleKLine(symbol string, kline *model.Kline, thumbMap map[string]*market.CoinThumb)
 	HandleTradePlate(symbol string, tp *model.TradePlateResult)
+	HandleHalt(symbol string, halt *model.SymbolHalt)
+	HandleIndicative(symbol string, indicative *model.AuctionIndicative)
 }
 
 type ProcessData struct {
@@ -58,6 +64,8 @@ func (d *DefaultProcessor) AddHandler(h MarketHandler) {
 func (p *DefaultProcessor) Init(marketRpc mclient.Market) {
 	p.startReadFromKafka(KLINE1M, KLINE)
 	p.startReadTradePlate(TradePlateTopic)
+	p.startReadHalt(HaltTopic)
+	p.startReadIndicative(IndicativeTopic)
 	p.initThumbMap(marketRpc)
 }
 func (d *DefaultProcessor) GetThumb() any {
@@ -105,6 +113,20 @@ func (d *DefaultProcessor) Process(data ProcessData) {
 		for _, v := range d.handlers {
 			v.HandleTradePlate(symbol, tp)
 		}
+	} else if data.Type == Halt {
+		symbol := string(data.Key)
+		halt := &model.SymbolHalt{}
+		json.Unmarshal(data.Data, halt)
+		for _, v := range d.handlers {
+			v.HandleHalt(symbol, halt)
+		}
+	} else if data.Type == Indicative {
+		symbol := string(data.Key)
+		indicative := &model.AuctionIndicative{}
+		json.Unmarshal(data.Data, indicative)
+		for _, v := range d.handlers {
+			v.HandleIndicative(symbol, indicative)
+		}
 	}
 }
 
@@ -125,3 +147,15 @@ func (p *DefaultProcessor) startReadTradePlate(topic string) {
 	cli := p.kafkaCli.StartReadNew(topic)
 	go p.dealQueueData(cli, TradePlate)
 }
+
+// startReadHalt 撮合引擎的熔断和恢复通知
+func (p *DefaultProcessor) startReadHalt(topic string) {
+	cli := p.kafkaCli.StartReadNew(topic)
+	go p.dealQueueData(cli, Halt)
+}
+
+// startReadIndicative 集合竞价的参考成交价
+func (p *DefaultProcessor) startReadIndicative(topic string) {
+	cli := p.kafkaCli.StartReadNew(topic)
+	go p.dealQueueData(cli, Indicative)
+}
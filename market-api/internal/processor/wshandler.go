@@ -25,6 +25,20 @@ func (w *WebsocketHandler) HandleTradePlate(symbol string, plate *model.TradePla
 	logx.Info("====买卖盘通知:", symbol, plate.Direction, ":", fmt.Sprintf("%d", len(plate.Items)))
 	w.wsServer.BroadcastToNamespace("/", "/topic/market/trade-plate/"+symbol, string(bytes))
 }
+
+// HandleHalt 交易对熔断或者恢复撮合 推给订阅了这个交易对的客户端
+func (w *WebsocketHandler) HandleHalt(symbol string, halt *model.SymbolHalt) {
+	bytes, _ := json.Marshal(halt)
+	logx.Info("====熔断通知:", symbol, ":", fmt.Sprintf("%v", halt.Halted))
+	w.wsServer.BroadcastToNamespace("/", "/topic/market/halt/"+symbol, string(bytes))
+}
+
+// HandleIndicative 集合竞价期间的参考成交价和成交量
+func (w *WebsocketHandler) HandleIndicative(symbol string, indicative *model.AuctionIndicative) {
+	bytes, _ := json.Marshal(indicative)
+	w.wsServer.BroadcastToNamespace("/", "/topic/market/auction/"+symbol, string(bytes))
+}
+
 func (w *WebsocketHandler) HandleTrade(symbol string, data []byte) {
 	//订单交易完成后 进入这里进行处理 订单就称为K线的一部分 数据量小 无法维持K线 K线来源 okx平台来
 	//TODO implement me
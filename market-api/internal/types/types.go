@@ -46,7 +46,8 @@ type ExchangeCoinResp struct {
 	CoinScale        int64   `json:"coinScale"`         // 交易币小数精度
 	CoinSymbol       string  `json:"coinSymbol"`        // 交易币种符号
 	Enable           int64   `json:"enable"`             // 状态，1：启用，2：禁止
-	Fee              float64 `json:"fee"`                // 交易手续费
+	Fee              float64 `json:"fee"`                // 交易手续费，吃单(taker)费率
+	MakerFee         float64 `json:"makerFee"`           // 挂单(maker)手续费率
 	Sort             int64   `json:"sort"`               // 排序，从小到大
 	EnableMarketBuy  int64   `json:"enableMarketBuy"`  // 是否启用市价买
 	EnableMarketSell int64   `json:"enableMarketSell"` // 是否启用市价卖
@@ -68,6 +69,12 @@ type ExchangeCoinResp struct {
 	StartTime        int64   `json:"startTime"`         // 开始时间
 	Visible          int64   `json:"visible"`            //  前台可见状态
 	Zone             int64   `json:"zone"`               // 交易区域
+	StpMode          int64   `json:"stpMode"`            // 自成交保护模式 0:撤新订单,1:撤旧订单,2:都撤,3:减数量
+	PriceBand        float64 `json:"priceBand"`          // 限价单偏离最新成交价的最大百分比，0表示不限制
+	SweepLimit       float64 `json:"sweepLimit"`         // 市价单最多吃到离第一笔成交价的百分比，0表示不限制
+	HaltThreshold    float64 `json:"haltThreshold"`      // 熔断，窗口内成交价波动超过这个百分比暂停撮合，0表示不启用
+	HaltWindow       int64   `json:"haltWindow"`         // 熔断统计窗口，单位为秒
+	HaltCooldown     int64   `json:"haltCooldown"`       // 熔断后暂停撮合的时间，单位为秒
 	CurrentTime int64 `json:"currentTime"` //当前毫秒值
 	MarketEngineStatus int `json:"marketEngineStatus"` //行情引擎状态（0：不可用，1：可用
 	EngineStatus int `json:"engineStatus"` //交易引擎状态（0：不可用，1：可用
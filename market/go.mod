@@ -3,6 +3,7 @@ module market
 go 1.24
 
 require (
+	github.com/jinzhu/copier v0.4.0
 	github.com/zeromicro/go-zero v1.8.2
 	go.mongodb.org/mongo-driver v1.17.3
 	google.golang.org/grpc v1.71.1
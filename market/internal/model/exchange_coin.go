@@ -8,7 +8,8 @@ type ExchangeCoin struct {
 	CoinScale        int64   `gorm:"column:coin_scale"`         // 交易币小数精度
 	CoinSymbol       string  `gorm:"column:coin_symbol"`        // 交易币种符号
 	Enable           int64   `gorm:"column:enable"`             // 状态，1：启用，2：禁止
-	Fee              float64 `gorm:"column:fee"`                // 交易手续费
+	Fee              float64 `gorm:"column:fee"`                // 交易手续费，吃单(taker)费率
+	MakerFee         float64 `gorm:"column:maker_fee"`          // 挂单(maker)手续费率
 	Sort             int64   `gorm:"column:sort"`               // 排序，从小到大
 	EnableMarketBuy  int64   `gorm:"column:enable_market_buy"`  // 是否启用市价买
 	EnableMarketSell int64   `gorm:"column:enable_market_sell"` // 是否启用市价卖
@@ -30,6 +31,12 @@ type ExchangeCoin struct {
 	StartTime        int64   `gorm:"column:start_time"`         // 开始时间
 	Visible          int64   `gorm:"column:visible"`            //  前台可见状态
 	Zone             int64   `gorm:"column:zone"`               // 交易区域
+	StpMode          int64   `gorm:"column:stp_mode"`           // 自成交保护模式 0:撤新订单,1:撤旧订单,2:都撤,3:减数量
+	PriceBand        float64 `gorm:"column:price_band"`         // 限价单偏离最新成交价的最大百分比，0表示不限制
+	SweepLimit       float64 `gorm:"column:sweep_limit"`        // 市价单最多吃到离第一笔成交价的百分比，0表示不限制
+	HaltThreshold    float64 `gorm:"column:halt_threshold"`     // 熔断，窗口内成交价波动超过这个百分比暂停撮合，0表示不启用
+	HaltWindow       int64   `gorm:"column:halt_window"`        // 熔断统计窗口，单位为秒
+	HaltCooldown     int64   `gorm:"column:halt_cooldown"`      // 熔断后暂停撮合的时间，单位为秒
 }
 
 func (*ExchangeCoin) TableName() string {
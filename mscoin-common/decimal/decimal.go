@@ -0,0 +1,389 @@
+// Package decimal 定点小数 用于金额、价格、数量的计算
+// float64 是二进制浮点数 0.1+0.2 这种运算会产生 1e-8 级别的误差 对账时对不上
+// Decimal 使用 big.Int 存储整数部分 scale 表示小数位数 value * 10^-scale
+package decimal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode 舍入模式
+type RoundingMode int
+
+const (
+	RoundDown     RoundingMode = iota // 向零截断 1.259 -> 1.25  -1.259 -> -1.25
+	RoundUp                           // 远离零进位 1.251 -> 1.26  -1.251 -> -1.26
+	RoundFloor                        // 向负无穷 1.259 -> 1.25  -1.251 -> -1.26
+	RoundCeiling                      // 向正无穷 1.251 -> 1.26  -1.259 -> -1.25
+	RoundHalfUp                       // 四舍五入 1.255 -> 1.26
+	RoundHalfEven                     // 银行家舍入 1.245 -> 1.24  1.255 -> 1.26
+)
+
+var (
+	ten  = big.NewInt(10)
+	zero = big.NewInt(0)
+	one  = big.NewInt(1)
+)
+
+// Zero 0
+var Zero = New(0, 0)
+
+// Decimal 不可变的定点小数 所有运算都返回新的值
+// 零值可以直接使用 等于0
+type Decimal struct {
+	value *big.Int
+	scale int32
+}
+
+// New value * 10^-scale 例如 New(125, 2) = 1.25
+func New(value int64, scale int32) Decimal {
+	return Decimal{value: big.NewInt(value), scale: scale}
+}
+
+func NewFromInt(value int64) Decimal {
+	return New(value, 0)
+}
+
+// NewFromFloat 按照float64最短的十进制表示转换 0.1 -> 0.1 而不是 0.1000000000000000055
+func NewFromFloat(f float64) Decimal {
+	d, err := NewFromString(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Zero
+	}
+	return d
+}
+
+// NewFromString 解析 "1.25" "-0.001" "100" 这样的字符串
+func NewFromString(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, errors.New("decimal: empty string")
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if len(fracPart) > 0 && (fracPart[0] == '-' || fracPart[0] == '+') {
+		return Decimal{}, fmt.Errorf("decimal: invalid string %q", s)
+	}
+	value, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("decimal: invalid string %q", s)
+	}
+	return Decimal{value: value, scale: int32(len(fracPart))}, nil
+}
+
+// RequireFromString 解析失败直接panic 只用于常量
+func RequireFromString(s string) Decimal {
+	d, err := NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) val() *big.Int {
+	if d.value == nil {
+		return zero
+	}
+	return d.value
+}
+
+// Scale 小数位数
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// rescale 将两个数对齐到相同的小数位数
+func rescale(d1 Decimal, d2 Decimal) (*big.Int, *big.Int, int32) {
+	if d1.scale == d2.scale {
+		return d1.val(), d2.val(), d1.scale
+	}
+	if d1.scale > d2.scale {
+		return d1.val(), mulPow10(d2.val(), d1.scale-d2.scale), d1.scale
+	}
+	return mulPow10(d1.val(), d2.scale-d1.scale), d2.val(), d2.scale
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+func mulPow10(v *big.Int, n int32) *big.Int {
+	return new(big.Int).Mul(v, pow10(n))
+}
+
+// Add 精确相加 小数位数取两者较大的
+func (d Decimal) Add(d2 Decimal) Decimal {
+	v1, v2, scale := rescale(d, d2)
+	return Decimal{value: new(big.Int).Add(v1, v2), scale: scale}
+}
+
+// Sub 精确相减 小数位数取两者较大的
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	v1, v2, scale := rescale(d, d2)
+	return Decimal{value: new(big.Int).Sub(v1, v2), scale: scale}
+}
+
+// Mul 精确相乘 小数位数是两者之和 需要保留几位自己调用Round
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(d.val(), d2.val()), scale: d.scale + d2.scale}
+}
+
+// Div 相除 结果保留scale位小数 按照mode舍入 除数为0时panic
+func (d Decimal) Div(d2 Decimal, scale int32, mode RoundingMode) Decimal {
+	if d2.Sign() == 0 {
+		panic("decimal: division by zero")
+	}
+	// d/d2 = (v1/v2) * 10^(s2-s1) 要保留scale位 分子再乘 10^scale
+	exp := d2.scale - d.scale + scale
+	num, den := d.val(), d2.val()
+	if exp >= 0 {
+		num = mulPow10(num, exp)
+	} else {
+		den = mulPow10(den, -exp)
+	}
+	return Decimal{value: roundQuo(num, den, mode), scale: scale}
+}
+
+// Round 保留scale位小数 按照mode舍入
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{value: mulPow10(d.val(), scale-d.scale), scale: scale}
+	}
+	return Decimal{value: roundQuo(d.val(), pow10(d.scale-scale), mode), scale: scale}
+}
+
+// Truncate 保留scale位小数 多余的直接截断 等同于 op.FloorFloat 对正数的效果
+func (d Decimal) Truncate(scale int32) Decimal {
+	return d.Round(scale, RoundDown)
+}
+
+// roundQuo num/den 按照舍入模式取整
+func roundQuo(num *big.Int, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	// 结果的符号 QuoRem 是向零截断的
+	sign := num.Sign() * den.Sign()
+	var inc bool
+	switch mode {
+	case RoundDown:
+		inc = false
+	case RoundUp:
+		inc = true
+	case RoundFloor:
+		inc = sign < 0
+	case RoundCeiling:
+		inc = sign > 0
+	case RoundHalfUp, RoundHalfEven:
+		// 比较 2|r| 和 |den|
+		twoR := new(big.Int).Abs(r)
+		twoR.Lsh(twoR, 1)
+		c := twoR.Cmp(new(big.Int).Abs(den))
+		if mode == RoundHalfUp {
+			inc = c >= 0
+		} else {
+			inc = c > 0 || (c == 0 && q.Bit(0) == 1)
+		}
+	}
+	if inc {
+		if sign < 0 {
+			q.Sub(q, one)
+		} else {
+			q.Add(q, one)
+		}
+	}
+	return q
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.val()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.val()), scale: d.scale}
+}
+
+// Cmp d<d2 返回-1 d==d2 返回0 d>d2 返回1
+func (d Decimal) Cmp(d2 Decimal) int {
+	v1, v2, _ := rescale(d, d2)
+	return v1.Cmp(v2)
+}
+
+func (d Decimal) Equal(d2 Decimal) bool {
+	return d.Cmp(d2) == 0
+}
+
+func (d Decimal) GreaterThan(d2 Decimal) bool {
+	return d.Cmp(d2) > 0
+}
+
+func (d Decimal) GreaterThanOrEqual(d2 Decimal) bool {
+	return d.Cmp(d2) >= 0
+}
+
+func (d Decimal) LessThan(d2 Decimal) bool {
+	return d.Cmp(d2) < 0
+}
+
+func (d Decimal) LessThanOrEqual(d2 Decimal) bool {
+	return d.Cmp(d2) <= 0
+}
+
+// Sign 负数返回-1 0返回0 正数返回1
+func (d Decimal) Sign() int {
+	return d.val().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) IsPositive() bool {
+	return d.Sign() > 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.Sign() < 0
+}
+
+// Min 返回较小的一个
+func Min(d1 Decimal, d2 Decimal) Decimal {
+	if d1.Cmp(d2) <= 0 {
+		return d1
+	}
+	return d2
+}
+
+// Max 返回较大的一个
+func Max(d1 Decimal, d2 Decimal) Decimal {
+	if d1.Cmp(d2) >= 0 {
+		return d1
+	}
+	return d2
+}
+
+// Float64 只用于展示和对外接口 不要再拿float64做运算
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String 去掉末尾多余的0 1.2500 -> 1.25  2.000 -> 2
+func (d Decimal) String() string {
+	s := d.StringFixed(d.scale)
+	if d.scale > 0 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	return s
+}
+
+// StringFixed 固定保留scale位小数 不足补0 多余的截断
+func (d Decimal) StringFixed(scale int32) string {
+	v := d.val()
+	if scale != d.scale {
+		v = d.Round(scale, RoundDown).val()
+	}
+	if scale <= 0 {
+		return v.String()
+	}
+	abs := new(big.Int).Abs(v).String()
+	if len(abs) <= int(scale) {
+		abs = strings.Repeat("0", int(scale)-len(abs)+1) + abs
+	}
+	point := len(abs) - int(scale)
+	s := abs[:point] + "." + abs[point:]
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON 输出为json数字 其他服务用float64接收也不会出错
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON 数字和字符串两种格式都支持
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if s == "" {
+		*d = Zero
+		return nil
+	}
+	// 兼容 1e-8 这种科学计数法
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("decimal: invalid json %s", data)
+		}
+		*d = NewFromFloat(f)
+		return nil
+	}
+	v, err := NewFromString(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Value 写入数据库 mysql的decimal字段直接使用字符串
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan 从数据库读取
+func (d *Decimal) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Zero
+		return nil
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	case float64:
+		*d = NewFromFloat(v)
+		return nil
+	case float32:
+		*d = NewFromFloat(float64(v))
+		return nil
+	case int64:
+		*d = NewFromInt(v)
+		return nil
+	default:
+		return fmt.Errorf("decimal: can not scan %T", src)
+	}
+}
+
+func (d *Decimal) scanString(s string) error {
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*d = NewFromFloat(f)
+		return nil
+	}
+	v, err := NewFromString(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// GormDataType 自动建表时使用decimal类型
+func (Decimal) GormDataType() string {
+	return "decimal(32,16)"
+}
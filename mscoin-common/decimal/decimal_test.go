@@ -0,0 +1,94 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddSub(t *testing.T) {
+	a := NewFromFloat(0.1)
+	b := NewFromFloat(0.2)
+	if got := a.Add(b).String(); got != "0.3" {
+		t.Fatalf("0.1+0.2 = %s", got)
+	}
+	if got := RequireFromString("1").Sub(RequireFromString("0.00000001")).String(); got != "0.99999999" {
+		t.Fatalf("1-0.00000001 = %s", got)
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	price := RequireFromString("20000.12345678")
+	amount := RequireFromString("0.00000003")
+	if got := price.Mul(amount).Truncate(8).String(); got != "0.0006" {
+		t.Fatalf("mul = %s", got)
+	}
+	if got := NewFromInt(2).Div(NewFromInt(3), 8, RoundDown).String(); got != "0.66666666" {
+		t.Fatalf("2/3 down = %s", got)
+	}
+	if got := NewFromInt(2).Div(NewFromInt(3), 8, RoundHalfUp).String(); got != "0.66666667" {
+		t.Fatalf("2/3 half up = %s", got)
+	}
+	if got := RequireFromString("100").Div(RequireFromString("0.25"), 2, RoundDown).String(); got != "400" {
+		t.Fatalf("100/0.25 = %s", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	cases := []struct {
+		in   string
+		mode RoundingMode
+		want string
+	}{
+		{"1.259", RoundDown, "1.25"},
+		{"-1.259", RoundDown, "-1.25"},
+		{"1.251", RoundUp, "1.26"},
+		{"-1.251", RoundUp, "-1.26"},
+		{"-1.251", RoundFloor, "-1.26"},
+		{"-1.259", RoundCeiling, "-1.25"},
+		{"1.255", RoundHalfUp, "1.26"},
+		{"1.245", RoundHalfEven, "1.24"},
+		{"1.255", RoundHalfEven, "1.26"},
+		{"-1.245", RoundHalfEven, "-1.24"},
+	}
+	for _, c := range cases {
+		if got := RequireFromString(c.in).Round(2, c.mode).String(); got != c.want {
+			t.Errorf("Round(%s, %d) = %s, want %s", c.in, c.mode, got, c.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type order struct {
+		Amount Decimal `json:"amount"`
+		Price  Decimal `json:"price"`
+	}
+	var o order
+	if err := json.Unmarshal([]byte(`{"amount":"1.50000000","price":20000.1}`), &o); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(o)
+	if string(data) != `{"amount":1.5,"price":20000.1}` {
+		t.Fatalf("marshal = %s", data)
+	}
+	var f struct {
+		Amount float64 `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil || f.Amount != 1.5 {
+		t.Fatalf("float64 decode = %v %v", f.Amount, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var d Decimal
+	if err := d.Scan([]byte("0.12345678")); err != nil || d.String() != "0.12345678" {
+		t.Fatalf("scan = %s %v", d, err)
+	}
+	v, _ := d.Value()
+	if v != "0.12345678" {
+		t.Fatalf("value = %v", v)
+	}
+	var zero Decimal
+	if !zero.Add(NewFromInt(1)).Equal(NewFromInt(1)) {
+		t.Fatal("zero value should be usable")
+	}
+}
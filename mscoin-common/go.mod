@@ -4,13 +4,17 @@ go 1.23.0
 
 toolchain go1.24.0
 
+require (
+	github.com/golang-jwt/jwt/v4 v4.5.2
+	golang.org/x/crypto v0.33.0
+	gorm.io/driver/mysql v1.5.7
+	gorm.io/gorm v1.25.12
+)
+
 require (
 	github.com/go-sql-driver/mysql v1.7.0 // indirect
 	github.com/jinzhu/copier v0.4.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
-	gorm.io/driver/mysql v1.5.7 // indirect
-	gorm.io/gorm v1.25.12 // indirect
 )
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"time"
+)
+
+const (
+	Pending = iota
+	Sent
+	Failed // 重试次数用完了 不再发 留在表里人工处理
+)
+
+// Event 待发送的消息 和业务数据在同一个事务里写进 outbox_event
+// 事务提交了消息才会被 Relay 发出去 回滚了消息也跟着没了
+type Event struct {
+	Id         int64  `gorm:"column:id"`
+	Topic      string `gorm:"column:topic"`
+	MsgKey     string `gorm:"column:msg_key"`
+	Payload    []byte `gorm:"column:payload"`
+	Status     int    `gorm:"column:status"`
+	Retries    int    `gorm:"column:retries"`
+	RetryTime  int64  `gorm:"column:retry_time"` // 发送失败以后 这个时间之前同key的消息都不发
+	CreateTime int64  `gorm:"column:create_time"`
+	SendTime   int64  `gorm:"column:send_time"`
+}
+
+func (*Event) TableName() string {
+	return "outbox_event"
+}
+
+// Save 在业务事务里写一条消息 conn 是 tran.Transaction.Action 传进来的连接
+// 同一个 key 的消息按写入顺序发送
+func Save(ctx context.Context, conn msdb.DbConn, topic string, key string, payload []byte) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Create(&Event{
+		Topic:      topic,
+		MsgKey:     key,
+		Payload:    payload,
+		Status:     Pending,
+		CreateTime: time.Now().UnixMilli(),
+	}).Error
+}
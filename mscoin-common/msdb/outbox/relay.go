@@ -0,0 +1,215 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"os"
+	"time"
+)
+
+// Publisher 同步发送一条消息 返回nil表示broker已经确认
+// 各服务用自己的kafka客户端实现
+type Publisher func(topic string, key []byte, data []byte) error
+
+const leaseName = "outbox_relay"
+
+// Lease 发送租约 outbox_lease 一行 多个副本抢同一行 拿到的才发消息
+// 同一时间只有一个relay在发 同一个key的消息才能按顺序发出去
+type Lease struct {
+	Name       string `gorm:"column:name"`
+	Owner      string `gorm:"column:owner"`
+	ExpireTime int64  `gorm:"column:expire_time"`
+}
+
+func (*Lease) TableName() string {
+	return "outbox_lease"
+}
+
+// Relay 按id顺序把待发送的消息发出去
+// 发送失败的留在表里 隔一段时间再重试 同一个key后面的消息要等它发出去才能发 别的key照常发
+// 重试次数用完的标记成失败 不再挡着后面的消息
+// 发出去以后标记失败的会重复发送 消费方要能处理重复消息
+type Relay struct {
+	conn       *gorms.GormConn
+	publish    Publisher
+	owner      string
+	expire     int64 // 租约到期时间 毫秒 过了就不再发 等下一轮续上
+	cleaned    int64 // 上次清理的时间 毫秒
+	Batch      int
+	Interval   time.Duration
+	LeaseTime  time.Duration
+	Retention  time.Duration // 发出去的消息保留多久 方便排查 过了就删掉
+	MaxRetries int           // 发送失败最多重试几次 用完标记成失败
+	MaxBackoff time.Duration // 重试间隔按次数翻倍 最长这么久
+}
+
+func NewRelay(db *msdb.MsDB, publish Publisher) *Relay {
+	host, _ := os.Hostname()
+	return &Relay{
+		conn:       gorms.New(db.Conn),
+		publish:    publish,
+		owner:      fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		Batch:      100,
+		Interval:   200 * time.Millisecond,
+		LeaseTime:  10 * time.Second,
+		Retention:  24 * time.Hour,
+		MaxRetries: 50,
+		MaxBackoff: time.Minute,
+	}
+}
+
+func (r *Relay) Start() {
+	go r.run()
+}
+
+func (r *Relay) run() {
+	for {
+		held, err := r.acquire(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+		if !held {
+			// 别的副本在发 等它的租约过期
+			time.Sleep(r.Interval)
+			continue
+		}
+		sent, failed, err := r.relay(context.Background())
+		if err != nil {
+			log.Println(err)
+		}
+		if err := r.clean(context.Background()); err != nil {
+			log.Println(err)
+		}
+		// 有失败的或者没有新消息 等一会再查
+		if err != nil || failed > 0 || sent == 0 {
+			time.Sleep(r.Interval)
+		}
+	}
+}
+
+// acquire 拿到或者续上租约 别的副本拿着没过期的返回false
+func (r *Relay) acquire(ctx context.Context) (bool, error) {
+	now := time.Now().UnixMilli()
+	expire := now + r.LeaseTime.Milliseconds()
+	session := r.conn.Session(ctx)
+	result := session.Model(&Lease{}).
+		Where("name=? and (owner=? or expire_time<?)", leaseName, r.owner, now).
+		Updates(map[string]any{"owner": r.owner, "expire_time": expire})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var lease Lease
+		err := session.Where("name=?", leaseName).Limit(1).Find(&lease).Error
+		if err != nil {
+			return false, err
+		}
+		if lease.Name != "" && lease.Owner != r.owner {
+			return false, nil
+		}
+		if lease.Name == "" {
+			// 第一次运行还没有租约 插入冲突的是被别的副本抢先了 下一轮再看
+			err = session.Create(&Lease{Name: leaseName, Owner: r.owner, ExpireTime: expire}).Error
+			if err != nil {
+				return false, nil
+			}
+		}
+	}
+	r.expire = expire
+	return true, nil
+}
+
+// clean 每分钟删一次超过保留时间的已发送消息 分批删 不长时间锁表
+// 积压太多的删一会就停 不耽误发消息 下一分钟接着删
+func (r *Relay) clean(ctx context.Context) error {
+	start := time.Now()
+	if start.UnixMilli()-r.cleaned < time.Minute.Milliseconds() {
+		return nil
+	}
+	r.cleaned = start.UnixMilli()
+	before := start.Add(-r.Retention).UnixMilli()
+	limit := r.Batch * 10
+	for time.Since(start) < r.LeaseTime/2 {
+		result := r.conn.Session(ctx).
+			Exec("delete from outbox_event where status=? and send_time<? limit ?", Sent, before, limit)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < int64(limit) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// relay 发一批消息 返回发出去的和失败的条数
+// 还在等重试的key整个跳过 不会每一轮都查出同一批发不出去的消息 把别的key饿死
+func (r *Relay) relay(ctx context.Context) (int, int, error) {
+	var events []*Event
+	now := time.Now().UnixMilli()
+	waiting := r.conn.Session(ctx).Model(&Event{}).
+		Select("msg_key").
+		Where("status=? and retry_time>?", Pending, now)
+	err := r.conn.Session(ctx).
+		Where("status=? and msg_key not in (?)", Pending, waiting).
+		Order("id asc").
+		Limit(r.Batch).
+		Find(&events).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	sent, failed := 0, 0
+	blocked := make(map[string]bool)
+	for _, e := range events {
+		// 租约快到期了 后面的留给下一轮 不能和接手的副本一起发
+		if time.Now().Add(r.Interval).UnixMilli() >= r.expire {
+			break
+		}
+		if blocked[e.MsgKey] {
+			continue
+		}
+		err := r.publish(e.Topic, []byte(e.MsgKey), e.Payload)
+		if err != nil {
+			log.Printf("outbox发送失败,id=%d,topic=%s,key=%s,err=%v", e.Id, e.Topic, e.MsgKey, err)
+			blocked[e.MsgKey] = true
+			failed++
+			r.retry(ctx, e)
+			continue
+		}
+		err = r.conn.Session(ctx).Model(&Event{}).
+			Where("id=?", e.Id).
+			Updates(map[string]any{"status": Sent, "send_time": time.Now().UnixMilli()}).Error
+		if err != nil {
+			// 标记不了 后面同key的先不发 下一轮连它一起重发
+			log.Printf("outbox标记失败,id=%d,err=%v", e.Id, err)
+			blocked[e.MsgKey] = true
+			failed++
+			continue
+		}
+		sent++
+	}
+	return sent, failed, nil
+}
+
+// retry 发送失败的消息隔一段时间再发 间隔按失败次数翻倍 次数用完标记成失败
+func (r *Relay) retry(ctx context.Context, e *Event) {
+	retries := e.Retries + 1
+	backoff := r.Interval << min(retries, 16)
+	if backoff > r.MaxBackoff {
+		backoff = r.MaxBackoff
+	}
+	updates := map[string]any{"retries": retries, "retry_time": time.Now().Add(backoff).UnixMilli()}
+	if retries >= r.MaxRetries {
+		log.Printf("outbox重试次数用完,标记失败,id=%d,topic=%s,key=%s", e.Id, e.Topic, e.MsgKey)
+		updates["status"] = Failed
+	}
+	err := r.conn.Session(ctx).Model(&Event{}).
+		Where("id=?", e.Id).
+		Updates(updates).Error
+	if err != nil {
+		log.Printf("outbox记录重试失败,id=%d,err=%v", e.Id, err)
+	}
+}
@@ -1,3 +1,5 @@
+// Package op float64 的辅助运算 只用于汇率、行情这类展示数据
+// 余额、价格、数量等金额计算请使用 mscoin-common/decimal
 package op
 
 import (
@@ -2,4 +2,4 @@ module ucenter-api
 
 go 1.24
 
-
+require github.com/jinzhu/copier v0.4.0
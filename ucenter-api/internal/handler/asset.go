@@ -81,3 +81,33 @@ func (h *AssetHandler) FindTransaction(w http.ResponseWriter, r *http.Request) {
 		result := common.NewResult().Deal(resp, err)
 		httpx.OkJsonCtx(r.Context(), w, result)
 }
+
+func (h *AssetHandler) FindLedger(w http.ResponseWriter, r *http.Request) {
+	var req types.AssetReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	if req.PageNo == 0 {
+		req.PageNo = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = 10
+	}
+	logic := logic.NewAssetLogic(r.Context(), h.svcCtx)
+	resp, err := logic.FindLedger(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
+
+func (h *AssetHandler) FindStatement(w http.ResponseWriter, r *http.Request) {
+	var req types.AssetReq
+	if err := httpx.ParseForm(r, &req); err != nil {
+		httpx.ErrorCtx(r.Context(), w, err)
+		return
+	}
+	logic := logic.NewAssetLogic(r.Context(), h.svcCtx)
+	resp, err := logic.FindStatement(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	common "mscoin-common"
+	"net/http"
+	"ucenter-api/internal/logic"
+	"ucenter-api/internal/svc"
+	"ucenter-api/internal/types"
+
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+type PromotionHandler struct {
+	svcCtx *svc.ServiceContext
+}
+
+func NewPromotionHandler(svcCtx *svc.ServiceContext) *PromotionHandler {
+	return &PromotionHandler{svcCtx}
+}
+
+func (h *PromotionHandler) Commission(w http.ResponseWriter, r *http.Request) {
+	var req types.PromotionReq
+	l := logic.NewPromotionLogic(r.Context(), h.svcCtx)
+	resp, err := l.Commission(&req)
+	result := common.NewResult().Deal(resp, err)
+	httpx.OkJsonCtx(r.Context(), w, result)
+}
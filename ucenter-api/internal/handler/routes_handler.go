@@ -28,6 +28,8 @@ func RegisterHandlers(r *Routes, serverCtx *svc.ServiceContext) {
 	assetGroup.Post("/uc/asset/wallet", asset.FindWallet)
 	assetGroup.Post("/uc/asset/wallet/reset-address",asset.ResetAddress)
 	assetGroup.Post("/uc/asset/transaction/all",asset.FindTransaction)
+	assetGroup.Post("/uc/asset/ledger", asset.FindLedger)
+	assetGroup.Post("/uc/asset/statement", asset.FindStatement)
 
 	// 提现部分 - 安全认证
 	approveGroup := r.Group()
@@ -44,4 +46,10 @@ func RegisterHandlers(r *Routes, serverCtx *svc.ServiceContext) {
 	withdrawGroup.Post("/uc/withdraw/apply/code",withdraw.WithdrawCode)
 	withdrawGroup.Post("/uc/withdraw/record", withdraw.Record)
 
+	// 邀请返佣
+	promotionGroup := r.Group()
+	promotion := NewPromotionHandler(serverCtx)
+	promotionGroup.Use(midd.Auth(serverCtx.Config.JWT.AccessSecret))
+	promotionGroup.Post("/uc/promotion/commission", promotion.Commission)
+
 }
@@ -117,3 +117,50 @@ func (l *AssetLogic) FindTransaction(req *types.AssetReq) (*pages.PageResult, er
 	return pages.New(respList, int64(req.PageNo), int64(req.PageSize), total), nil
 	
 }
+
+// FindLedger 资金分录 冻结 解冻 成交 手续费 充值 提现 返佣都有记录
+func (l *AssetLogic) FindLedger(req *types.AssetReq) (*pages.PageResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	userId := l.ctx.Value("userId").(int64)
+	resp, err := l.svcCtx.UCAssetRpc.FindLedger(ctx, &asset.AssetReq{
+		UserId:    userId,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		PageNo:    int64(req.PageNo),
+		PageSize:  int64(req.PageSize),
+		Symbol:    req.Symbol,
+		Type:      req.Type,
+	})
+	if err != nil {
+		logx.Errorf("RPC-FindLedger error: %v", err)
+		return nil, err
+	}
+	respList := make([]any, len(resp.List))
+	for i, v := range resp.List {
+		respList[i] = v
+	}
+	return pages.New(respList, int64(req.PageNo), int64(req.PageSize), resp.Total), nil
+}
+
+// FindStatement 对账单 account 是 AVAILABLE 或者 FROZEN 默认可用
+func (l *AssetLogic) FindStatement(req *types.AssetReq) (*asset.LedgerStatement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	userId := l.ctx.Value("userId").(int64)
+	resp, err := l.svcCtx.UCAssetRpc.FindStatement(ctx, &asset.AssetReq{
+		UserId:    userId,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Symbol:    req.Symbol,
+		Account:   req.Account,
+	})
+	if err != nil {
+		logx.Errorf("RPC-FindStatement error: %v", err)
+		return nil, err
+	}
+	if resp.List == nil {
+		resp.List = []*asset.MemberLedger{}
+	}
+	return resp, nil
+}
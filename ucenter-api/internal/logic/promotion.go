@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"context"
+	"grpc-common/ucenter/types/member"
+	"ucenter-api/internal/svc"
+	"ucenter-api/internal/types"
+
+	"github.com/jinzhu/copier"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type Promotion struct {
+	logx.Logger
+	ctx    context.Context
+	svcCtx *svc.ServiceContext
+}
+
+func NewPromotionLogic(ctx context.Context, svcCtx *svc.ServiceContext) *Promotion {
+	return &Promotion{
+		Logger: logx.WithContext(ctx),
+		ctx:    ctx,
+		svcCtx: svcCtx,
+	}
+}
+
+// Commission 邀请返佣收益和邀请人数
+func (p *Promotion) Commission(req *types.PromotionReq) (*types.CommissionInfo, error) {
+	userId := p.ctx.Value("userId").(int64)
+	info, err := p.svcCtx.UCMemberRpc.FindCommission(p.ctx, &member.MemberReq{
+		MemberId: userId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &types.CommissionInfo{}
+	if err := copier.Copy(resp, info); err != nil {
+		return nil, err
+	}
+	if resp.List == nil {
+		resp.List = []*types.CommissionAmount{}
+	}
+	return resp, nil
+}
@@ -70,6 +70,7 @@ type AssetReq struct {
 	EndTime   string `json:"endTime,optional" form:"endTime,optional"`
 	Symbol    string `json:"symbol,optional" form:"symbol,optional"`
 	Type      string `json:"type,optional" form:"type,optional"`
+	Account   string `json:"account,optional" form:"account,optional"`
 }
 
 type Coin struct {
@@ -183,4 +184,18 @@ type WithdrawWalletInfo struct {
 type AddressSimple struct {
 	Remark  string `json:"remark"`
 	Address string `json:"address"`
-}
\ No newline at end of file
+}
+type PromotionReq struct {
+}
+
+type CommissionInfo struct {
+	FirstCount  int64               `json:"firstCount"`  // 直接邀请的人数
+	SecondCount int64               `json:"secondCount"` // 间接邀请的人数
+	List        []*CommissionAmount `json:"list"`
+}
+
+type CommissionAmount struct {
+	Symbol  string  `json:"symbol"`
+	Paid    float64 `json:"paid"`    // 已发放
+	Pending float64 `json:"pending"` // 待发放
+}
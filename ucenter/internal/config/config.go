@@ -17,6 +17,7 @@ type Config struct {
 	ExchangeRpc zrpc.RpcClientConf
 	Kafka       database.KafkaConfig
 	Bitcoin     BitCoinConfig
+	Exchange    ExchangeConfig
 }
 
 type AuthConfig struct {
@@ -34,4 +35,14 @@ type MysqlConfig struct {
 }
 type BitCoinConfig struct {
 	Address string
-}
\ No newline at end of file
+}
+
+// ExchangeConfig 币币交易结算
+type ExchangeConfig struct {
+	FeeMemberId      int64   // 平台收手续费的账户 成交手续费转到这个用户的钱包
+	DiscountCoin     string  // 平台币 下单时选了抵扣的 手续费用它付 为空不开启
+	DiscountRate     float64 // 用平台币付手续费时按原手续费的多少收 0.75就是打75折
+	FirstCommission  float64 // 一级邀请人拿被邀请人手续费的比例 0.2就是20% 为0不返
+	SecondCommission float64 // 二级邀请人拿的比例
+	CommissionBatch  int     // 每次发放返佣最多处理多少条 默认1000
+}
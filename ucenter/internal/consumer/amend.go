@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
+	"mscoin-common/msdb/tran"
+	"time"
+	"ucenter/internal/database"
+	"ucenter/internal/domain"
+	"ucenter/internal/model"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// OrderAmend 改单消息 和exchange服务的model.ExchangeOrderAmended保持一致
+type OrderAmend struct {
+	AmendId    string          `json:"amendId"`
+	OrderId    string          `json:"orderId"`
+	Symbol     string          `json:"symbol"`
+	MemberId   int64           `json:"memberId"`
+	Direction  int             `json:"direction"`
+	BaseSymbol string          `json:"baseSymbol"`
+	CoinSymbol string          `json:"coinSymbol"`
+	Hold       decimal.Decimal `json:"hold"`    // 改单前要多冻结的资金
+	Release    decimal.Decimal `json:"release"` // 撮合引擎改完以后要解冻的资金
+	Reason     string          `json:"reason"`
+}
+
+// symbol 改单冻结解冻的币种 买冻结基础币 卖冻结交易币
+func (a *OrderAmend) symbol() string {
+	if a.Direction == BUY {
+		return a.BaseSymbol
+	}
+	return a.CoinSymbol
+}
+
+// eventKey 去重用的改单号 升级前发出的消息没有改单号 用订单号和金额
+func (a *OrderAmend) eventKey() string {
+	if a.AmendId != "" {
+		return a.AmendId
+	}
+	return a.OrderId + "::" + a.Hold.String() + "::" + a.Release.String()
+}
+
+// ExchangeOrderAmendFreeze 改单要多冻结的资金 冻结成功后交给撮合引擎改单
+// 余额不足的改单直接丢弃 订单保持原样 其他错误放回去重试 重复投递的按改单号跳过
+func ExchangeOrderAmendFreeze(cli *database.KafkaClient, db *msdb.MsDB) {
+	for {
+		kafkaData := cli.Read()
+		var amend *OrderAmend
+		json.Unmarshal(kafkaData.Data, &amend)
+		if amend == nil || amend.Hold.Sign() <= 0 {
+			continue
+		}
+		logx.Info("收到改单冻结消息,orderId=" + amend.OrderId)
+		ctx := context.Background()
+		transaction := tran.NewTransaction(db.Conn)
+		walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
+		// 冻结成功的改单和冻结一起写进outbox 再发给撮合引擎
+		err := transaction.Action(func(conn msdb.DbConn) error {
+			first, err := walletDomain.FirstTime(ctx, conn, model.AmendFreezeEvent(amend.eventKey()))
+			if err != nil || !first {
+				return err
+			}
+			err = walletDomain.Freeze(ctx, conn, amend.MemberId, amend.Hold, amend.symbol(), amend.OrderId)
+			if err != nil {
+				return err
+			}
+			return outbox.Save(ctx, conn, "exchange_order_amend", string(kafkaData.Key), kafkaData.Data)
+		})
+		if errors.Is(err, domain.ErrInsufficientBalance) {
+			logx.Errorf("改单冻结失败,orderId=%s,err=%v", amend.OrderId, err)
+			continue
+		}
+		if err != nil {
+			logx.Error(err)
+			cli.Rput(kafkaData)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		logx.Info("改单冻结成功:" + amend.OrderId)
+	}
+}
+
+// ExchangeOrderAmendRelease 撮合引擎改单完成 解冻多冻结的资金
+// 改单被拒绝的 预先冻结的全部解冻 重复投递的按改单号跳过
+func ExchangeOrderAmendRelease(cli *database.KafkaClient, db *msdb.MsDB) {
+	for {
+		kafkaData := cli.Read()
+		var amend *OrderAmend
+		json.Unmarshal(kafkaData.Data, &amend)
+		if amend == nil || amend.Release.Sign() <= 0 {
+			continue
+		}
+		logx.Info("收到改单解冻消息,orderId=" + amend.OrderId)
+		ctx := context.Background()
+		transaction := tran.NewTransaction(db.Conn)
+		walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
+		err := transaction.Action(func(conn msdb.DbConn) error {
+			first, err := walletDomain.FirstTime(ctx, conn, model.AmendReleaseEvent(amend.eventKey()))
+			if err != nil || !first {
+				return err
+			}
+			return walletDomain.Unfreeze(ctx, conn, amend.MemberId, amend.Release, amend.symbol(), amend.OrderId)
+		})
+		if err != nil {
+			logx.Error(err)
+			cli.Rput(kafkaData)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		logx.Info("改单解冻成功:" + amend.OrderId)
+	}
+}
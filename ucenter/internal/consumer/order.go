@@ -3,32 +3,33 @@ package consumer
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"grpc-common/exchange/eclient"
 	"grpc-common/exchange/types/order"
+	"mscoin-common/decimal"
 	"mscoin-common/enum"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
 	"mscoin-common/msdb/tran"
-	"mscoin-common/op"
+	"slices"
 	"time"
 	"ucenter/internal/database"
 	"ucenter/internal/domain"
+	"ucenter/internal/model"
 
 	"github.com/zeromicro/go-zero/core/logx"
-	"github.com/zeromicro/go-zero/core/stores/redis"
 )
 
 type OrderAdd struct {
-	UserId     int64   `json:"userId"`
-	OrderId    string  `json:"orderId"`
-	Money      float64 `json:"money"`
-	Symbol     string  `json:"symbol"`
-	Direction  int     `json:"direction"`
-	BaseSymbol string  `json:"baseSymbol"`
-	CoinSymbol string  `json:"coinSymbol"`
+	UserId     int64           `json:"userId"`
+	OrderId    string          `json:"orderId"`
+	Money      decimal.Decimal `json:"money"`
+	Symbol     string          `json:"symbol"`
+	Direction  int             `json:"direction"`
+	BaseSymbol string          `json:"baseSymbol"`
+	CoinSymbol string          `json:"coinSymbol"`
 }
 
-func ExchangeOrderAdd(redisCli *redis.Redis, kafkaCli *database.KafkaClient, orderRpc eclient.Order, db *msdb.MsDB) {
+func ExchangeOrderAdd(kafkaCli *database.KafkaClient, orderRpc eclient.Order, db *msdb.MsDB) {
 
 	for {
 		// 从kafka中读取消息
@@ -65,58 +66,36 @@ func ExchangeOrderAdd(redisCli *redis.Redis, kafkaCli *database.KafkaClient, ord
 			logx.Error("orderId :" + orderId + " 已经被操作过了")
 			continue
 		}
-		// 添加 Redis 分布式锁
-		lock := redis.NewRedisLock(redisCli, "exchange_order::"+fmt.Sprintf("%d::%s", orderAdd.UserId, orderId))
-		acquired, err := lock.Acquire()
-		if err != nil {
-			logx.Error("获取锁失败", err)
-			continue
-		}
-		if acquired {
-			//添加事务
-			transaction := tran.NewTransaction(db.Conn)
-			walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
-			err := transaction.Action(func(conn msdb.DbConn) error {
-				if orderAdd.Direction == 0 {
-					// 买入
-					err := walletDomain.Freeze(ctx, conn, orderAdd.UserId, orderAdd.Money, orderAdd.BaseSymbol)
-					return err
-				} else {
-					err := walletDomain.Freeze(ctx, conn, orderAdd.UserId, orderAdd.Money, orderAdd.CoinSymbol)
-					return err
-				}
-
-			})
-			if err != nil {
-				cancelOrder(ctx, kafaData, orderId, orderRpc, kafkaCli)
-				continue
+		// 不加锁 重复投递和并发消费都靠事务里的 processed_event 只冻结一次
+		transaction := tran.NewTransaction(db.Conn)
+		walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
+		// 冻结成功的通知订单改成trading 消息和冻结一起写进outbox 不会冻结了订单还一直是init
+		err = transaction.Action(func(conn msdb.DbConn) error {
+			// 冻结过的订单不再冻结 状态检查和冻结之间消息重复投递也只冻结一次 第一次已经写过消息了
+			first, err := walletDomain.FirstTime(ctx, conn, model.OrderFreezeEvent(orderId))
+			if err != nil || !first {
+				return err
 			}
-
-			//需要将状态 改为trading
-			//都完成后 通知订单进行状态变更 需要保证一定发送成功
-			for {
-				m := make(map[string]any)
-				m["userId"] = orderAdd.UserId
-				m["orderId"] = orderId
-				marshal, _ := json.Marshal(m)
-				data := database.KafkaData{
-					Topic: "exchange_order_init_complete_trading",
-					Key:   []byte(orderId),
-					Data:  marshal,
-				}
-				err := kafkaCli.SendSync(data)
-				if err != nil {
-					logx.Error(err)
-					time.Sleep(250 * time.Millisecond)
-					continue
-				}
-				logx.Info("发送exchange_order_init_complete_trading 消息成功:" + orderId)
-				break
+			if orderAdd.Direction == 0 {
+				// 买入
+				err = walletDomain.Freeze(ctx, conn, orderAdd.UserId, orderAdd.Money, orderAdd.BaseSymbol, orderId)
+			} else {
+				err = walletDomain.Freeze(ctx, conn, orderAdd.UserId, orderAdd.Money, orderAdd.CoinSymbol, orderId)
 			}
-			lock.Release()
-
+			if err != nil {
+				return err
+			}
+			m := make(map[string]any)
+			m["userId"] = orderAdd.UserId
+			m["orderId"] = orderId
+			marshal, _ := json.Marshal(m)
+			return outbox.Save(ctx, conn, "exchange_order_init_complete_trading", orderId, marshal)
+		})
+		if err != nil {
+			cancelOrder(ctx, kafaData, orderId, orderRpc, kafkaCli)
+			continue
 		}
-
+		logx.Info("冻结成功，消息写入outbox:" + orderId)
 	}
 
 }
@@ -131,23 +110,27 @@ func cancelOrder(ctx context.Context, data database.KafkaData, orderId string, o
 }
 
 type ExchangeOrder struct {
-	Id            int64   `gorm:"column:id" json:"id"`
-	OrderId       string  `gorm:"column:order_id" json:"orderId"`
-	Amount        float64 `gorm:"column:amount" json:"amount"`
-	BaseSymbol    string  `gorm:"column:base_symbol" json:"baseSymbol"`
-	CanceledTime  int64   `gorm:"column:canceled_time" json:"canceledTime"`
-	CoinSymbol    string  `gorm:"column:coin_symbol" json:"coinSymbol"`
-	CompletedTime int64   `gorm:"column:completed_time" json:"completedTime"`
-	Direction     int     `gorm:"column:direction" json:"direction"`
-	MemberId      int64   `gorm:"column:member_id" json:"memberId"`
-	Price         float64 `gorm:"column:price" json:"price"`
-	Status        int     `gorm:"column:status" json:"status"`
-	Symbol        string  `gorm:"column:symbol" json:"symbol"`
-	Time          int64   `gorm:"column:time" json:"time"`
-	TradedAmount  float64 `gorm:"column:traded_amount" json:"tradedAmount"`
-	Turnover      float64 `gorm:"column:turnover" json:"turnover"`
-	Type          int     `gorm:"column:type" json:"type"`
-	UseDiscount   string  `gorm:"column:use_discount" json:"useDiscount"`
+	Id            int64           `gorm:"column:id" json:"id"`
+	OrderId       string          `gorm:"column:order_id" json:"orderId"`
+	Amount        decimal.Decimal `gorm:"column:amount" json:"amount"`
+	BaseSymbol    string          `gorm:"column:base_symbol" json:"baseSymbol"`
+	CanceledTime  int64           `gorm:"column:canceled_time" json:"canceledTime"`
+	CoinSymbol    string          `gorm:"column:coin_symbol" json:"coinSymbol"`
+	CompletedTime int64           `gorm:"column:completed_time" json:"completedTime"`
+	Direction     int             `gorm:"column:direction" json:"direction"`
+	MemberId      int64           `gorm:"column:member_id" json:"memberId"`
+	Price         decimal.Decimal `gorm:"column:price" json:"price"`
+	Status        int             `gorm:"column:status" json:"status"`
+	Symbol        string          `gorm:"column:symbol" json:"symbol"`
+	Time          int64           `gorm:"column:time" json:"time"`
+	TradedAmount  decimal.Decimal `gorm:"column:traded_amount" json:"tradedAmount"`
+	Turnover      decimal.Decimal `gorm:"column:turnover" json:"turnover"`
+	Type          int             `gorm:"column:type" json:"type"`
+	UseDiscount   string          `gorm:"column:use_discount" json:"useDiscount"`
+	OriginalPrice decimal.Decimal `gorm:"column:original_price" json:"originalPrice"` // 不为0时冻结用的是它 post only改价前的价格或者OCO里高的价格
+	Transfer      decimal.Decimal `json:"transfer"`                                   // 撤单事件里 转给OCO止损单继续冻结的部分 不解冻
+	Frozen        decimal.Decimal `gorm:"column:frozen" json:"frozen"`                // 限价买单改单后冻结的资金 不为0时按它结算
+	Fee           decimal.Decimal `gorm:"column:fee" json:"fee"`                      // 累计手续费 买单是币 卖单是钱
 }
 
 // status
@@ -188,7 +171,22 @@ var TypeMap = enum.Enum{
 	LimitPrice:  "LIMIT_PRICE",
 }
 
-func ExchangeOrderComplete(redisCli *redis.Redis, cli *database.KafkaClient, db *msdb.MsDB) {
+func ExchangeOrderComplete(cli *database.KafkaClient, db *msdb.MsDB) {
+	exchangeOrderSettle(cli, db, Completed)
+}
+
+// ExchangeOrderCancel 撮合引擎撤单成功 解冻剩余的部分 已成交的部分逐笔结算过了
+// 委托超时自动下架的订单也走撤单 状态是 OverTimed
+func ExchangeOrderCancel(cli *database.KafkaClient, db *msdb.MsDB) {
+	exchangeOrderSettle(cli, db, Canceled, OverTimed)
+}
+
+// exchangeOrderSettle 订单结束(完成或者撤单)后解冻没用完的资金
+// 成交付出的 收到的 手续费都在 ExchangeOrderTrade 逐笔结算 这里只还冻结剩下的部分
+// 完成的订单未成交部分为0 所以两种情况可以用同一套计算 和逐笔结算谁先到都一样
+// OCO止盈单被止损单顶替时 转给止损单的部分留在冻结里 不还回去
+// 不加锁 并发和重复投递的消息都靠事务里的 processed_event 跳过 钱包行锁保证余额不会算错
+func exchangeOrderSettle(cli *database.KafkaClient, db *msdb.MsDB, statuses ...int) {
 	//先接收消息
 	for {
 		kafkaData := cli.Read()
@@ -197,91 +195,40 @@ func ExchangeOrderComplete(redisCli *redis.Redis, cli *database.KafkaClient, db
 		if order == nil {
 			continue
 		}
-		if order.Status != Completed {
+		if !slices.Contains(statuses, order.Status) {
 			continue
 		}
-		logx.Info("收到exchange_order_complete_update_success 消息成功:" + order.OrderId)
+		logx.Info("收到订单结算消息成功,status=" + StatusMap.Value(order.Status) + ",orderId=" + order.OrderId)
 		walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
-		lock := redis.NewRedisLock(redisCli, fmt.Sprintf("order_complete_update_wallet::%d", order.MemberId))
-		acquire, err := lock.Acquire()
-		if err != nil {
-			logx.Error(err)
-			logx.Info("有进程已经拿到锁进行处理了")
-			continue
-		}
-		if acquire {
-			// BTC/USDT
-			ctx := context.Background()
-			if order.Direction == BUY {
-				baseWallet, err := walletDomain.FindWalletByMemIdAndCoin(ctx, order.MemberId, order.BaseSymbol)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
-				}
-				coinWallet, err := walletDomain.FindWalletByMemIdAndCoin(ctx, order.MemberId, order.CoinSymbol)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
-				}
-				if order.Type == MarketPrice {
-					//市价买 amount USDT 冻结的钱  order.turnover扣的钱 还回去的钱 amount-order.turnover
-					baseWallet.FrozenBalance = op.SubFloor(baseWallet.FrozenBalance, order.Amount, 8)
-					baseWallet.Balance = op.AddFloor(baseWallet.Balance, op.SubFloor(order.Amount, order.Turnover, 8), 8)
-					coinWallet.Balance = op.AddFloor(coinWallet.Balance, order.TradedAmount, 8)
-				} else {
-					//限价买 冻结的钱是 order.price*amount  成交了turnover 还回去的钱 order.price*amount-order.turnover
-					floor := op.MulFloor(order.Price, order.Amount, 8)
-					baseWallet.FrozenBalance = op.SubFloor(baseWallet.FrozenBalance, floor, 8)
-					baseWallet.Balance = op.AddFloor(baseWallet.Balance, op.SubFloor(floor, order.Turnover, 8), 8)
-					coinWallet.Balance = op.AddFloor(coinWallet.Balance, order.TradedAmount, 8)
-				}
-				err = walletDomain.UpdateWalletCoinAndBase(ctx, baseWallet, coinWallet)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
-				}
-			} else {
-				//卖 不管是市价还是限价 都是卖的 BTC  解冻amount 得到的钱是 order.turnover
-				coinWallet, err := walletDomain.FindWalletByMemIdAndCoin(ctx, order.MemberId, order.CoinSymbol)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
-				}
-				baseWallet, err := walletDomain.FindWalletByMemIdAndCoin(ctx, order.MemberId, order.BaseSymbol)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
+		// BTC/USDT
+		ctx := context.Background()
+		settle := &domain.OrderSettle{OrderId: order.OrderId, MemberId: order.MemberId}
+		if order.Direction == BUY {
+			// 买单冻结的是钱 市价买冻结的是 amount USDT
+			// 限价买冻结时是 price*amount Truncate(8) 两边必须一致 post only改过价的按原来的价格 改过单的按改单时重新算的
+			floor := order.Amount
+			if order.Type != MarketPrice {
+				price := order.Price
+				if !order.OriginalPrice.IsZero() {
+					price = order.OriginalPrice
 				}
-
-				coinWallet.FrozenBalance = op.SubFloor(coinWallet.FrozenBalance, order.Amount, 8)
-				baseWallet.Balance = op.AddFloor(baseWallet.Balance, order.Turnover, 8)
-				err = walletDomain.UpdateWalletCoinAndBase(ctx, baseWallet, coinWallet)
-				if err != nil {
-					logx.Error(err)
-					cli.Rput(kafkaData)
-					time.Sleep(250 * time.Millisecond)
-					lock.Release()
-					continue
+				floor = price.Mul(order.Amount).Truncate(8)
+				if !order.Frozen.IsZero() {
+					floor = order.Frozen
 				}
 			}
-			logx.Info("更新钱包成功:" + order.OrderId)
-			lock.Release()
+			settle.PaySymbol, settle.Frozen, settle.Spent = order.BaseSymbol, floor.Sub(order.Transfer), order.Turnover
+		} else {
+			//卖 不管是市价还是限价 冻结的都是amount个币
+			settle.PaySymbol, settle.Frozen, settle.Spent = order.CoinSymbol, order.Amount.Sub(order.Transfer), order.TradedAmount
 		}
-
+		err := walletDomain.ReleaseOrder(ctx, settle)
+		if err != nil {
+			logx.Error(err)
+			cli.Rput(kafkaData)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		logx.Info("更新钱包成功:" + order.OrderId)
 	}
 }
@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"strings"
+	"time"
+	"ucenter/internal/config"
+	"ucenter/internal/database"
+	"ucenter/internal/domain"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+// ExchangeTrade 成交消息 和exchange服务的model.ExchangeTrade保持一致
+type ExchangeTrade struct {
+	TradeId      string          `json:"tradeId"`
+	Symbol       string          `json:"symbol"`
+	Price        decimal.Decimal `json:"price"`
+	Amount       decimal.Decimal `json:"amount"`
+	Turnover     decimal.Decimal `json:"turnover"`
+	BuyOrderId   string          `json:"buyOrderId"`
+	SellOrderId  string          `json:"sellOrderId"`
+	BuyMemberId  int64           `json:"buyMemberId"`
+	SellMemberId int64           `json:"sellMemberId"`
+	BuyFee       decimal.Decimal `json:"buyFee"`  // 买方手续费 从收到的币里扣
+	SellFee      decimal.Decimal `json:"sellFee"` // 卖方手续费 从收到的钱里扣
+	BuyDiscount  string          `json:"buyDiscount"`
+	SellDiscount string          `json:"sellDiscount"`
+	Time         int64           `json:"time"`
+}
+
+// ExchangeOrderTrade 逐笔结算 每笔成交买方付钱收币 卖方付币收钱 马上到账
+// 付出的从冻结里扣 手续费从收到的资产里扣 选了平台币抵扣并且余额够的从平台币钱包扣
+// 同一笔成交只结算一次 订单结束时只解冻剩下的部分
+func ExchangeOrderTrade(redisCli *redis.Redis, cli *database.KafkaClient, db *msdb.MsDB, conf config.ExchangeConfig) {
+	walletDomain := domain.NewMemberWalletDomain(db, nil, nil)
+	for {
+		kafkaData := cli.Read()
+		var trade *ExchangeTrade
+		json.Unmarshal(kafkaData.Data, &trade)
+		if trade == nil || trade.TradeId == "" {
+			continue
+		}
+		// BTC/USDT
+		index := strings.Index(trade.Symbol, "/")
+		if index < 0 {
+			logx.Errorf("交易对格式不对,tradeId=%s,symbol=%s", trade.TradeId, trade.Symbol)
+			continue
+		}
+		coinSymbol, baseSymbol := trade.Symbol[:index], trade.Symbol[index+1:]
+		ctx := context.Background()
+		buy := &domain.FillSide{
+			MemberId:  trade.BuyMemberId,
+			PaySymbol: baseSymbol,
+			Spent:     trade.Turnover,
+			GetSymbol: coinSymbol,
+			Received:  trade.Amount,
+			Fee:       newOrderFee(conf, trade.BuyOrderId, coinSymbol, trade.BuyFee),
+		}
+		sell := &domain.FillSide{
+			MemberId:  trade.SellMemberId,
+			PaySymbol: coinSymbol,
+			Spent:     trade.Amount,
+			GetSymbol: baseSymbol,
+			Received:  trade.Turnover,
+			Fee:       newOrderFee(conf, trade.SellOrderId, baseSymbol, trade.SellFee),
+		}
+		discountFee(ctx, redisCli, walletDomain, conf, trade.BuyDiscount, buy, coinSymbol, baseSymbol)
+		discountFee(ctx, redisCli, walletDomain, conf, trade.SellDiscount, sell, coinSymbol, baseSymbol)
+		err := walletDomain.SettleFill(ctx, trade.TradeId, buy, sell)
+		if err != nil {
+			logx.Errorf("逐笔结算失败,tradeId=%s,err=%v", trade.TradeId, err)
+			cli.Rput(kafkaData)
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		logx.Info("逐笔结算成功:" + trade.TradeId)
+	}
+}
+
+func newOrderFee(conf config.ExchangeConfig, orderId string, symbol string, fee decimal.Decimal) *domain.OrderFee {
+	return &domain.OrderFee{
+		MemberId:   conf.FeeMemberId,
+		Symbol:     symbol,
+		Fee:        fee,
+		OrderId:    orderId,
+		FirstRate:  conf.FirstCommission,
+		SecondRate: conf.SecondCommission,
+	}
+}
+
+// discountFee 选了平台币抵扣的 手续费按jobcenter缓存的最新价格换成平台币再打折
+// 平台币是这个交易对的币种之一 没有价格 余额不够的 都按正常从收到的资产里扣
+func discountFee(ctx context.Context, redisCli *redis.Redis, walletDomain *domain.MemberWalletDomain, conf config.ExchangeConfig, useDiscount string, side *domain.FillSide, coinSymbol string, baseSymbol string) {
+	fee := side.Fee
+	if useDiscount != "1" || conf.DiscountCoin == "" || conf.DiscountRate <= 0 || fee.Fee.Sign() <= 0 {
+		return
+	}
+	if conf.DiscountCoin == coinSymbol || conf.DiscountCoin == baseSymbol {
+		return
+	}
+	feeRate := usdtRate(redisCli, fee.Symbol)
+	coinRate := usdtRate(redisCli, conf.DiscountCoin)
+	if feeRate.Sign() <= 0 || coinRate.Sign() <= 0 {
+		return
+	}
+	amount := fee.Fee.Mul(feeRate).Mul(decimal.NewFromFloat(conf.DiscountRate)).Div(coinRate, 8, decimal.RoundCeiling)
+	wallet, err := walletDomain.FindWalletByMemIdAndCoin(ctx, side.MemberId, conf.DiscountCoin)
+	if err != nil || wallet == nil || wallet.Balance.LessThan(amount) {
+		return
+	}
+	fee.DiscountSymbol = conf.DiscountCoin
+	fee.DiscountFee = amount
+}
+
+// usdtRate jobcenter缓存的USDT价格 没有缓存返回0
+func usdtRate(redisCli *redis.Redis, symbol string) decimal.Decimal {
+	if symbol == "USDT" {
+		return decimal.NewFromInt(1)
+	}
+	val, err := redisCli.Get(symbol + "::USDT::RATE")
+	if err != nil || val == "" {
+		return decimal.Zero
+	}
+	// 缓存里存的是json字符串
+	var rate string
+	if err := json.Unmarshal([]byte(val), &rate); err != nil {
+		return decimal.Zero
+	}
+	d, err := decimal.NewFromString(rate)
+	if err != nil {
+		return decimal.Zero
+	}
+	return d
+}
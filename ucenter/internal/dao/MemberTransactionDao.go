@@ -56,6 +56,13 @@ func (d *MemberTransactionDao) Save(ctx context.Context, transaction *model.Memb
 	return err
 }
 
+// SaveTx 在事务里记流水 和钱包变动一起提交
+func (d *MemberTransactionDao) SaveTx(ctx context.Context, conn msdb.DbConn, transaction *model.MemberTransaction) error {
+	con := conn.(*gorms.GormConn)
+	tx := con.Tx(ctx)
+	return tx.Create(transaction).Error
+}
+
 func (d *MemberTransactionDao) FindByAmountAndTime(
 	ctx context.Context,
 	address string,
@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"ucenter/internal/model"
+)
+
+type MemberCommissionDao struct {
+	conn *gorms.GormConn
+}
+
+func NewMemberCommissionDao(db *msdb.MsDB) *MemberCommissionDao {
+	return &MemberCommissionDao{
+		conn: gorms.New(db.Conn),
+	}
+}
+
+// SaveTx 在订单结算的事务里记返佣
+func (d *MemberCommissionDao) SaveTx(ctx context.Context, conn msdb.DbConn, commission *model.MemberCommission) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Create(commission).Error
+}
+
+// FindPending 待发放的返佣 按id从小到大 一次最多limit条 发放失败还没到重试时间的跳过
+func (d *MemberCommissionDao) FindPending(ctx context.Context, now int64, limit int) (list []*model.MemberCommission, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.MemberCommission{}).
+		Where("status=? and retry_time<=?", model.CommissionPending, now).
+		Order("id asc").
+		Limit(limit).
+		Find(&list).Error
+	return
+}
+
+// UpdatePaid 改成已发放 只改还是待发放的 返回更新的行数 少了说明别的任务已经发过了
+func (d *MemberCommissionDao) UpdatePaid(ctx context.Context, conn msdb.DbConn, ids []int64, payTime int64) (int64, error) {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	updateSql := "update member_commission set status=?,pay_time=? where id in ? and status=?"
+	result := tx.Exec(updateSql, model.CommissionPaid, payTime, ids, model.CommissionPending)
+	return result.RowsAffected, result.Error
+}
+
+// UpdateRetry 发放失败的 retryTime 之前不再发 失败次数到了 maxRetries 的改成发放失败
+func (d *MemberCommissionDao) UpdateRetry(ctx context.Context, ids []int64, retryTime int64, maxRetries int) error {
+	session := d.conn.Session(ctx)
+	updateSql := "update member_commission set status=if(retries+1>=?,?,status),retries=retries+1,retry_time=? where id in ? and status=?"
+	return session.Exec(updateSql, maxRetries, model.CommissionFailed, retryTime, ids, model.CommissionPending).Error
+}
+
+// SumByMemberId 邀请人按币种和状态汇总的返佣
+func (d *MemberCommissionDao) SumByMemberId(ctx context.Context, memberId int64) (list []*model.CommissionSum, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.MemberCommission{}).
+		Select("member_id,symbol,status,sum(amount) as amount").
+		Where("member_id=?", memberId).
+		Group("member_id,symbol,status").
+		Find(&list).Error
+	return
+}
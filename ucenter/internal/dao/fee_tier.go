@@ -0,0 +1,37 @@
+package dao
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"ucenter/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type FeeTierDao struct {
+	conn *gorms.GormConn
+}
+
+func NewFeeTierDao(db *msdb.MsDB) *FeeTierDao {
+	return &FeeTierDao{
+		conn: gorms.New(db.Conn),
+	}
+}
+
+// FindAll 所有手续费等级 按等级从低到高
+func (d *FeeTierDao) FindAll(ctx context.Context) (list []*model.FeeTier, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.FeeTier{}).Order("level asc").Find(&list).Error
+	return
+}
+
+// FindByLevel 没有这个等级返回nil
+func (d *FeeTierDao) FindByLevel(ctx context.Context, level int64) (tier *model.FeeTier, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.FeeTier{}).Where("level=?", level).Take(&tier).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return
+}
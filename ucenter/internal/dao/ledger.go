@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"ucenter/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type MemberLedgerDao struct {
+	conn *gorms.GormConn
+}
+
+func NewMemberLedgerDao(db *msdb.MsDB) *MemberLedgerDao {
+	return &MemberLedgerDao{
+		conn: gorms.New(db.Conn),
+	}
+}
+
+// SaveAll 在钱包变动的事务里写分录
+func (d *MemberLedgerDao) SaveAll(ctx context.Context, conn msdb.DbConn, list []*model.MemberLedger) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Create(&list).Error
+}
+
+// FindLedger 用户自己账户的分录 symbol为空 ledgerType小于0 时间为0的条件不加
+func (d *MemberLedgerDao) FindLedger(ctx context.Context, memberId int64, symbol string, ledgerType int, startTime int64, endTime int64, pageNo int64, pageSize int64) (list []*model.MemberLedger, total int64, err error) {
+	session := d.conn.Session(ctx)
+	db := session.Model(&model.MemberLedger{}).Where("member_id=?", memberId)
+	if symbol != "" {
+		db = db.Where("symbol=?", symbol)
+	}
+	if ledgerType >= 0 {
+		db = db.Where("type=?", ledgerType)
+	}
+	if startTime > 0 && endTime > 0 {
+		db = db.Where("create_time>=? and create_time<=?", startTime, endTime)
+	}
+	err = db.Count(&total).Error
+	if err != nil {
+		return
+	}
+	err = db.Order("id desc").Limit(int(pageSize)).Offset(int((pageNo - 1) * pageSize)).Find(&list).Error
+	return
+}
+
+// FindStatement 一个账户一段时间内的分录 按记账顺序
+func (d *MemberLedgerDao) FindStatement(ctx context.Context, memberId int64, symbol string, account int, startTime int64, endTime int64) (list []*model.MemberLedger, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.MemberLedger{}).
+		Where("member_id=? and symbol=? and account=?", memberId, symbol, account).
+		Where("create_time>=? and create_time<=?", startTime, endTime).
+		Order("id asc").
+		Find(&list).Error
+	return
+}
+
+// FindLastBefore 这个时间之前的最后一条分录 没有返回nil
+func (d *MemberLedgerDao) FindLastBefore(ctx context.Context, memberId int64, symbol string, account int, time int64) (ledger *model.MemberLedger, err error) {
+	session := d.conn.Session(ctx)
+	err = session.Model(&model.MemberLedger{}).
+		Where("member_id=? and symbol=? and account=? and create_time<?", memberId, symbol, account, time).
+		Order("id desc").
+		Take(&ledger).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return
+}
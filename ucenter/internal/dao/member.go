@@ -52,3 +52,42 @@ func (m *MemberDao) FindMemberById(ctx context.Context, memberId int64) (Member
 	}
 	return
 }
+
+
+// ResetFeeTier 所有会员的成交额和手续费等级清零 重新计算前调用
+func (m *MemberDao) ResetFeeTier(ctx context.Context, conn msdb.DbConn) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Exec("update member set fee_tier=0,trade_volume=0").Error
+}
+
+func (m *MemberDao) UpdateTradeVolume(ctx context.Context, conn msdb.DbConn, memberId int64, volume float64) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Exec("update member set trade_volume=? where id=?", volume, memberId).Error
+}
+
+// UpdateFeeTier 会员等级或者成交额满足条件的 都改成这个等级
+func (m *MemberDao) UpdateFeeTier(ctx context.Context, conn msdb.DbConn, level int64, vipLevel int64, minVolume float64) error {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	return tx.Exec("update member set fee_tier=? where member_grade_id>=? or trade_volume>=?", level, vipLevel, minVolume).Error
+}
+
+// FindByPromotionCode 按邀请码找邀请人 没有返回nil
+func (m *MemberDao) FindByPromotionCode(ctx context.Context, code string) (mem *model.Member, err error) {
+	session := m.conn.Session(ctx)
+	err = session.Model(&model.Member{}).Where("promotion_code=?", code).Take(&mem).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return
+}
+
+// CountInvitee 直接邀请和间接邀请的人数
+func (m *MemberDao) CountInvitee(ctx context.Context, memberId int64) (first int64, second int64, err error) {
+	session := m.conn.Session(ctx)
+	err = session.Model(&model.Member{}).Where("inviter_id=?", memberId).Count(&first).Error
+	if err != nil {
+		return
+	}
+	err = m.conn.Session(ctx).Model(&model.Member{}).Where("inviter_parent_id=?", memberId).Count(&second).Error
+	return
+}
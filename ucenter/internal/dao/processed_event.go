@@ -0,0 +1,27 @@
+package dao
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/gorms"
+	"ucenter/internal/model"
+
+	"gorm.io/gorm/clause"
+)
+
+type ProcessedEventDao struct {
+	conn *gorms.GormConn
+}
+
+func NewProcessedEventDao(db *msdb.MsDB) *ProcessedEventDao {
+	return &ProcessedEventDao{
+		conn: gorms.New(db.Conn),
+	}
+}
+
+// Save 在事务里记下处理过的消息 event_key 已经有了返回false
+func (d *ProcessedEventDao) Save(ctx context.Context, conn msdb.DbConn, event *model.ProcessedEvent) (bool, error) {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	return result.RowsAffected > 0, result.Error
+}
@@ -2,12 +2,14 @@ package dao
 
 import (
 	"context"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 	"mscoin-common/msdb/gorms"
 	"ucenter/internal/model"
 
 	"github.com/zeromicro/go-zero/core/logx"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MemberWalletDao struct {
@@ -43,14 +45,6 @@ func (m *MemberWalletDao) Save(ctx context.Context, mw *model.MemberWallet) erro
 	return session.Save(mw).Error
 }
 
-func (m *MemberWalletDao) UpdateFreeze(ctx context.Context, conn msdb.DbConn, memberId int64, symbol string, money float64) error {
-	con := conn.(*gorms.GormConn)
-	session := con.Tx(ctx)
-	sql := "update member_wallet set balance=balance-?, frozen_balance=frozen_balance+? where member_id=? and coin_name=?"
-	err := session.Model(&model.MemberWallet{}).Exec(sql, money, money, memberId, symbol).Error
-	return err
-}
-
 func (m *MemberWalletDao) FindByIdAndCoinId(ctx context.Context, memberId int64, coinId int64) (mw *model.MemberWallet, err error) {
 	session := m.conn.Session(ctx)
 	err = session.Model(&model.MemberWallet{}).Where("member_id = ? and coin_id = ?", memberId, coinId).Take(&mw).Error
@@ -61,13 +55,26 @@ func (m *MemberWalletDao) FindByIdAndCoinId(ctx context.Context, memberId int64,
 
 }
 
-func (m *MemberWalletDao) UpdateWallet(ctx context.Context, conn msdb.DbConn, id int64, balance float64, frozenBalance float64) error {
-	gormConn := conn.(*gorms.GormConn)
-	tx := gormConn.Tx(ctx)
-	//Update
-	updateSql := "update member_wallet set balance=?,frozen_balance=? where id=?"
-	err := tx.Model(&model.MemberWallet{}).Exec(updateSql, balance, frozenBalance, id).Error
-	return err
+// FindForUpdate 在事务里查钱包并锁住 记账时先锁再按分录改余额 没有返回nil
+func (m *MemberWalletDao) FindForUpdate(ctx context.Context, conn msdb.DbConn, memberId int64, symbol string) (mw *model.MemberWallet, err error) {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	err = tx.Model(&model.MemberWallet{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("member_id=? and coin_name=?", memberId, symbol).
+		Take(&mw).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return
+}
+
+// ChangeBalance 余额和冻结余额加上变动量 只在记账时调用 变动量和分录一致
+// 版本号和查出来时不一样说明钱包被别的地方改过了 返回更新的行数为0
+func (m *MemberWalletDao) ChangeBalance(ctx context.Context, conn msdb.DbConn, id int64, version int, balance decimal.Decimal, frozenBalance decimal.Decimal) (int64, error) {
+	tx := conn.(*gorms.GormConn).Tx(ctx)
+	updateSql := "update member_wallet set balance=balance+?,frozen_balance=frozen_balance+?,version=version+1 where id=? and version=?"
+	result := tx.Model(&model.MemberWallet{}).Exec(updateSql, balance, frozenBalance, id, version)
+	return result.RowsAffected, result.Error
 }
 
 func (m *MemberWalletDao) UpdateAddress(ctx context.Context, wallet *model.MemberWallet) error {
@@ -17,15 +17,15 @@ func NewWithdrawRecordDao(db *msdb.MsDB) *WithdrawRecordDao {
 	}
 }
 
-func (m *WithdrawRecordDao) Save(ctx context.Context, record *model.WithdrawRecord) error {
-	session := m.conn.Session(ctx)
+func (m *WithdrawRecordDao) Save(ctx context.Context, conn msdb.DbConn, record *model.WithdrawRecord) error {
+	session := conn.(*gorms.GormConn).Tx(ctx)
 	err := session.Save(record).Error
 	return err
 }
 
 
-func (m *WithdrawRecordDao) UpdateSuccess(ctx context.Context, record model.WithdrawRecord) error {
-	session := m.conn.Session(ctx)
+func (m *WithdrawRecordDao) UpdateSuccess(ctx context.Context, conn msdb.DbConn, record model.WithdrawRecord) error {
+	session := conn.(*gorms.GormConn).Tx(ctx)
 	err := session.Model(&model.WithdrawRecord{}).
 		Where("id=?", record.Id).
 		Updates(map[string]any{"transaction_number": record.TransactionNumber, "status": record.Status, "deal_time": record.DealTime}).
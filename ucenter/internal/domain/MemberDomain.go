@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"errors"
+	"math/rand"
 	"mscoin-common/msdb"
 	"mscoin-common/tools"
 	"regexp"
@@ -52,7 +53,20 @@ func (m *MemberDomain) Register(
 	member.Password = pwd
 	member.MobilePhone = phone
 	member.FillSuperPartner(partner)
-	member.PromotionCode = promotion
+	// promotion 是填的邀请人的邀请码 自己的邀请码重新生成
+	member.PromotionCode = newPromotionCode()
+	if promotion != "" {
+		inviter, err := m.MemberRepo.FindByPromotionCode(ctx, promotion)
+		if err != nil {
+			logx.Errorf("find inviter error: %v", err)
+			return errors.New("database error")
+		}
+		// 邀请码不对的不影响注册 只是没有邀请人
+		if inviter != nil {
+			member.InviterId = inviter.Id
+			member.InviterParentId = inviter.InviterId
+		}
+	}
 	member.MemberLevel = model.GENERAL
 	member.Salt = salt
 	member.Avatar = "https://mszlu.oss-cn-beijing.aliyuncs.com/mscoin/defaultavatar.png"
@@ -65,6 +79,16 @@ func (m *MemberDomain) Register(
 
 }
 
+// newPromotionCode 8位大写字母和数字的邀请码
+func newPromotionCode() string {
+	const letters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	code := make([]byte, 8)
+	for i := range code {
+		code[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(code)
+}
+
 func (m *MemberDomain) FindByPhone(context context.Context, phone string) (*model.Member, error) {
 	// 1. 判断手机号是否为空
 	if phone == "" {
@@ -3,7 +3,10 @@ package domain
 import (
 	"context"
 	"errors"
+	"fmt"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/tran"
 	"ucenter/internal/dao"
 	"ucenter/internal/model"
 	"ucenter/internal/repo"
@@ -12,12 +15,16 @@ import (
 type MemberTransactionDomain struct {
 	memberTransactionRepo repo.MemberTransactionRepo
 	memberWalletDomain    *MemberWalletDomain
+	ledgerDomain          *LedgerDomain
+	transaction           tran.Transaction
 }
 
 func NewMemberTransactionDomain(db *msdb.MsDB) *MemberTransactionDomain {
 	return &MemberTransactionDomain{
 		memberTransactionRepo: dao.NewMemberTransactionDao(db),
 		memberWalletDomain:    NewMemberWalletDomain(db, nil, nil),
+		ledgerDomain:          NewLedgerDomain(db),
+		transaction:           tran.NewTransaction(db.Conn),
 	}
 }
 
@@ -72,7 +79,15 @@ func (d *MemberTransactionDomain) SaveRecharge(address string, value float64, ti
 		memberTransaction.CreateTime = time * 1000
 		memberTransaction.Amount = value
 		memberTransaction.Symbol = symbol
-		err := d.memberTransactionRepo.Save(ctx, memberTransaction)
+		// 充值到账 从链上账户转到可用 和充值流水一起提交
+		err := d.transaction.Action(func(conn msdb.DbConn) error {
+			err := d.memberTransactionRepo.SaveTx(ctx, conn, memberTransaction)
+			if err != nil {
+				return err
+			}
+			return d.ledgerDomain.Post(ctx, conn, NewJournal(model.LedgerDeposit, fmt.Sprintf("%d", memberTransaction.Id)).
+				Transfer(symbol, decimal.NewFromFloat(value), External, Available(wallet.MemberId)))
+		})
 		if err != nil {
 			return err
 		}
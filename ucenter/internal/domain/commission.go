@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/tran"
+	"time"
+	"ucenter/internal/dao"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type CommissionDomain struct {
+	commissionRepo        repo.MemberCommissionRepo
+	memberRepo            repo.MemberRepo
+	ledgerDomain          *LedgerDomain
+	memberTransactionRepo repo.MemberTransactionRepo
+	transaction           tran.Transaction
+}
+
+func NewCommissionDomain(db *msdb.MsDB) *CommissionDomain {
+	return &CommissionDomain{
+		commissionRepo:        dao.NewMemberCommissionDao(db),
+		memberRepo:            dao.NewMemberDao(db),
+		ledgerDomain:          NewLedgerDomain(db),
+		memberTransactionRepo: dao.NewMemberTransactionDao(db),
+		transaction:           tran.NewTransaction(db.Conn),
+	}
+}
+
+// commissionBatch 同一个邀请人同一个币种的返佣合成一笔发
+type commissionBatch struct {
+	memberId int64
+	symbol   string
+	amount   decimal.Decimal
+	ids      []int64
+	list     []*model.MemberCommission
+}
+
+// 发放失败的隔一段时间再发 间隔按失败次数翻倍 次数用完改成发放失败
+const (
+	commissionMaxRetries = 10
+	commissionMaxBackoff = 24 * time.Hour
+)
+
+// Pay 发放待发放的返佣 从平台手续费账户转到邀请人钱包 双方各记一条返佣流水
+// 每个邀请人每个币种一个事务 一笔失败不影响别的 隔一段时间再发 不会一直排在前面挡住别的 返回发放的条数
+func (d *CommissionDomain) Pay(ctx context.Context, feeMemberId int64, limit int) (int64, error) {
+	list, err := d.commissionRepo.FindPending(ctx, time.Now().UnixMilli(), limit)
+	if err != nil {
+		logx.Errorw("Domain-PayCommission", logx.Field("error", err))
+		return 0, err
+	}
+	var batches []*commissionBatch
+	index := make(map[string]*commissionBatch)
+	for _, c := range list {
+		key := fmt.Sprintf("%d::%s", c.MemberId, c.Symbol)
+		b, ok := index[key]
+		if !ok {
+			b = &commissionBatch{memberId: c.MemberId, symbol: c.Symbol, amount: decimal.Zero}
+			index[key] = b
+			batches = append(batches, b)
+		}
+		b.amount = b.amount.Add(c.Amount)
+		b.ids = append(b.ids, c.Id)
+		b.list = append(b.list, c)
+	}
+	var total int64
+	for _, b := range batches {
+		err := d.payBatch(ctx, feeMemberId, b)
+		if err != nil {
+			logx.Errorw("Domain-PayCommission", logx.Field("error", err), logx.Field("memberId", b.memberId), logx.Field("symbol", b.symbol))
+			d.retryLater(ctx, b)
+			continue
+		}
+		total += int64(len(b.ids))
+	}
+	return total, nil
+}
+
+// retryLater 发放失败的一批 按其中失败最多的一条算下次发放的时间
+func (d *CommissionDomain) retryLater(ctx context.Context, b *commissionBatch) {
+	retries := 0
+	for _, c := range b.list {
+		retries = max(retries, c.Retries)
+	}
+	backoff := min(time.Minute<<min(retries, 16), commissionMaxBackoff)
+	err := d.commissionRepo.UpdateRetry(ctx, b.ids, time.Now().Add(backoff).UnixMilli(), commissionMaxRetries)
+	if err != nil {
+		logx.Errorw("Domain-PayCommission", logx.Field("error", err), logx.Field("ids", b.ids))
+	}
+}
+
+func (d *CommissionDomain) payBatch(ctx context.Context, feeMemberId int64, b *commissionBatch) error {
+	return d.transaction.Action(func(conn msdb.DbConn) error {
+		now := time.Now().UnixMilli()
+		rows, err := d.commissionRepo.UpdatePaid(ctx, conn, b.ids, now)
+		if err != nil {
+			return err
+		}
+		if rows != int64(len(b.ids)) {
+			return fmt.Errorf("返佣已经发放过了,ids=%v", b.ids)
+		}
+		// 每条返佣一组分录 平台账户余额不够或者邀请人没有这个币的钱包 记账会报错 留着下次再发
+		journals := make([]*Journal, len(b.list))
+		for i, c := range b.list {
+			journals[i] = NewJournal(model.LedgerCommission, fmt.Sprintf("%d", c.Id)).
+				Transfer(b.symbol, c.Amount, Available(feeMemberId), Available(b.memberId))
+		}
+		if err := d.ledgerDomain.Post(ctx, conn, journals...); err != nil {
+			return err
+		}
+		for _, mt := range []*model.MemberTransaction{
+			{MemberId: b.memberId, Amount: b.amount.Float64(), Symbol: b.symbol, Type: model.EXCHANGE_PROMOTION, CreateTime: now},
+			{MemberId: feeMemberId, Amount: b.amount.Neg().Float64(), Symbol: b.symbol, Type: model.EXCHANGE_PROMOTION, CreateTime: now},
+		} {
+			if err := d.memberTransactionRepo.SaveTx(ctx, conn, mt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Summary 邀请人的返佣按币种汇总 还有直接和间接邀请的人数
+func (d *CommissionDomain) Summary(ctx context.Context, memberId int64) (list []*model.CommissionSum, first int64, second int64, err error) {
+	list, err = d.commissionRepo.SumByMemberId(ctx, memberId)
+	if err != nil {
+		logx.Errorw("Domain-CommissionSummary", logx.Field("error", err), logx.Field("memberId", memberId))
+		return
+	}
+	first, second, err = d.memberRepo.CountInvitee(ctx, memberId)
+	if err != nil {
+		logx.Errorw("Domain-CommissionSummary", logx.Field("error", err), logx.Field("memberId", memberId))
+	}
+	return
+}
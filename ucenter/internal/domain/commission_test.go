@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"testing"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+)
+
+type memCommissionRepo struct {
+	repo.MemberCommissionRepo
+	s *memStore
+}
+
+func (r *memCommissionRepo) FindPending(ctx context.Context, now int64, limit int) (list []*model.MemberCommission, err error) {
+	for _, c := range r.s.commissions {
+		if len(list) < limit && c.Status == model.CommissionPending && c.RetryTime <= now {
+			list = append(list, c)
+		}
+	}
+	return
+}
+
+func (r *memCommissionRepo) UpdatePaid(ctx context.Context, conn msdb.DbConn, ids []int64, payTime int64) (int64, error) {
+	var rows int64
+	for _, c := range r.find(ids) {
+		if c.Status == model.CommissionPending {
+			c.Status, c.PayTime = model.CommissionPaid, payTime
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memCommissionRepo) UpdateRetry(ctx context.Context, ids []int64, retryTime int64, maxRetries int) error {
+	for _, c := range r.find(ids) {
+		if c.Status != model.CommissionPending {
+			continue
+		}
+		c.Retries++
+		c.RetryTime = retryTime
+		if c.Retries >= maxRetries {
+			c.Status = model.CommissionFailed
+		}
+	}
+	return nil
+}
+
+func (r *memCommissionRepo) find(ids []int64) (list []*model.MemberCommission) {
+	for _, c := range r.s.commissions {
+		for _, id := range ids {
+			if c.Id == id {
+				list = append(list, c)
+			}
+		}
+	}
+	return
+}
+
+// 发不出去的返佣隔一段时间再发 不能每次都排在最前面 把后面能发的挡住
+func TestPayCommissionBacksOffFailedBatch(t *testing.T) {
+	s := newMemStore()
+	s.addWallet(platformId, "USDT", "10", "0")
+	s.addWallet(3, "USDT", "0", "0")
+	// 邀请人5没有USDT钱包 一直发不出去
+	for i := int64(1); i <= 3; i++ {
+		s.commissions = append(s.commissions, &model.MemberCommission{Id: i, MemberId: 5, Symbol: "USDT", Amount: dec("0.1")})
+	}
+	s.commissions = append(s.commissions, &model.MemberCommission{Id: 4, MemberId: 3, Symbol: "USDT", Amount: dec("0.2")})
+	d := &CommissionDomain{
+		commissionRepo:        &memCommissionRepo{s: s},
+		ledgerDomain:          newTestLedger(s),
+		memberTransactionRepo: &memTransactionRepo{},
+		transaction:           s,
+	}
+	// 一次只取3条 全是发不出去的
+	total, err := d.Pay(context.Background(), platformId, 3)
+	if err != nil || total != 0 {
+		t.Fatalf("first pay total=%d err=%v, want 0", total, err)
+	}
+	for _, c := range s.commissions[:3] {
+		if c.Status != model.CommissionPending || c.Retries != 1 || c.RetryTime == 0 {
+			t.Fatalf("failed commission %+v, want pending with a retry time", c)
+		}
+	}
+	total, err = d.Pay(context.Background(), platformId, 3)
+	if err != nil || total != 1 {
+		t.Fatalf("second pay total=%d err=%v, want 1", total, err)
+	}
+	if c := s.commissions[3]; c.Status != model.CommissionPaid {
+		t.Fatalf("commission behind the failed batch %+v, want paid", c)
+	}
+	if !s.wallet(3, "USDT").Balance.Equal(dec("0.2")) || !s.wallet(platformId, "USDT").Balance.Equal(dec("9.8")) {
+		t.Fatalf("balances inviter=%s platform=%s", s.wallet(3, "USDT").Balance, s.wallet(platformId, "USDT").Balance)
+	}
+	checkBalanced(t, s)
+
+	// 重试次数用完改成发放失败
+	for i := 1; i < commissionMaxRetries; i++ {
+		for _, c := range s.commissions[:3] {
+			c.RetryTime = 0
+		}
+		if _, err := d.Pay(context.Background(), platformId, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range s.commissions[:3] {
+		if c.Status != model.CommissionFailed || c.Retries != commissionMaxRetries {
+			t.Fatalf("commission %+v, want failed after %d retries", c, commissionMaxRetries)
+		}
+	}
+}
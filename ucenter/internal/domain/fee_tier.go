@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"mscoin-common/msdb/tran"
+	"ucenter/internal/dao"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type FeeTierDomain struct {
+	feeTierRepo repo.FeeTierRepo
+	memberRepo  repo.MemberRepo
+	transaction tran.Transaction
+}
+
+func NewFeeTierDomain(db *msdb.MsDB) *FeeTierDomain {
+	return &FeeTierDomain{
+		feeTierRepo: dao.NewFeeTierDao(db),
+		memberRepo:  dao.NewMemberDao(db),
+		transaction: tran.NewTransaction(db.Conn),
+	}
+}
+
+// FindByLevel 会员当前的手续费等级 等级为0或者等级已经删掉了返回nil 按交易对的费率收
+func (d *FeeTierDomain) FindByLevel(ctx context.Context, level int64) (*model.FeeTier, error) {
+	if level <= 0 {
+		return nil, nil
+	}
+	tier, err := d.feeTierRepo.FindByLevel(ctx, level)
+	if err != nil {
+		logx.Errorw("Domain-FindFeeTier", logx.Field("error", err), logx.Field("level", level))
+	}
+	return tier, err
+}
+
+// Refresh 按30天成交额重新计算所有会员的手续费等级
+// 先把所有会员的成交额和等级清零 再写入这次的成交额 最后按等级从低到高更新 满足条件的最高等级覆盖低的
+func (d *FeeTierDomain) Refresh(ctx context.Context, volumes map[int64]float64) error {
+	tiers, err := d.feeTierRepo.FindAll(ctx)
+	if err != nil {
+		logx.Errorw("Domain-RefreshFeeTier", logx.Field("error", err))
+		return err
+	}
+	err = d.transaction.Action(func(conn msdb.DbConn) error {
+		if err := d.memberRepo.ResetFeeTier(ctx, conn); err != nil {
+			return err
+		}
+		for memberId, volume := range volumes {
+			if err := d.memberRepo.UpdateTradeVolume(ctx, conn, memberId, volume); err != nil {
+				return err
+			}
+		}
+		for _, tier := range tiers {
+			if err := d.memberRepo.UpdateFeeTier(ctx, conn, tier.Level, tier.VipLevel, tier.MinVolume); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logx.Errorw("Domain-RefreshFeeTier", logx.Field("error", err))
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"mscoin-common/tools"
+	"time"
+	"ucenter/internal/dao"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ErrInsufficientBalance 记账后余额或冻结不够 重试也不会成功
+var ErrInsufficientBalance = errors.New("余额不足")
+
+// LedgerAccount 记账的账户 用户的可用和冻结对应钱包的两个余额 系统账户member_id为0
+type LedgerAccount struct {
+	MemberId int64
+	Account  int
+}
+
+func Available(memberId int64) LedgerAccount {
+	return LedgerAccount{MemberId: memberId, Account: model.AccountAvailable}
+}
+
+func Frozen(memberId int64) LedgerAccount {
+	return LedgerAccount{MemberId: memberId, Account: model.AccountFrozen}
+}
+
+var (
+	Clearing = LedgerAccount{Account: model.AccountClearing}
+	External = LedgerAccount{Account: model.AccountExternal}
+)
+
+func (a LedgerAccount) wallet() bool {
+	return a.Account == model.AccountAvailable || a.Account == model.AccountFrozen
+}
+
+type transfer struct {
+	symbol string
+	amount decimal.Decimal
+	from   LedgerAccount
+	to     LedgerAccount
+}
+
+// Journal 一次资金变动 每笔转账借转出账户贷转入账户 借贷一定相等
+type Journal struct {
+	ledgerType int
+	refId      string
+	transfers  []transfer
+}
+
+func NewJournal(ledgerType int, refId string) *Journal {
+	return &Journal{ledgerType: ledgerType, refId: refId}
+}
+
+// Transfer 从from转amount到to 为0的不记 负数反过来记
+func (j *Journal) Transfer(symbol string, amount decimal.Decimal, from LedgerAccount, to LedgerAccount) *Journal {
+	if amount.IsZero() {
+		return j
+	}
+	if amount.IsNegative() {
+		amount, from, to = amount.Neg(), to, from
+	}
+	j.transfers = append(j.transfers, transfer{symbol: symbol, amount: amount, from: from, to: to})
+	return j
+}
+
+type LedgerDomain struct {
+	ledgerRepo       repo.MemberLedgerRepo
+	memberWalletRepo repo.MemberWalletRepo
+}
+
+func NewLedgerDomain(db *msdb.MsDB) *LedgerDomain {
+	return &LedgerDomain{
+		ledgerRepo:       dao.NewMemberLedgerDao(db),
+		memberWalletRepo: dao.NewMemberWalletDao(db),
+	}
+}
+
+// Post 记账 必须在事务里调用 先锁住涉及的钱包 按分录算出每条之后的余额 余额或冻结不够的报错
+// 再把变动量按版本号加到钱包上 分录和钱包一起提交
+func (d *LedgerDomain) Post(ctx context.Context, conn msdb.DbConn, journals ...*Journal) error {
+	type walletKey struct {
+		memberId int64
+		symbol   string
+	}
+	wallets := make(map[walletKey]*model.MemberWallet)
+	var keys []walletKey
+	now := time.Now().UnixMilli()
+	var lines []*model.MemberLedger
+	for _, j := range journals {
+		if len(j.transfers) == 0 {
+			continue
+		}
+		journalId := tools.Unq("J")
+		for _, t := range j.transfers {
+			for _, side := range []struct {
+				account   LedgerAccount
+				direction int
+			}{{t.from, model.Debit}, {t.to, model.Credit}} {
+				line := &model.MemberLedger{
+					JournalId:  journalId,
+					Type:       j.ledgerType,
+					RefId:      j.refId,
+					MemberId:   side.account.MemberId,
+					Symbol:     t.symbol,
+					Account:    side.account.Account,
+					Direction:  side.direction,
+					Amount:     t.amount,
+					Balance:    decimal.Zero,
+					CreateTime: now,
+				}
+				lines = append(lines, line)
+				if !side.account.wallet() {
+					continue
+				}
+				key := walletKey{side.account.MemberId, t.symbol}
+				mw, ok := wallets[key]
+				if !ok {
+					var err error
+					mw, err = d.memberWalletRepo.FindForUpdate(ctx, conn, key.memberId, key.symbol)
+					if err != nil {
+						return err
+					}
+					if mw == nil {
+						return fmt.Errorf("钱包不存在,memberId=%d,symbol=%s", key.memberId, key.symbol)
+					}
+					wallets[key] = mw
+					keys = append(keys, key)
+				}
+				if side.account.Account == model.AccountFrozen {
+					mw.FrozenBalance = mw.FrozenBalance.Add(line.Signed())
+					line.Balance = mw.FrozenBalance
+				} else {
+					mw.Balance = mw.Balance.Add(line.Signed())
+					line.Balance = mw.Balance
+				}
+				if line.Balance.IsNegative() {
+					return fmt.Errorf("%w,memberId=%d,symbol=%s,account=%s", ErrInsufficientBalance, key.memberId, key.symbol, model.AccountMap.Value(side.account.Account))
+				}
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	// 按分录汇总每个钱包的变动量 用相对更新 版本号对不上的整个事务回滚
+	for _, key := range keys {
+		var balance, frozen = decimal.Zero, decimal.Zero
+		for _, line := range lines {
+			if line.MemberId != key.memberId || line.Symbol != key.symbol {
+				continue
+			}
+			switch line.Account {
+			case model.AccountAvailable:
+				balance = balance.Add(line.Signed())
+			case model.AccountFrozen:
+				frozen = frozen.Add(line.Signed())
+			}
+		}
+		mw := wallets[key]
+		rows, err := d.memberWalletRepo.ChangeBalance(ctx, conn, mw.Id, mw.Version, balance, frozen)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("钱包已被修改,memberId=%d,symbol=%s,version=%d", key.memberId, key.symbol, mw.Version)
+		}
+	}
+	err := d.ledgerRepo.SaveAll(ctx, conn, lines)
+	if err != nil {
+		logx.Errorw("Domain-PostLedger", logx.Field("error", err))
+	}
+	return err
+}
+
+// FindLedger 用户自己账户的分录 按记账时间倒序
+func (d *LedgerDomain) FindLedger(ctx context.Context, memberId int64, symbol string, ledgerType string, startTime string, endTime string, pageNo int64, pageSize int64) ([]*model.MemberLedgerVo, int64, error) {
+	t := -1
+	if ledgerType != "" {
+		t = model.LedgerTypeMap.Code(ledgerType)
+		if t < 0 {
+			return nil, 0, fmt.Errorf("不支持的类型:%s", ledgerType)
+		}
+	}
+	var sTime, eTime int64
+	if startTime != "" && endTime != "" {
+		sTime, eTime = tools.ToMill(startTime), tools.ToMill(endTime)
+	}
+	list, total, err := d.ledgerRepo.FindLedger(ctx, memberId, symbol, t, sTime, eTime, pageNo, pageSize)
+	if err != nil {
+		logx.Errorw("Domain-FindLedger", logx.Field("error", err), logx.Field("memberId", memberId))
+		return nil, 0, err
+	}
+	voList := make([]*model.MemberLedgerVo, len(list))
+	for i, v := range list {
+		voList[i] = v.ToVo()
+	}
+	return voList, total, nil
+}
+
+// statementDays 对账单不传时间默认最近多少天
+const statementDays = 30
+
+// Statement 一个账户的对账单 期初是开始时间之前最后一条分录记完的余额
+func (d *LedgerDomain) Statement(ctx context.Context, memberId int64, symbol string, account string, startTime string, endTime string) (*model.LedgerStatement, error) {
+	if symbol == "" {
+		return nil, errors.New("币种不能为空")
+	}
+	a := model.AccountAvailable
+	if account != "" {
+		a = model.AccountMap.Code(account)
+		if a != model.AccountAvailable && a != model.AccountFrozen {
+			return nil, fmt.Errorf("不支持的账户:%s", account)
+		}
+	}
+	eTime := time.Now().UnixMilli()
+	sTime := time.Now().AddDate(0, 0, -statementDays).UnixMilli()
+	if startTime != "" && endTime != "" {
+		sTime, eTime = tools.ToMill(startTime), tools.ToMill(endTime)
+	}
+	last, err := d.ledgerRepo.FindLastBefore(ctx, memberId, symbol, a, sTime)
+	if err != nil {
+		logx.Errorw("Domain-LedgerStatement", logx.Field("error", err), logx.Field("memberId", memberId))
+		return nil, err
+	}
+	list, err := d.ledgerRepo.FindStatement(ctx, memberId, symbol, a, sTime, eTime)
+	if err != nil {
+		logx.Errorw("Domain-LedgerStatement", logx.Field("error", err), logx.Field("memberId", memberId))
+		return nil, err
+	}
+	// 开始记账之前就有的余额没有分录 这时按第一条分录倒推
+	opening := decimal.Zero
+	if last != nil {
+		opening = last.Balance
+	} else if len(list) > 0 {
+		opening = list[0].Balance.Sub(list[0].Signed())
+	}
+	debit, credit := decimal.Zero, decimal.Zero
+	voList := make([]*model.MemberLedgerVo, len(list))
+	for i, v := range list {
+		if v.Direction == model.Debit {
+			debit = debit.Add(v.Amount)
+		} else {
+			credit = credit.Add(v.Amount)
+		}
+		voList[i] = v.ToVo()
+	}
+	return &model.LedgerStatement{
+		Symbol:    symbol,
+		Account:   model.AccountMap.Value(a),
+		StartTime: tools.ToTimeString(sTime),
+		EndTime:   tools.ToTimeString(eTime),
+		Opening:   opening.Float64(),
+		Debit:     debit.Float64(),
+		Credit:    credit.Float64(),
+		Closing:   opening.Add(credit).Sub(debit).Float64(),
+		List:      voList,
+	}, nil
+}
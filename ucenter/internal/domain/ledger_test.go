@@ -0,0 +1,299 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mscoin-common/decimal"
+	"mscoin-common/msdb"
+	"testing"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+)
+
+// memStore 内存里的钱包 分录 处理过的消息 返佣 当作数据库用
+// Begin 拍快照 Rollback 还原 和真实事务一样 回滚后什么都没改
+type memStore struct {
+	wallets     map[string]*model.MemberWallet
+	ledger      []*model.MemberLedger
+	processed   map[string]bool
+	commissions []*model.MemberCommission
+	snap        *memStore
+	conflict    int64 // 这个钱包的 ChangeBalance 当作版本号对不上
+}
+
+func newMemStore() *memStore {
+	return &memStore{wallets: make(map[string]*model.MemberWallet), processed: make(map[string]bool)}
+}
+
+func walletKeyOf(memberId int64, symbol string) string {
+	return fmt.Sprintf("%d/%s", memberId, symbol)
+}
+
+func (s *memStore) addWallet(memberId int64, symbol string, balance string, frozen string) *model.MemberWallet {
+	mw := &model.MemberWallet{
+		Id:            int64(len(s.wallets) + 1),
+		MemberId:      memberId,
+		CoinId:        int64(len(symbol)),
+		CoinName:      symbol,
+		Balance:       decimal.RequireFromString(balance),
+		FrozenBalance: decimal.RequireFromString(frozen),
+	}
+	s.wallets[walletKeyOf(memberId, symbol)] = mw
+	return mw
+}
+
+func (s *memStore) wallet(memberId int64, symbol string) *model.MemberWallet {
+	return s.wallets[walletKeyOf(memberId, symbol)]
+}
+
+func (s *memStore) Begin() {
+	snap := &memStore{wallets: make(map[string]*model.MemberWallet), processed: make(map[string]bool)}
+	for k, v := range s.wallets {
+		c := *v
+		snap.wallets[k] = &c
+	}
+	snap.ledger = append(snap.ledger, s.ledger...)
+	for k := range s.processed {
+		snap.processed[k] = true
+	}
+	for _, c := range s.commissions {
+		cc := *c
+		snap.commissions = append(snap.commissions, &cc)
+	}
+	s.snap = snap
+}
+
+func (s *memStore) Rollback() {
+	s.wallets, s.ledger, s.processed = s.snap.wallets, s.snap.ledger, s.snap.processed
+	s.commissions = s.snap.commissions
+	s.snap = nil
+}
+
+func (s *memStore) Commit() {
+	s.snap = nil
+}
+
+func (s *memStore) Action(f func(conn msdb.DbConn) error) error {
+	s.Begin()
+	if err := f(s); err != nil {
+		s.Rollback()
+		return err
+	}
+	s.Commit()
+	return nil
+}
+
+// memWalletRepo 只实现记账用到的方法
+type memWalletRepo struct {
+	repo.MemberWalletRepo
+	s *memStore
+}
+
+func (r *memWalletRepo) FindForUpdate(ctx context.Context, conn msdb.DbConn, memberId int64, symbol string) (*model.MemberWallet, error) {
+	mw := r.s.wallet(memberId, symbol)
+	if mw == nil {
+		return nil, nil
+	}
+	c := *mw
+	return &c, nil
+}
+
+func (r *memWalletRepo) FindByIdAndCoinName(ctx context.Context, memberId int64, symbol string) (*model.MemberWallet, error) {
+	return r.FindForUpdate(ctx, nil, memberId, symbol)
+}
+
+// Save 新建的钱包余额和数据库默认值一样是0
+func (r *memWalletRepo) Save(ctx context.Context, mw *model.MemberWallet) error {
+	c := *mw
+	c.Id = int64(len(r.s.wallets) + 1)
+	c.Balance, c.FrozenBalance = decimal.Zero, decimal.Zero
+	r.s.wallets[walletKeyOf(c.MemberId, c.CoinName)] = &c
+	return nil
+}
+
+func (r *memWalletRepo) ChangeBalance(ctx context.Context, conn msdb.DbConn, id int64, version int, balance decimal.Decimal, frozenBalance decimal.Decimal) (int64, error) {
+	for _, mw := range r.s.wallets {
+		if mw.Id != id {
+			continue
+		}
+		if mw.Version != version || r.s.conflict == id {
+			return 0, nil
+		}
+		mw.Balance = mw.Balance.Add(balance)
+		mw.FrozenBalance = mw.FrozenBalance.Add(frozenBalance)
+		mw.Version++
+		return 1, nil
+	}
+	return 0, nil
+}
+
+type memLedgerRepo struct {
+	repo.MemberLedgerRepo
+	s *memStore
+}
+
+func (r *memLedgerRepo) SaveAll(ctx context.Context, conn msdb.DbConn, list []*model.MemberLedger) error {
+	r.s.ledger = append(r.s.ledger, list...)
+	return nil
+}
+
+type memProcessedRepo struct {
+	repo.ProcessedEventRepo
+	s *memStore
+}
+
+func (r *memProcessedRepo) Save(ctx context.Context, conn msdb.DbConn, event *model.ProcessedEvent) (bool, error) {
+	if r.s.processed[event.EventKey] {
+		return false, nil
+	}
+	r.s.processed[event.EventKey] = true
+	return true, nil
+}
+
+func newTestLedger(s *memStore) *LedgerDomain {
+	return &LedgerDomain{ledgerRepo: &memLedgerRepo{s: s}, memberWalletRepo: &memWalletRepo{s: s}}
+}
+
+func dec(v string) decimal.Decimal {
+	return decimal.RequireFromString(v)
+}
+
+// checkBalanced 每个分录号按币种借贷相等 钱包余额等于最后一条分录记完的余额
+func checkBalanced(t *testing.T, s *memStore) {
+	t.Helper()
+	sums := make(map[string]decimal.Decimal)
+	last := make(map[string]*model.MemberLedger)
+	for _, line := range s.ledger {
+		key := line.JournalId + "/" + line.Symbol
+		if _, ok := sums[key]; !ok {
+			sums[key] = decimal.Zero
+		}
+		sums[key] = sums[key].Add(line.Signed())
+		if line.Account == model.AccountAvailable || line.Account == model.AccountFrozen {
+			last[fmt.Sprintf("%s/%d", walletKeyOf(line.MemberId, line.Symbol), line.Account)] = line
+		}
+	}
+	for key, sum := range sums {
+		if !sum.IsZero() {
+			t.Fatalf("journal %s debits and credits differ by %s", key, sum)
+		}
+	}
+	for key, line := range last {
+		mw := s.wallet(line.MemberId, line.Symbol)
+		got := mw.Balance
+		if line.Account == model.AccountFrozen {
+			got = mw.FrozenBalance
+		}
+		if !got.Equal(line.Balance) {
+			t.Fatalf("wallet %s is %s, last ledger line says %s", key, got, line.Balance)
+		}
+	}
+}
+
+func TestPostBalancesEachJournal(t *testing.T) {
+	s := newMemStore()
+	s.addWallet(1, "USDT", "1000", "0")
+	s.addWallet(1, "BTC", "0", "0")
+	s.addWallet(2, "BTC", "5", "0")
+	s.addWallet(2, "USDT", "0", "0")
+	d := newTestLedger(s)
+	err := s.Action(func(conn msdb.DbConn) error {
+		return d.Post(context.Background(), conn,
+			NewJournal(model.LedgerFreeze, "b1").Transfer("USDT", dec("200"), Available(1), Frozen(1)),
+			NewJournal(model.LedgerFreeze, "s1").Transfer("BTC", dec("2"), Available(2), Frozen(2)),
+			NewJournal(model.LedgerTrade, "t1").
+				Transfer("USDT", dec("150"), Frozen(1), Clearing).
+				Transfer("BTC", dec("1.5"), Clearing, Available(1)).
+				Transfer("BTC", dec("1.5"), Frozen(2), Clearing).
+				Transfer("USDT", dec("150"), Clearing, Available(2)),
+			// 负数反过来记
+			NewJournal(model.LedgerUnfreeze, "b1").Transfer("USDT", dec("-50"), Available(1), Frozen(1)),
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalanced(t, s)
+	for _, c := range []struct {
+		member  int64
+		symbol  string
+		balance string
+		frozen  string
+	}{
+		{1, "USDT", "850", "0"},
+		{1, "BTC", "1.5", "0"},
+		{2, "BTC", "3", "0.5"},
+		{2, "USDT", "150", "0"},
+	} {
+		mw := s.wallet(c.member, c.symbol)
+		if !mw.Balance.Equal(dec(c.balance)) || !mw.FrozenBalance.Equal(dec(c.frozen)) {
+			t.Fatalf("wallet %d %s = %s/%s, want %s/%s", c.member, c.symbol, mw.Balance, mw.FrozenBalance, c.balance, c.frozen)
+		}
+		// 一次记账每个钱包只改一次
+		if mw.Version != 1 {
+			t.Fatalf("wallet %d %s version %d, want 1", c.member, c.symbol, mw.Version)
+		}
+	}
+}
+
+func TestPostInsufficientRollsBack(t *testing.T) {
+	s := newMemStore()
+	s.addWallet(1, "USDT", "100", "0")
+	s.addWallet(1, "BTC", "1", "0")
+	d := newTestLedger(s)
+	w := &MemberWalletDomain{ledgerDomain: d, processedEventRepo: &memProcessedRepo{s: s}}
+	err := s.Action(func(conn msdb.DbConn) error {
+		ctx := context.Background()
+		if _, err := w.FirstTime(ctx, conn, model.OrderFreezeEvent("o1")); err != nil {
+			return err
+		}
+		// 第一条够 第二条不够 整个事务都不能留下
+		return d.Post(ctx, conn,
+			NewJournal(model.LedgerFreeze, "o0").Transfer("BTC", dec("1"), Available(1), Frozen(1)),
+			NewJournal(model.LedgerFreeze, "o1").Transfer("USDT", dec("100.01"), Available(1), Frozen(1)))
+	})
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("err = %v, want insufficient balance", err)
+	}
+	if len(s.ledger) != 0 || len(s.processed) != 0 {
+		t.Fatalf("rolled back transaction left %d ledger lines and %d processed events", len(s.ledger), len(s.processed))
+	}
+	for _, mw := range s.wallets {
+		if mw.Version != 0 || !mw.FrozenBalance.IsZero() {
+			t.Fatalf("wallet %s changed: %+v", mw.CoinName, mw)
+		}
+	}
+}
+
+func TestPostVersionConflictRollsBack(t *testing.T) {
+	s := newMemStore()
+	s.addWallet(1, "USDT", "100", "0")
+	payee := s.addWallet(2, "USDT", "0", "0")
+	s.conflict = payee.Id
+	d := newTestLedger(s)
+	err := s.Action(func(conn msdb.DbConn) error {
+		return d.Post(context.Background(), conn,
+			NewJournal(model.LedgerCommission, "x1").Transfer("USDT", dec("10"), Available(1), Available(2)))
+	})
+	if err == nil || errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("err = %v, want version conflict", err)
+	}
+	// 第一个钱包已经改了 回滚后要还原
+	if mw := s.wallet(1, "USDT"); !mw.Balance.Equal(dec("100")) || mw.Version != 0 {
+		t.Fatalf("payer wallet after rollback %+v", mw)
+	}
+	if len(s.ledger) != 0 {
+		t.Fatalf("rolled back transaction left %d ledger lines", len(s.ledger))
+	}
+	// 版本号对上以后重试能记上
+	s.conflict = 0
+	err = s.Action(func(conn msdb.DbConn) error {
+		return d.Post(context.Background(), conn,
+			NewJournal(model.LedgerCommission, "x1").Transfer("USDT", dec("10"), Available(1), Available(2)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalanced(t, s)
+}
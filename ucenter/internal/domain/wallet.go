@@ -2,55 +2,69 @@ package domain
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"grpc-common/market/mclient"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 	"mscoin-common/msdb/tran"
 	"mscoin-common/op"
 	"mscoin-common/tools"
+	"time"
 	"ucenter/internal/dao"
 	"ucenter/internal/model"
 	"ucenter/internal/repo"
 
-	"github.com/jinzhu/copier"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 )
 
 type MemberWalletDomain struct {
-	memberWalletRepo repo.MemberWalletRepo
-	transaction      tran.Transaction
-	marketRpc        mclient.Market
-	redisCache       cache.Cache
+	memberWalletRepo      repo.MemberWalletRepo
+	memberTransactionRepo repo.MemberTransactionRepo
+	memberRepo            repo.MemberRepo
+	commissionRepo        repo.MemberCommissionRepo
+	ledgerDomain          *LedgerDomain
+	processedEventRepo    repo.ProcessedEventRepo
+	transaction           tran.Transaction
+	marketRpc             mclient.Market
+	redisCache            cache.Cache
 }
 
 func NewMemberWalletDomain(db *msdb.MsDB, marketRpc mclient.Market, redisCache cache.Cache) *MemberWalletDomain {
 	return &MemberWalletDomain{
-		memberWalletRepo: dao.NewMemberWalletDao(db),
-		transaction:      tran.NewTransaction(db.Conn),
-		marketRpc:        marketRpc,
-		redisCache:       redisCache,
+		memberWalletRepo:      dao.NewMemberWalletDao(db),
+		memberTransactionRepo: dao.NewMemberTransactionDao(db),
+		memberRepo:            dao.NewMemberDao(db),
+		commissionRepo:        dao.NewMemberCommissionDao(db),
+		ledgerDomain:          NewLedgerDomain(db),
+		processedEventRepo:    dao.NewProcessedEventDao(db),
+		transaction:           tran.NewTransaction(db.Conn),
+		marketRpc:             marketRpc,
+		redisCache:            redisCache,
 	}
 }
 
-func (m *MemberWalletDomain) Freeze(ctx context.Context, conn msdb.DbConn, userId int64, money float64, symbol string) error {
-
-	// 获取钱包信息
-	mw, err := m.memberWalletRepo.FindByIdAndCoinName(ctx, userId, symbol)
+// Freeze 冻结 从可用转到冻结 refId是订单号或者提现记录id
+func (m *MemberWalletDomain) Freeze(ctx context.Context, conn msdb.DbConn, userId int64, money decimal.Decimal, symbol string, refId string) error {
+	err := m.ledgerDomain.Post(ctx, conn, NewJournal(model.LedgerFreeze, refId).
+		Transfer(symbol, money, Available(userId), Frozen(userId)))
 	if err != nil {
 		logx.Errorf("DOMAIN-Freeze - ERROR: %v", err)
 		return err
 	}
-	if mw.Balance < money {
-		return errors.New("余额不足")
-	}
-	err = m.memberWalletRepo.UpdateFreeze(ctx, conn, userId, symbol, money)
+	return nil
+
+}
+
+// Unfreeze 解冻 冻结的资金还回余额 改单后多冻结的部分
+func (m *MemberWalletDomain) Unfreeze(ctx context.Context, conn msdb.DbConn, userId int64, money decimal.Decimal, symbol string, refId string) error {
+	err := m.ledgerDomain.Post(ctx, conn, NewJournal(model.LedgerUnfreeze, refId).
+		Transfer(symbol, money, Frozen(userId), Available(userId)))
 	if err != nil {
-		logx.Errorf("DOMAIN-Freeze - ERROR: %v", err)
+		logx.Errorf("DOMAIN-Unfreeze - ERROR: %v", err)
 		return err
 	}
 	return nil
-
 }
 
 func (m *MemberWalletDomain) FindByIdAndCoinName(ctx context.Context, memId int64, coinName string, coin *mclient.Coin) (*model.MemberWalletCoin, error) {
@@ -69,12 +83,7 @@ func (m *MemberWalletDomain) FindByIdAndCoinName(ctx context.Context, memId int6
 		}
 		return walletCoint, nil
 	}
-	mwc := &model.MemberWalletCoin{}
-	if err := copier.Copy(mwc, mw); err != nil {
-		return nil, err // 或者适当的错误处理
-	}
-	mwc.Coin = coin
-	return mwc, nil
+	return mw.Copy(coin), nil
 }
 
 func (m *MemberWalletDomain) FindWalletByMemIdAndCoin(ctx context.Context, memId int64, coinName string) (*model.MemberWallet, error) {
@@ -94,20 +103,201 @@ func (d *MemberWalletDomain) FindWalletByMemIdAndCoinId(ctx context.Context, mem
 	return mw, nil
 }
 
-func (d *MemberWalletDomain) UpdateWalletCoinAndBase(ctx context.Context, baseWallet *model.MemberWallet, coinWallet *model.MemberWallet) error {
+// OrderFee 一笔成交一方的手续费
+type OrderFee struct {
+	MemberId       int64           // 平台收手续费的账户
+	Symbol         string          // 手续费币种 买单是币 卖单是钱
+	Fee            decimal.Decimal // 撮合时按成交算的手续费
+	DiscountSymbol string          // 用平台币抵扣时是平台币 为空不抵扣
+	DiscountFee    decimal.Decimal // 抵扣要扣的平台币数量
+	OrderId        string
+	FirstRate      float64 // 一级邀请人返佣比例 按实际付的手续费算
+	SecondRate     float64 // 二级邀请人返佣比例
+}
+
+// Paid 实际付的手续费 抵扣的是平台币
+func (f *OrderFee) Paid() (string, decimal.Decimal) {
+	if f.DiscountSymbol != "" {
+		return f.DiscountSymbol, f.DiscountFee
+	}
+	return f.Symbol, f.Fee
+}
+
+// OrderSettle 订单结束时要释放的冻结 成交的部分已经逐笔结算过了 剩下的冻结还回可用
+type OrderSettle struct {
+	OrderId   string
+	MemberId  int64
+	PaySymbol string          // 冻结的币种 买单是钱 卖单是币
+	Frozen    decimal.Decimal // 这个订单冻结的 OCO转给另一条腿的不算
+	Spent     decimal.Decimal // 成交付出的 逐笔结算时已经从冻结里扣了
+}
+
+// FillSide 一笔成交里一方的资金变动 付出的从冻结里扣 收到的进可用 再扣手续费
+type FillSide struct {
+	MemberId  int64
+	PaySymbol string
+	Spent     decimal.Decimal
+	GetSymbol string
+	Received  decimal.Decimal
+	Fee       *OrderFee
+}
+
+// FirstTime 记下这条消息处理过了 和钱包变动在同一个事务里 已经处理过的返回false
+func (d *MemberWalletDomain) FirstTime(ctx context.Context, conn msdb.DbConn, key string) (bool, error) {
+	first, err := d.processedEventRepo.Save(ctx, conn, model.NewProcessedEvent(key))
+	if err != nil {
+		logx.Errorw("Domain-ProcessedEvent", logx.Field("error", err), logx.Field("key", key))
+		return false, err
+	}
+	if !first {
+		logx.Infof("消息已经处理过了,key=%s", key)
+	}
+	return first, nil
+}
+
+// SettleFill 逐笔结算 买卖双方付出的从冻结转到清算账户 收到的从清算账户转到可用
+// 手续费从可用转到平台账户 抵扣的从平台币钱包转 用户和平台各记一条手续费流水 都在同一个事务里
+// 同一笔成交只结算一次 重复投递的消息直接跳过
+func (d *MemberWalletDomain) SettleFill(ctx context.Context, tradeId string, sides ...*FillSide) error {
+	for _, side := range sides {
+		if err := d.feeWallet(ctx, side); err != nil {
+			return err
+		}
+	}
 	return d.transaction.Action(func(conn msdb.DbConn) error {
-		err := d.memberWalletRepo.UpdateWallet(ctx, conn, baseWallet.Id, baseWallet.Balance, baseWallet.FrozenBalance)
-		if err != nil {
+		first, err := d.FirstTime(ctx, conn, model.FillSettleEvent(tradeId))
+		if err != nil || !first {
 			return err
 		}
-		err = d.memberWalletRepo.UpdateWallet(ctx, conn, coinWallet.Id, coinWallet.Balance, coinWallet.FrozenBalance)
-		if err != nil {
+		var journals []*Journal
+		for _, side := range sides {
+			journals = append(journals, NewJournal(model.LedgerTrade, tradeId).
+				Transfer(side.PaySymbol, side.Spent, Frozen(side.MemberId), Clearing).
+				Transfer(side.GetSymbol, side.Received, Clearing, Available(side.MemberId)))
+			if side.Fee.Fee.Sign() > 0 {
+				// 平台币查余额之后可能又花掉了 不够记账会报错 重新结算时会按正常收
+				symbol, paid := side.Fee.Paid()
+				journals = append(journals, NewJournal(model.LedgerFee, tradeId).
+					Transfer(symbol, paid, Available(side.MemberId), Available(side.Fee.MemberId)))
+			}
+		}
+		if err := d.ledgerDomain.Post(ctx, conn, journals...); err != nil {
 			return err
 		}
+		now := time.Now().UnixMilli()
+		for _, side := range sides {
+			if err := d.saveFee(ctx, conn, side.MemberId, side.Fee, now); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
+// feeWallet 平台收手续费的钱包 没有的照付手续费的用户的钱包建一个 币种一样
+// 平台账户不会事先给每个币种都建好钱包 没有钱包记不了账
+func (d *MemberWalletDomain) feeWallet(ctx context.Context, side *FillSide) error {
+	if side.Fee.Fee.Sign() <= 0 {
+		return nil
+	}
+	symbol, _ := side.Fee.Paid()
+	mw, err := d.memberWalletRepo.FindByIdAndCoinName(ctx, side.Fee.MemberId, symbol)
+	if err != nil || mw != nil {
+		return err
+	}
+	payer, err := d.memberWalletRepo.FindByIdAndCoinName(ctx, side.MemberId, symbol)
+	if err != nil {
+		return err
+	}
+	if payer == nil {
+		return fmt.Errorf("钱包不存在,memberId=%d,symbol=%s", side.MemberId, symbol)
+	}
+	err = d.memberWalletRepo.Save(ctx, &model.MemberWallet{MemberId: side.Fee.MemberId, CoinId: payer.CoinId, CoinName: payer.CoinName})
+	if err != nil {
+		logx.Errorf("DOMAIN-FeeWallet - ERROR: %v", err)
+	}
+	return err
+}
+
+// ReleaseOrder 订单完成或者撤单 没用完的冻结还回可用 同一个订单只释放一次
+func (d *MemberWalletDomain) ReleaseOrder(ctx context.Context, settle *OrderSettle) error {
+	return d.transaction.Action(func(conn msdb.DbConn) error {
+		first, err := d.FirstTime(ctx, conn, model.OrderSettleEvent(settle.OrderId))
+		if err != nil || !first {
+			return err
+		}
+		return d.ledgerDomain.Post(ctx, conn, NewJournal(model.LedgerUnfreeze, settle.OrderId).
+			Transfer(settle.PaySymbol, settle.Frozen.Sub(settle.Spent), Frozen(settle.MemberId), Available(settle.MemberId)))
+	})
+}
+
+// saveFee 用户和平台各记一条手续费流水 再按实际付的手续费记邀请返佣
+// Fee 是按成交算的手续费 DiscountFee 是抵扣用的平台币 RealFee 是实际付的
+func (d *MemberWalletDomain) saveFee(ctx context.Context, conn msdb.DbConn, memberId int64, fee *OrderFee, now int64) error {
+	if fee.Fee.Sign() <= 0 {
+		return nil
+	}
+	symbol, paid := fee.Paid()
+	discountFee := "0"
+	if fee.DiscountSymbol != "" {
+		discountFee = fee.DiscountFee.String()
+	}
+	for _, mt := range []*model.MemberTransaction{
+		{MemberId: memberId, Amount: paid.Neg().Float64(), Fee: fee.Fee.Float64(), DiscountFee: discountFee, RealFee: paid.String(), Symbol: symbol, Type: model.EXCHANGE_FEE, CreateTime: now},
+		{MemberId: fee.MemberId, Amount: paid.Float64(), Fee: fee.Fee.Float64(), DiscountFee: discountFee, RealFee: paid.String(), Symbol: symbol, Type: model.EXCHANGE_FEE, CreateTime: now},
+	} {
+		if err := d.memberTransactionRepo.SaveTx(ctx, conn, mt); err != nil {
+			return err
+		}
+	}
+	return d.saveCommission(ctx, conn, memberId, fee, symbol, paid, now)
+}
+
+// saveCommission 付手续费的会员有邀请人的 按比例记待发放的返佣 jobcenter定时从平台账户转给邀请人
+func (d *MemberWalletDomain) saveCommission(ctx context.Context, conn msdb.DbConn, memberId int64, fee *OrderFee, symbol string, paid decimal.Decimal, now int64) error {
+	if fee.FirstRate <= 0 && fee.SecondRate <= 0 {
+		return nil
+	}
+	mem, err := d.memberRepo.FindMemberById(ctx, memberId)
+	if err != nil {
+		return err
+	}
+	if mem == nil {
+		return nil
+	}
+	for _, c := range []struct {
+		inviterId int64
+		level     int
+		rate      float64
+	}{
+		{mem.InviterId, model.CommissionFirst, fee.FirstRate},
+		{mem.InviterParentId, model.CommissionSecond, fee.SecondRate},
+	} {
+		if c.inviterId <= 0 || c.rate <= 0 {
+			continue
+		}
+		amount := paid.Mul(decimal.NewFromFloat(c.rate)).Truncate(8)
+		if amount.Sign() <= 0 {
+			continue
+		}
+		err := d.commissionRepo.SaveTx(ctx, conn, &model.MemberCommission{
+			MemberId:     c.inviterId,
+			FromMemberId: memberId,
+			Level:        c.level,
+			OrderId:      fee.OrderId,
+			Symbol:       symbol,
+			Fee:          paid,
+			Amount:       amount,
+			Status:       model.CommissionPending,
+			CreateTime:   now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *MemberWalletDomain) FindWallet(ctx context.Context, userId int64) (list []*model.MemberWalletCoin, err error) {
 	memberWallets, err := d.memberWalletRepo.FindByMemberId(ctx, userId)
 	if err != nil {
@@ -156,7 +346,6 @@ func (d *MemberWalletDomain) GetAllAddress(ctx context.Context, coinName string)
 	return d.memberWalletRepo.FindAllAddress(ctx, coinName)
 }
 
-
 func (d *MemberWalletDomain) FindByAddress(ctx context.Context, address string) (*model.MemberWallet, error) {
 	return d.memberWalletRepo.FindByAddress(ctx, address)
-}
\ No newline at end of file
+}
@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"testing"
+	"ucenter/internal/model"
+	"ucenter/internal/repo"
+)
+
+type memTransactionRepo struct {
+	repo.MemberTransactionRepo
+	list []*model.MemberTransaction
+}
+
+func (r *memTransactionRepo) SaveTx(ctx context.Context, conn msdb.DbConn, mt *model.MemberTransaction) error {
+	r.list = append(r.list, mt)
+	return nil
+}
+
+const platformId = 99
+
+// newSettleWallets 买家1用USDT买 卖家2卖BTC 下单时已经冻结 平台99收手续费
+func newSettleWallets() (*memStore, *MemberWalletDomain) {
+	s := newMemStore()
+	s.addWallet(1, "USDT", "800", "200")
+	s.addWallet(1, "BTC", "0", "0")
+	s.addWallet(2, "BTC", "8.5", "1.5")
+	s.addWallet(2, "USDT", "0", "0")
+	s.addWallet(platformId, "BTC", "0", "0")
+	s.addWallet(platformId, "USDT", "0", "0")
+	d := &MemberWalletDomain{
+		memberWalletRepo:      &memWalletRepo{s: s},
+		memberTransactionRepo: &memTransactionRepo{},
+		ledgerDomain:          newTestLedger(s),
+		processedEventRepo:    &memProcessedRepo{s: s},
+		transaction:           s,
+	}
+	return s, d
+}
+
+// 1 BTC 成交价 100 USDT 买家收币付0.001 BTC手续费 卖家收钱付0.1 USDT手续费
+func settleFill(d *MemberWalletDomain) error {
+	return d.SettleFill(context.Background(), "t1",
+		&FillSide{MemberId: 1, PaySymbol: "USDT", Spent: dec("100"), GetSymbol: "BTC", Received: dec("1"),
+			Fee: &OrderFee{MemberId: platformId, Symbol: "BTC", Fee: dec("0.001"), OrderId: "b1"}},
+		&FillSide{MemberId: 2, PaySymbol: "BTC", Spent: dec("1"), GetSymbol: "USDT", Received: dec("100"),
+			Fee: &OrderFee{MemberId: platformId, Symbol: "USDT", Fee: dec("0.1"), OrderId: "s1"}},
+	)
+}
+
+// 两个订单都结束了 买单冻结200用了100 卖单冻结1.5用了1
+func releaseOrders(d *MemberWalletDomain) error {
+	for _, settle := range []*OrderSettle{
+		{OrderId: "b1", MemberId: 1, PaySymbol: "USDT", Frozen: dec("200"), Spent: dec("100")},
+		{OrderId: "s1", MemberId: 2, PaySymbol: "BTC", Frozen: dec("1.5"), Spent: dec("1")},
+	} {
+		if err := d.ReleaseOrder(context.Background(), settle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walletBalances(s *memStore) map[string][2]string {
+	out := make(map[string][2]string)
+	for key, mw := range s.wallets {
+		out[key] = [2]string{mw.Balance.String(), mw.FrozenBalance.String()}
+	}
+	return out
+}
+
+// 订单结束的消息可能比最后一笔成交先到 先结算后释放和先释放后结算 余额要一样
+func TestSettleAndReleaseCommute(t *testing.T) {
+	orders := []struct {
+		name  string
+		steps []func(*MemberWalletDomain) error
+	}{
+		{"settle first", []func(*MemberWalletDomain) error{settleFill, releaseOrders}},
+		{"release first", []func(*MemberWalletDomain) error{releaseOrders, settleFill}},
+	}
+	var results []map[string][2]string
+	for _, o := range orders {
+		s, d := newSettleWallets()
+		for _, step := range o.steps {
+			if err := step(d); err != nil {
+				t.Fatalf("%s: %v", o.name, err)
+			}
+		}
+		checkBalanced(t, s)
+		results = append(results, walletBalances(s))
+	}
+	want := map[string][2]string{
+		walletKeyOf(1, "USDT"):          {"900", "0"},
+		walletKeyOf(1, "BTC"):           {"0.999", "0"},
+		walletKeyOf(2, "BTC"):           {"9", "0"},
+		walletKeyOf(2, "USDT"):          {"99.9", "0"},
+		walletKeyOf(platformId, "BTC"):  {"0.001", "0"},
+		walletKeyOf(platformId, "USDT"): {"0.1", "0"},
+	}
+	for i, got := range results {
+		for key, w := range want {
+			g := got[key]
+			if !dec(g[0]).Equal(dec(w[0])) || !dec(g[1]).Equal(dec(w[1])) {
+				t.Fatalf("%s: wallet %s = %v, want %v", orders[i].name, key, g, w)
+			}
+		}
+	}
+}
+
+// 重复投递的成交和订单结束消息不能再记一次
+func TestSettleAndReleaseRedelivered(t *testing.T) {
+	s, d := newSettleWallets()
+	if err := settleFill(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseOrders(d); err != nil {
+		t.Fatal(err)
+	}
+	before, lines := walletBalances(s), len(s.ledger)
+	if err := settleFill(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := releaseOrders(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ledger) != lines {
+		t.Fatalf("redelivery posted %d more ledger lines", len(s.ledger)-lines)
+	}
+	for key, b := range walletBalances(s) {
+		if b != before[key] {
+			t.Fatalf("redelivery changed wallet %s from %v to %v", key, before[key], b)
+		}
+	}
+	if n := len(d.memberTransactionRepo.(*memTransactionRepo).list); n != 4 {
+		t.Fatalf("fee transactions = %d, want 4", n)
+	}
+}
+
+// 平台账户没有手续费币种的钱包 结算时照付手续费的用户的钱包建一个 不能一直结算失败
+func TestSettleCreatesFeeWallet(t *testing.T) {
+	s, d := newSettleWallets()
+	delete(s.wallets, walletKeyOf(platformId, "BTC"))
+	delete(s.wallets, walletKeyOf(platformId, "USDT"))
+	if err := settleFill(d); err != nil {
+		t.Fatal(err)
+	}
+	checkBalanced(t, s)
+	for symbol, fee := range map[string]string{"BTC": "0.001", "USDT": "0.1"} {
+		mw := s.wallet(platformId, symbol)
+		if mw == nil || !mw.Balance.Equal(dec(fee)) {
+			t.Fatalf("platform %s wallet %+v, want balance %s", symbol, mw, fee)
+		}
+		if mw.CoinId != s.wallet(1, symbol).CoinId {
+			t.Fatalf("platform %s wallet coin id %d, want %d", symbol, mw.CoinId, s.wallet(1, symbol).CoinId)
+		}
+	}
+}
@@ -3,11 +3,14 @@ package domain
 import (
 	"context"
 	"errors"
+	"fmt"
 	"grpc-common/market/mclient"
 	"grpc-common/market/types/market"
 	"log"
 	"mscoin-common/btc"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/tran"
 	"mscoin-common/op"
 	"time"
 	"ucenter/internal/dao"
@@ -18,6 +21,8 @@ import (
 type WithdrawDomain struct {
 	withdrawRecordRepo repo.WithdrawRecordRepo
 	memberWalletDomain *MemberWalletDomain
+	ledgerDomain       *LedgerDomain
+	transaction        tran.Transaction
 	marketRpc          mclient.Market
 	BitCoinAddress     string
 }
@@ -29,13 +34,15 @@ func NewWithdrawDomain(
 	return &WithdrawDomain{
 		withdrawRecordRepo: dao.NewWithdrawRecordDao(db),
 		memberWalletDomain: NewMemberWalletDomain(db, nil, nil),
+		ledgerDomain:       NewLedgerDomain(db),
+		transaction:        tran.NewTransaction(db.Conn),
 		marketRpc:          marketRpc,
 		BitCoinAddress:     BitCoinAddress,
 	}
 }
 
-func (d *WithdrawDomain) SaveRecord(ctx context.Context, record *model.WithdrawRecord) error {
-	return d.withdrawRecordRepo.Save(ctx, record)
+func (d *WithdrawDomain) SaveRecord(ctx context.Context, conn msdb.DbConn, record *model.WithdrawRecord) error {
+	return d.withdrawRecordRepo.Save(ctx, conn, record)
 }
 
 func (d *WithdrawDomain) Withdraw(ctx context.Context, wr model.WithdrawRecord) error {
@@ -57,7 +64,15 @@ func (d *WithdrawDomain) Withdraw(ctx context.Context, wr model.WithdrawRecord)
 	wr.TransactionNumber = txId
 	wr.Status = 3
 	wr.DealTime = time.Now().UnixMilli()
-	err = d.withdrawRecordRepo.UpdateSuccess(ctx, wr)
+	// 冻结的提现金额转到链上账户 和提现记录的状态一起提交
+	err = d.transaction.Action(func(conn msdb.DbConn) error {
+		err := d.withdrawRecordRepo.UpdateSuccess(ctx, conn, wr)
+		if err != nil {
+			return err
+		}
+		return d.ledgerDomain.Post(ctx, conn, NewJournal(model.LedgerWithdraw, fmt.Sprintf("%d", wr.Id)).
+			Transfer(memberWallet.CoinName, decimal.NewFromFloat(wr.TotalAmount), Frozen(wr.MemberId), External))
+	})
 	if err != nil {
 		//TODO 如果报错，需要记录日志 要进行恢复
 		log.Println(err)
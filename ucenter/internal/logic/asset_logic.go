@@ -21,6 +21,7 @@ type AssetLogic struct {
 	MemberDomain       *domain.MemberDomain
 	memberWalletDomain *domain.MemberWalletDomain
 	MemberTransactionDomain *domain.MemberTransactionDomain
+	ledgerDomain       *domain.LedgerDomain
 }
 
 func NewAssetLogic(ctx context.Context, svcCtx *svc.ServiceContext) *AssetLogic {
@@ -32,6 +33,7 @@ func NewAssetLogic(ctx context.Context, svcCtx *svc.ServiceContext) *AssetLogic
 		MemberDomain:       domain.NewMemberDomain(svcCtx.Db),
 		memberWalletDomain: domain.NewMemberWalletDomain(svcCtx.Db, svcCtx.MarketRpc, svcCtx.Cache),
 		MemberTransactionDomain: domain.NewMemberTransactionDomain(svcCtx.Db),
+		ledgerDomain:       domain.NewLedgerDomain(svcCtx.Db),
 	}
 }
 
@@ -120,3 +122,37 @@ func (l *AssetLogic) FindTransaction(in *asset.AssetReq) (*asset.MemberTransacti
 		Total: total,
 	}, nil
 }
+
+// FindLedger 资金分录 分页查询
+func (l *AssetLogic) FindLedger(in *asset.AssetReq) (*asset.MemberLedgerList, error) {
+	voList, total, err := l.ledgerDomain.FindLedger(
+		l.ctx,
+		in.UserId,
+		in.Symbol,
+		in.Type,
+		in.StartTime,
+		in.EndTime,
+		in.PageNo,
+		in.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var list []*asset.MemberLedger
+	copier.Copy(&list, voList)
+	return &asset.MemberLedgerList{
+		List:  list,
+		Total: total,
+	}, nil
+}
+
+// FindStatement 一个币种可用或者冻结账户的对账单
+func (l *AssetLogic) FindStatement(in *asset.AssetReq) (*asset.LedgerStatement, error) {
+	statement, err := l.ledgerDomain.Statement(l.ctx, in.UserId, in.Symbol, in.Account, in.StartTime, in.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	resp := &asset.LedgerStatement{}
+	copier.Copy(resp, statement)
+	return resp, nil
+}
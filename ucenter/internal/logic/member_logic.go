@@ -4,6 +4,7 @@ import (
 	"context"
 	"grpc-common/ucenter/types/member"
 	"ucenter/internal/domain"
+	"ucenter/internal/model"
 	"ucenter/internal/svc"
 
 	"github.com/jinzhu/copier"
@@ -14,15 +15,19 @@ type MemberLogic struct {
 	ctx    context.Context
 	svcCtx *svc.ServiceContext
 	logx.Logger
-	memberDomain *domain.MemberDomain
+	memberDomain     *domain.MemberDomain
+	feeTierDomain    *domain.FeeTierDomain
+	commissionDomain *domain.CommissionDomain
 }
 
 func NewMemberLogic(ctx context.Context, svcCtx *svc.ServiceContext) *MemberLogic {
 	return &MemberLogic{
-		ctx:          ctx,
-		svcCtx:       svcCtx,
-		Logger:       logx.WithContext(ctx),
-		memberDomain: domain.NewMemberDomain(svcCtx.Db),
+		ctx:              ctx,
+		svcCtx:           svcCtx,
+		Logger:           logx.WithContext(ctx),
+		memberDomain:     domain.NewMemberDomain(svcCtx.Db),
+		feeTierDomain:    domain.NewFeeTierDomain(svcCtx.Db),
+		commissionDomain: domain.NewCommissionDomain(svcCtx.Db),
 	}
 }
 
@@ -38,6 +43,70 @@ func (l *MemberLogic) FindMemberById(in *member.MemberReq) (*member.MemberInfo,
 		logx.Errorw("MemberLogic-FindMemberById-Copy-ERROR", logx.Field("err", err))
 		return nil, err
 	}
+	// 手续费等级的费率 下单时记到订单上
+	tier, err := l.feeTierDomain.FindByLevel(l.ctx, mem.FeeTier)
+	if err != nil {
+		return nil, err
+	}
+	if tier == nil {
+		resp.FeeTier = 0
+	} else {
+		resp.MakerFee = tier.MakerFee
+		resp.TakerFee = tier.TakerFee
+	}
 	return resp, nil
 
 }
+
+// RefreshFeeTier jobcenter每天算好30天成交额 这里重新计算所有会员的手续费等级
+func (l *MemberLogic) RefreshFeeTier(in *member.FeeTierReq) (*member.FeeTierRes, error) {
+	volumes := make(map[int64]float64, len(in.List))
+	for _, v := range in.List {
+		volumes[v.MemberId] += v.Volume
+	}
+	err := l.feeTierDomain.Refresh(l.ctx, volumes)
+	if err != nil {
+		return nil, err
+	}
+	return &member.FeeTierRes{Total: int64(len(volumes))}, nil
+}
+
+// PayCommission jobcenter定时调用 把待发放的返佣从平台手续费账户转给邀请人
+func (l *MemberLogic) PayCommission(in *member.CommissionReq) (*member.CommissionRes, error) {
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = l.svcCtx.Config.Exchange.CommissionBatch
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+	total, err := l.commissionDomain.Pay(l.ctx, l.svcCtx.Config.Exchange.FeeMemberId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &member.CommissionRes{Total: total}, nil
+}
+
+// FindCommission 邀请返佣 按币种分已发放和待发放 还有邀请的人数
+func (l *MemberLogic) FindCommission(in *member.MemberReq) (*member.CommissionInfo, error) {
+	sums, first, second, err := l.commissionDomain.Summary(l.ctx, in.MemberId)
+	if err != nil {
+		return nil, err
+	}
+	resp := &member.CommissionInfo{FirstCount: first, SecondCount: second}
+	amounts := make(map[string]*member.CommissionAmount)
+	for _, s := range sums {
+		amount, ok := amounts[s.Symbol]
+		if !ok {
+			amount = &member.CommissionAmount{Symbol: s.Symbol}
+			amounts[s.Symbol] = amount
+			resp.List = append(resp.List, amount)
+		}
+		if s.Status == model.CommissionPaid {
+			amount.Paid += s.Amount
+		} else {
+			amount.Pending += s.Amount
+		}
+	}
+	return resp, nil
+}
@@ -6,11 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"grpc-common/ucenter/types/withdraw"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
 	"mscoin-common/msdb/tran"
 	"mscoin-common/op"
 	"time"
-	"ucenter/internal/database"
 	"ucenter/internal/domain"
 	"ucenter/internal/model"
 	"ucenter/internal/svc"
@@ -90,17 +91,13 @@ func (l *WithdrawLogic) WithdrawCode(req *withdraw.WithdrawReq) (*withdraw.NoRes
 	if memberWallet == nil {
 		return nil, errors.New("钱包不存在")
 	}
-	if memberWallet.Balance < req.Amount {
+	amount := decimal.NewFromFloat(req.Amount)
+	if memberWallet.Balance.LessThan(amount) {
 		return nil, errors.New("余额不足")
 	}
 	err = l.transaction.Action(func(conn msdb.DbConn) error {
 		//事务处理
-		//4. 冻结用户的钱 提现币 经过比特币网络 需要时间
-		err2 := l.memberWalletDomain.Freeze(l.ctx, conn, req.UserId, req.Amount, req.Unit)
-		if err2 != nil {
-			return err2
-		}
-		//5. 记录用户的提现
+		//4. 记录用户的提现
 		wr := &model.WithdrawRecord{}
 		wr.CoinId = memberWallet.CoinId
 		wr.Address = req.Address
@@ -116,29 +113,18 @@ func (l *WithdrawLogic) WithdrawCode(req *withdraw.WithdrawReq) (*withdraw.NoRes
 		wr.MemberId = req.UserId
 		wr.TransactionNumber = "" //目前还没有交易编号
 		var err error
-		err = l.withdrawDomain.SaveRecord(l.ctx, wr)
+		err = l.withdrawDomain.SaveRecord(l.ctx, conn, wr)
 		if err != nil {
 			return err
 		}
-		// 6. 发送用户的提现事件到MQ当中 MQ消费者去处理提现（创建交易 广播到比特币的网络）
-		marshaled, _ := json.Marshal(wr)
-		data := database.KafkaData{
-			Topic: "withdraw",
-			Data:  marshaled,
-			Key:   []byte(fmt.Sprintf("%d", req.UserId)),
-		}
-		for i := 0; i < 3; i++ {
-			err = l.svcCtx.KafkaCli.SendSync(data)
-			if err != nil {
-				time.Sleep(time.Second * 1)
-				continue
-			}
-			break
-		}
+		//5. 冻结用户的钱 提现币 经过比特币网络 需要时间 分录记提现记录的id
+		err = l.memberWalletDomain.Freeze(l.ctx, conn, req.UserId, amount, req.Unit, fmt.Sprintf("%d", wr.Id))
 		if err != nil {
 			return err
 		}
-		return nil
+		// 6. 提现事件写进outbox 和冻结一起提交 提交以后发到MQ MQ消费者去处理提现（创建交易 广播到比特币的网络）
+		marshaled, _ := json.Marshal(wr)
+		return outbox.Save(l.ctx, conn, "withdraw", fmt.Sprintf("%d", req.UserId), marshaled)
 	})
 	if err != nil {
 		return nil, err
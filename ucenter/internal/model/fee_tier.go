@@ -0,0 +1,15 @@
+package model
+
+// FeeTier 手续费等级 会员等级达到 VipLevel 或者30天成交额达到 MinVolume 就算这个等级 取满足条件的最高等级
+type FeeTier struct {
+	Id        int64   `gorm:"column:id"`
+	Level     int64   `gorm:"column:level"`      // 手续费等级 从1开始 越大费率越低
+	VipLevel  int64   `gorm:"column:vip_level"`  // 会员等级 对应 member.member_grade_id
+	MinVolume float64 `gorm:"column:min_volume"` // 30天成交额 按USDT算
+	MakerFee  float64 `gorm:"column:maker_fee"`  // 挂单费率
+	TakerFee  float64 `gorm:"column:taker_fee"`  // 吃单费率
+}
+
+func (*FeeTier) TableName() string {
+	return "exchange_fee_tier"
+}
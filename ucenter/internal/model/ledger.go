@@ -0,0 +1,121 @@
+package model
+
+import (
+	"mscoin-common/decimal"
+	"mscoin-common/enum"
+	"mscoin-common/tools"
+)
+
+// MemberLedger 资金分录 钱包的每次变动都记一组借贷相等的分录 同一组的 JournalId 相同
+// 用户账户贷方增加借方减少 Balance 是记完这条以后这个账户的余额 系统账户不记余额
+type MemberLedger struct {
+	Id         int64           `gorm:"column:id"`
+	JournalId  string          `gorm:"column:journal_id"`
+	Type       int             `gorm:"column:type"`
+	RefId      string          `gorm:"column:ref_id"` // 订单号 提现记录id 充值流水id 返佣id
+	MemberId   int64           `gorm:"column:member_id"`
+	Symbol     string          `gorm:"column:symbol"`
+	Account    int             `gorm:"column:account"`
+	Direction  int             `gorm:"column:direction"`
+	Amount     decimal.Decimal `gorm:"column:amount"`
+	Balance    decimal.Decimal `gorm:"column:balance"`
+	CreateTime int64           `gorm:"column:create_time"`
+}
+
+func (*MemberLedger) TableName() string {
+	return "member_ledger"
+}
+
+// 账户 可用和冻结是用户钱包的两个余额 清算和外部是系统账户 member_id为0
+const (
+	AccountAvailable = iota // 可用余额
+	AccountFrozen           // 冻结余额
+	AccountClearing         // 撮合清算 成交时付出的进这里 收到的从这里出
+	AccountExternal         // 链上 充值从这里进 提现到这里
+)
+
+var AccountMap = enum.Enum{
+	AccountAvailable: "AVAILABLE",
+	AccountFrozen:    "FROZEN",
+	AccountClearing:  "CLEARING",
+	AccountExternal:  "EXTERNAL",
+}
+
+const (
+	Debit  = iota // 借 用户账户减少
+	Credit        // 贷 用户账户增加
+)
+
+var DirectionMap = enum.Enum{
+	Debit:  "DEBIT",
+	Credit: "CREDIT",
+}
+
+const (
+	LedgerFreeze     = iota // 冻结
+	LedgerUnfreeze          // 解冻
+	LedgerTrade             // 成交 付出和收到
+	LedgerFee               // 手续费
+	LedgerDeposit           // 充值
+	LedgerWithdraw          // 提现
+	LedgerCommission        // 邀请返佣
+)
+
+var LedgerTypeMap = enum.Enum{
+	LedgerFreeze:     "FREEZE",
+	LedgerUnfreeze:   "UNFREEZE",
+	LedgerTrade:      "TRADE",
+	LedgerFee:        "FEE",
+	LedgerDeposit:    "DEPOSIT",
+	LedgerWithdraw:   "WITHDRAW",
+	LedgerCommission: "COMMISSION",
+}
+
+// Signed 对用户账户余额的影响 贷为正借为负
+func (l *MemberLedger) Signed() decimal.Decimal {
+	if l.Direction == Debit {
+		return l.Amount.Neg()
+	}
+	return l.Amount
+}
+
+type MemberLedgerVo struct {
+	Id         int64   `json:"id"`
+	JournalId  string  `json:"journalId"`
+	Type       string  `json:"type"`
+	RefId      string  `json:"refId"`
+	Symbol     string  `json:"symbol"`
+	Account    string  `json:"account"`
+	Direction  string  `json:"direction"`
+	Amount     float64 `json:"amount"`
+	Balance    float64 `json:"balance"`
+	CreateTime string  `json:"createTime"`
+}
+
+func (l *MemberLedger) ToVo() *MemberLedgerVo {
+	return &MemberLedgerVo{
+		Id:         l.Id,
+		JournalId:  l.JournalId,
+		Type:       LedgerTypeMap.Value(l.Type),
+		RefId:      l.RefId,
+		Symbol:     l.Symbol,
+		Account:    AccountMap.Value(l.Account),
+		Direction:  DirectionMap.Value(l.Direction),
+		Amount:     l.Amount.Float64(),
+		Balance:    l.Balance.Float64(),
+		CreateTime: tools.ToTimeString(l.CreateTime),
+	}
+}
+
+// LedgerStatement 一个账户一段时间的对账单 期初加上贷方减去借方等于期末
+type LedgerStatement struct {
+	Symbol    string            `json:"symbol"`
+	Account   string            `json:"account"`
+	StartTime string            `json:"startTime"`
+	EndTime   string            `json:"endTime"`
+	Opening   float64           `json:"opening"`
+	Debit     float64           `json:"debit"`
+	Credit    float64           `json:"credit"`
+	Closing   float64           `json:"closing"`
+	List      []*MemberLedgerVo `json:"list"`
+}
@@ -65,6 +65,8 @@ type Member struct {
 	TeamLevel                  int64   `gorm:"column:team_level"` // 团队人数(每日维护)
 	TeamPower                  float64 `gorm:"column:team_power"` // 团队矿机算力(每日维护)
 	MemberLevelId              int64   `gorm:"column:member_level_id"`
+	FeeTier                    int64   `gorm:"column:fee_tier"`     // 手续费等级 0没有等级 按交易对的费率(每日维护)
+	TradeVolume                float64 `gorm:"column:trade_volume"` // 30天成交额 按USDT算(每日维护)
 }
 
 func (*Member) TableName() string {
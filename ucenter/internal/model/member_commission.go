@@ -0,0 +1,44 @@
+package model
+
+import "mscoin-common/decimal"
+
+// MemberCommission 邀请返佣 被邀请的会员付了手续费 按比例记给一级和二级邀请人
+// 结算时先记成待发放 jobcenter定时从平台手续费账户批量转给邀请人
+type MemberCommission struct {
+	Id           int64           `gorm:"column:id"`
+	MemberId     int64           `gorm:"column:member_id"`      // 拿返佣的邀请人
+	FromMemberId int64           `gorm:"column:from_member_id"` // 付手续费的被邀请人
+	Level        int             `gorm:"column:level"`          // 1 直接邀请 2 间接邀请
+	OrderId      string          `gorm:"column:order_id"`
+	Symbol       string          `gorm:"column:symbol"` // 手续费币种 抵扣的是平台币
+	Fee          decimal.Decimal `gorm:"column:fee"`    // 被邀请人实际付的手续费
+	Amount       decimal.Decimal `gorm:"column:amount"` // 返佣数量
+	Status       int             `gorm:"column:status"`
+	Retries      int             `gorm:"column:retries"`    // 发放失败的次数
+	RetryTime    int64           `gorm:"column:retry_time"` // 发放失败以后 这个时间之前不再发
+	CreateTime   int64           `gorm:"column:create_time"`
+	PayTime      int64           `gorm:"column:pay_time"`
+}
+
+func (*MemberCommission) TableName() string {
+	return "member_commission"
+}
+
+const (
+	CommissionPending = iota // 待发放
+	CommissionPaid           // 已发放
+	CommissionFailed         // 重试次数用完了 不再自动发放 人工处理
+)
+
+const (
+	CommissionFirst  = 1 // 一级邀请人
+	CommissionSecond = 2 // 二级邀请人
+)
+
+// CommissionSum 按邀请人和币种汇总的返佣
+type CommissionSum struct {
+	MemberId int64   `gorm:"column:member_id"`
+	Symbol   string  `gorm:"column:symbol"`
+	Status   int     `gorm:"column:status"`
+	Amount   float64 `gorm:"column:amount"`
+}
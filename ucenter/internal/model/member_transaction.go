@@ -25,18 +25,21 @@ func (*MemberTransaction) TableName() string {
 }
 
 const (
-	RECHARGE          = iota // 充值
-	WITHDRAW                 // 提现
-	TRANSFER_ACCOUNTS        //转账
-	EXCHANGE                 //币币交易
-
+	RECHARGE           = iota // 充值
+	WITHDRAW                  // 提现
+	TRANSFER_ACCOUNTS         //转账
+	EXCHANGE                  //币币交易
+	EXCHANGE_FEE              //币币交易手续费
+	EXCHANGE_PROMOTION        //币币交易邀请返佣
 )
 
 var TypeMap = enum.Enum{
-	RECHARGE:          "RECHARGE",
-	WITHDRAW:          "WITHDRAW",
-	TRANSFER_ACCOUNTS: "TRANSFER_ACCOUNTS",
-	EXCHANGE:          "EXCHANGE",
+	RECHARGE:           "RECHARGE",
+	WITHDRAW:           "WITHDRAW",
+	TRANSFER_ACCOUNTS:  "TRANSFER_ACCOUNTS",
+	EXCHANGE:           "EXCHANGE",
+	EXCHANGE_FEE:       "EXCHANGE_FEE",
+	EXCHANGE_PROMOTION: "EXCHANGE_PROMOTION",
 }
 
 type MemberTransactionVo struct {
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// ProcessedEvent 处理过的消息 event_key 有唯一索引 和钱包变动在同一个事务里写
+// 重复投递的消息插不进去 说明已经处理过了 直接跳过
+type ProcessedEvent struct {
+	Id         int64  `gorm:"column:id"`
+	EventKey   string `gorm:"column:event_key"`
+	CreateTime int64  `gorm:"column:create_time"`
+}
+
+func (*ProcessedEvent) TableName() string {
+	return "processed_event"
+}
+
+func NewProcessedEvent(key string) *ProcessedEvent {
+	return &ProcessedEvent{EventKey: key, CreateTime: time.Now().UnixMilli()}
+}
+
+// OrderFreezeEvent 下单冻结 一个订单只冻结一次
+func OrderFreezeEvent(orderId string) string {
+	return "ORDER_FREEZE::" + orderId
+}
+
+// OrderSettleEvent 订单结束释放剩下的冻结 一个订单只释放一次
+func OrderSettleEvent(orderId string) string {
+	return "ORDER_SETTLE::" + orderId
+}
+
+// AmendFreezeEvent 改单多冻结 一次改单只冻结一次
+func AmendFreezeEvent(amendId string) string {
+	return "AMEND_FREEZE::" + amendId
+}
+
+// AmendReleaseEvent 改单完成解冻 一次改单只解冻一次
+func AmendReleaseEvent(amendId string) string {
+	return "AMEND_RELEASE::" + amendId
+}
+
+// FillSettleEvent 逐笔结算 一笔成交买卖双方一起结算一次
+func FillSettleEvent(tradeId string) string {
+	return "FILL_SETTLE::" + tradeId
+}
@@ -4,21 +4,22 @@ import (
 	"github.com/jinzhu/copier"
 	"grpc-common/market/mclient"
 	"grpc-common/market/types/market"
+	"mscoin-common/decimal"
 )
 
 type MemberWallet struct {
-	Id                int64   `gorm:"column:id"`
-	Address           string  `gorm:"column:address"`
-	Balance           float64 `gorm:"column:balance"`
-	FrozenBalance     float64 `gorm:"column:frozen_balance"`
-	ReleaseBalance    float64 `gorm:"column:release_balance"`
-	IsLock            int     `gorm:"column:is_lock"`
-	MemberId          int64   `gorm:"column:member_id"`
-	Version           int     `gorm:"column:version"`
-	CoinId            int64   `gorm:"column:coin_id"`
-	ToReleased        float64 `gorm:"column:to_released"`
-	CoinName          string  `gorm:"column:coin_name"`
-	AddressPrivateKey string  `gorm:"address_private_key"`
+	Id                int64           `gorm:"column:id"`
+	Address           string          `gorm:"column:address"`
+	Balance           decimal.Decimal `gorm:"column:balance"`
+	FrozenBalance     decimal.Decimal `gorm:"column:frozen_balance"`
+	ReleaseBalance    decimal.Decimal `gorm:"column:release_balance"`
+	IsLock            int             `gorm:"column:is_lock"`
+	MemberId          int64           `gorm:"column:member_id"`
+	Version           int             `gorm:"column:version"`
+	CoinId            int64           `gorm:"column:coin_id"`
+	ToReleased        decimal.Decimal `gorm:"column:to_released"`
+	CoinName          string          `gorm:"column:coin_name"`
+	AddressPrivateKey string          `gorm:"address_private_key"`
 }
 
 func (*MemberWallet) TableName() string {
@@ -28,6 +29,11 @@ func (*MemberWallet) TableName() string {
 func (w *MemberWallet) Copy(coinInfo *mclient.Coin) *MemberWalletCoin {
 	mc := &MemberWalletCoin{}
 	copier.Copy(mc, w)
+	// 余额是decimal copier不会转换 对外展示转成float64
+	mc.Balance = w.Balance.Float64()
+	mc.FrozenBalance = w.FrozenBalance.Float64()
+	mc.ReleaseBalance = w.ReleaseBalance.Float64()
+	mc.ToReleased = w.ToReleased.Float64()
 	coin := &market.Coin{}
 	copier.Copy(coin, coinInfo)
 	mc.Coin = coin
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"mscoin-common/msdb"
 	"ucenter/internal/model"
 )
 
@@ -17,4 +18,5 @@ type MemberTransactionRepo interface {
 		transactionType string) (list []*model.MemberTransaction, total int64, err error)
 	FindByAmountAndTime(ctx context.Context, address string, value float64, time int64) (*model.MemberTransaction, error)
 	Save(ctx context.Context, transaction *model.MemberTransaction) error
+	SaveTx(ctx context.Context, conn msdb.DbConn, transaction *model.MemberTransaction) error
 }
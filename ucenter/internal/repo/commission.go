@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"ucenter/internal/model"
+)
+
+type MemberCommissionRepo interface {
+	SaveTx(ctx context.Context, conn msdb.DbConn, commission *model.MemberCommission) error
+	FindPending(ctx context.Context, now int64, limit int) ([]*model.MemberCommission, error)
+	UpdatePaid(ctx context.Context, conn msdb.DbConn, ids []int64, payTime int64) (int64, error)
+	UpdateRetry(ctx context.Context, ids []int64, retryTime int64, maxRetries int) error
+	SumByMemberId(ctx context.Context, memberId int64) ([]*model.CommissionSum, error)
+}
@@ -0,0 +1,11 @@
+package repo
+
+import (
+	"context"
+	"ucenter/internal/model"
+)
+
+type FeeTierRepo interface {
+	FindAll(ctx context.Context) ([]*model.FeeTier, error)
+	FindByLevel(ctx context.Context, level int64) (*model.FeeTier, error)
+}
@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"ucenter/internal/model"
+)
+
+type MemberLedgerRepo interface {
+	SaveAll(ctx context.Context, conn msdb.DbConn, list []*model.MemberLedger) error
+	FindLedger(ctx context.Context, memberId int64, symbol string, ledgerType int, startTime int64, endTime int64, pageNo int64, pageSize int64) ([]*model.MemberLedger, int64, error)
+	FindStatement(ctx context.Context, memberId int64, symbol string, account int, startTime int64, endTime int64) ([]*model.MemberLedger, error)
+	FindLastBefore(ctx context.Context, memberId int64, symbol string, account int, time int64) (*model.MemberLedger, error)
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"mscoin-common/msdb"
 	"ucenter/internal/model"
 )
 
@@ -10,5 +11,10 @@ type MemberRepo interface {
 	Save(ctx context.Context, mem *model.Member) error
 	UpdateLoginCount(ctx context.Context, id int64, step int) error
 	FindMemberById(ctx context.Context, memberId int64) (*model.Member, error)
+	ResetFeeTier(ctx context.Context, conn msdb.DbConn) error
+	UpdateTradeVolume(ctx context.Context, conn msdb.DbConn, memberId int64, volume float64) error
+	UpdateFeeTier(ctx context.Context, conn msdb.DbConn, level int64, vipLevel int64, minVolume float64) error
+	FindByPromotionCode(ctx context.Context, code string) (*model.Member, error)
+	CountInvitee(ctx context.Context, memberId int64) (first int64, second int64, err error)
 
 }
@@ -0,0 +1,11 @@
+package repo
+
+import (
+	"context"
+	"mscoin-common/msdb"
+	"ucenter/internal/model"
+)
+
+type ProcessedEventRepo interface {
+	Save(ctx context.Context, conn msdb.DbConn, event *model.ProcessedEvent) (bool, error)
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"mscoin-common/decimal"
 	"mscoin-common/msdb"
 	"ucenter/internal/model"
 )
@@ -9,8 +10,8 @@ import (
 type MemberWalletRepo interface {
 	Save(ctx context.Context, mw *model.MemberWallet) error
 	FindByIdAndCoinName(ctx context.Context, memId int64, coinName string) (mw *model.MemberWallet, err error)
-	UpdateFreeze(ctx context.Context, conn msdb.DbConn, memberId int64, symbol string, money float64) error
-	UpdateWallet(ctx context.Context, conn msdb.DbConn, id int64, balance float64, frozenBalance float64) error
+	FindForUpdate(ctx context.Context, conn msdb.DbConn, memberId int64, symbol string) (*model.MemberWallet, error)
+	ChangeBalance(ctx context.Context, conn msdb.DbConn, id int64, version int, balance decimal.Decimal, frozenBalance decimal.Decimal) (int64, error)
 	FindByMemberId(ctx context.Context, memId int64) ([]*model.MemberWallet, error)
 	UpdateAddress(ctx context.Context, wallet *model.MemberWallet) error
 	FindAllAddress(ctx context.Context, name string) ([]string, error)
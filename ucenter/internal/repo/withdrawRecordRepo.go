@@ -2,11 +2,12 @@ package repo
 
 import (
 	"context"
+	"mscoin-common/msdb"
 	"ucenter/internal/model"
 )
 
 type WithdrawRecordRepo interface {
-	Save(ctx context.Context, record *model.WithdrawRecord) error
-	UpdateSuccess(ctx context.Context, txId model.WithdrawRecord) error
+	Save(ctx context.Context, conn msdb.DbConn, record *model.WithdrawRecord) error
+	UpdateSuccess(ctx context.Context, conn msdb.DbConn, txId model.WithdrawRecord) error
 	FindByUserId(ctx context.Context, userId int64, page int64, pageSize int64) ([]*model.WithdrawRecord, int64, error)
 }
\ No newline at end of file
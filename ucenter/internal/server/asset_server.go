@@ -43,4 +43,13 @@ func (s *AssetServer) ResetAddress(ctx context.Context, in *asset.AssetReq) (*as
 func (s *AssetServer) FindTransaction(ctx context.Context, in *asset.AssetReq) (*asset.MemberTransactionList, error) {
 	l := logic.NewAssetLogic(ctx, s.svcCtx)
 	return l.FindTransaction(in)
-}
\ No newline at end of file
+}
+func (s *AssetServer) FindLedger(ctx context.Context, in *asset.AssetReq) (*asset.MemberLedgerList, error) {
+	l := logic.NewAssetLogic(ctx, s.svcCtx)
+	return l.FindLedger(in)
+}
+
+func (s *AssetServer) FindStatement(ctx context.Context, in *asset.AssetReq) (*asset.LedgerStatement, error) {
+	l := logic.NewAssetLogic(ctx, s.svcCtx)
+	return l.FindStatement(in)
+}
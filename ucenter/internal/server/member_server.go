@@ -21,4 +21,19 @@ func NewMemberServer(svcCtx *svc.ServiceContext) *MemberServer {
 func (s *MemberServer) FindMemberById(ctx context.Context, in *member.MemberReq) (*member.MemberInfo, error) {
 	l := logic.NewMemberLogic(ctx, s.svcCtx)
 	return l.FindMemberById(in)
-}
\ No newline at end of file
+}
+
+func (s *MemberServer) RefreshFeeTier(ctx context.Context, in *member.FeeTierReq) (*member.FeeTierRes, error) {
+	l := logic.NewMemberLogic(ctx, s.svcCtx)
+	return l.RefreshFeeTier(in)
+}
+
+func (s *MemberServer) PayCommission(ctx context.Context, in *member.CommissionReq) (*member.CommissionRes, error) {
+	l := logic.NewMemberLogic(ctx, s.svcCtx)
+	return l.PayCommission(in)
+}
+
+func (s *MemberServer) FindCommission(ctx context.Context, in *member.MemberReq) (*member.CommissionInfo, error) {
+	l := logic.NewMemberLogic(ctx, s.svcCtx)
+	return l.FindCommission(in)
+}
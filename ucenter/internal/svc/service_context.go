@@ -4,6 +4,7 @@ import (
 	"grpc-common/exchange/eclient"
 	"grpc-common/market/mclient"
 	"mscoin-common/msdb"
+	"mscoin-common/msdb/outbox"
 	"ucenter/internal/config"
 	"ucenter/internal/consumer"
 	"ucenter/internal/database"
@@ -23,6 +24,10 @@ type ServiceContext struct {
 }
 
 func NewServiceContext(c config.Config) *ServiceContext {
+	// 没有平台账户手续费记不了账 结算消息会一直重试 后面的成交都结算不了
+	if c.Exchange.FeeMemberId <= 0 {
+		panic("没有配置平台收手续费的账户 Exchange.FeeMemberId")
+	}
 	redisCache := cache.New(
 		c.CacheRedis,
 		nil,
@@ -35,17 +40,30 @@ func NewServiceContext(c config.Config) *ServiceContext {
 	order := eclient.NewOrder(zrpc.MustNewClient(c.ExchangeRpc))
 	conf := c.CacheRedis[0].RedisConf
 	newRedis := redis.MustNewRedis(conf)
-	go consumer.ExchangeOrderAdd(newRedis, cli, order, mysql)
+	go consumer.ExchangeOrderAdd(cli, order, mysql)
 	completeCli := cli.StartReadNew("exchange_order_complete_update_success")
-	go consumer.ExchangeOrderComplete(newRedis, completeCli, mysql)
+	go consumer.ExchangeOrderComplete(completeCli, mysql)
+	cancelCli := cli.StartReadNew("exchange_order_cancel_update_success")
+	go consumer.ExchangeOrderCancel(cancelCli, mysql)
+	tradeCli := cli.StartReadNew("exchange_order_trade")
+	go consumer.ExchangeOrderTrade(newRedis, tradeCli, mysql, c.Exchange)
+	amendCli := cli.StartReadNew("exchange_order_amend_freeze")
+	go consumer.ExchangeOrderAmendFreeze(amendCli, mysql)
+	amendedCli := cli.StartReadNew("exchange_order_amend_update_success")
+	go consumer.ExchangeOrderAmendRelease(amendedCli, mysql)
 	btCli := cli.StartReadNew("BTC_TRANSACTION")
 	go consumer.BitCoinTransaction(newRedis, btCli, mysql)
 	withdrawCli := cli.StartReadNew("withdraw")
 	go consumer.WithdrawConsumer(withdrawCli, mysql, c.Bitcoin.Address)
+	// 事务里写进outbox的消息 提交以后由relay发给kafka
+	outbox.NewRelay(mysql, func(topic string, key []byte, data []byte) error {
+		return cli.SendKeyed(database.KafkaData{Topic: topic, Key: key, Data: data})
+	}).Start()
 	return &ServiceContext{
 		Config:    c,
 		Cache:     redisCache,
 		Db:        database.ConnMysql(c.Mysql.DataSource),
 		MarketRpc: mclient.NewMarket(zrpc.MustNewClient(c.MarketRpc)),
+		KafkaCli:  cli,
 	}
 }